@@ -0,0 +1,94 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"github.com/excoriate/aws-secrets-rotation-lambda/dagger-pipeline/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/dagger-pipeline/internal/tui"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/adapter"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/posture"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"io"
+	"os"
+	"strings"
+)
+
+// AuditPosture scans the secrets of the account and writes their rotation posture report. The
+// report is written to the output file or, if it's not set, to stdout (without any other
+// message, so it can be piped).
+func AuditPosture() error {
+	msg := tui.NewTUIMessage()
+	output := strings.TrimSpace(viper.GetString("output"))
+
+	format, err := posture.ParseFormat(viper.GetString("format"))
+	if err != nil {
+		msg.ShowError("", "Invalid report format", err)
+		return err
+	}
+
+	tags, err := client.ParseTags(viper.GetString("tags"))
+	if err != nil {
+		err = erroer.NewTaskError("invalid secrets filter", err)
+		msg.ShowError("", "Invalid secrets filter", err)
+		return err
+	}
+
+	filter := client.ListFilter{NamePrefix: strings.TrimSpace(viper.GetString("name-prefix")), Tags: tags}
+
+	logger := zap.NewNop()
+	if viper.GetBool("debug") {
+		logger, _ = zap.NewDevelopment()
+	}
+
+	var opts []adapter.Option
+	if endpoint := strings.TrimSpace(viper.GetString("endpoint")); endpoint != "" {
+		opts = append(opts, adapter.WithSecretsManagerEndpoint(endpoint))
+	}
+
+	ctx := context.Background()
+	cfg, err := adapter.NewAWS(ctx, viper.GetString("region"), opts...)
+	if err != nil {
+		msg.ShowError("", "Failed to configure the AWS client", err)
+		return err
+	}
+
+	if output != "" {
+		tui.NewTitle().ShowSubTitle("secret:", "Audit")
+		msg.ShowInfo("", "Auditing the rotation posture of the secrets of the account")
+	}
+
+	secrets, err := client.NewSecretsManager(cfg, logger, client.DefaultTimeout, client.DefaultDescribeConcurrency).ListAll(ctx, filter)
+	if err != nil {
+		msg.ShowError("", "Failed to list the secrets", err)
+		return err
+	}
+
+	report := posture.Analyze(secrets, posture.Options{LambdaARN: viper.GetString("lambda-arn")})
+
+	var w io.Writer = os.Stdout
+	if output != "" {
+		file, err := os.Create(output)
+		if err != nil {
+			err = erroer.NewTaskError(fmt.Sprintf("unable to create the report file %s", output), err)
+			msg.ShowError("", "Failed to write the report", err)
+			return err
+		}
+
+		defer file.Close()
+		w = file
+	}
+
+	if err := posture.Write(w, report, format); err != nil {
+		msg.ShowError("", "Failed to write the report", err)
+		return err
+	}
+
+	if output != "" {
+		msg.ShowSuccess("", fmt.Sprintf("%d secrets audited, %d compliant. Report written to %s",
+			report.Summary.Secrets, report.Summary.Compliant, output))
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package tasks
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/dagger-pipeline/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/dagger-pipeline/internal/tui"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/adapter"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/rotation"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// RollbackSecret moves AWSCURRENT of the secret back to its AWSPREVIOUS version, with the same
+// runtime configuration (TF_VAR_rotation_*) and audit sinks as the lambda.
+func RollbackSecret() error {
+	ux := tui.NewTitle()
+	msg := tui.NewTUIMessage()
+	ux.ShowSubTitle("secret:", "Rollback")
+
+	secretId := strings.TrimSpace(viper.GetString("secret-id"))
+	if secretId == "" {
+		err := erroer.NewTaskError("the secret to roll back is required", nil)
+		msg.ShowError("", "Invalid rollback", err)
+		return err
+	}
+
+	logger := zap.NewNop()
+	if viper.GetBool("debug") {
+		logger, _ = zap.NewDevelopment()
+	}
+
+	cfg, err := config.FromEnv()
+	if err == nil {
+		err = cfg.Validate()
+	}
+
+	if err != nil {
+		msg.ShowError("", "Invalid rotation configuration", err)
+		return err
+	}
+
+	var opts []adapter.Option
+	if endpoint := strings.TrimSpace(viper.GetString("endpoint")); endpoint != "" {
+		opts = append(opts, adapter.WithSecretsManagerEndpoint(endpoint))
+	}
+
+	ctx := context.Background()
+	awsCfg, err := adapter.NewAWS(ctx, viper.GetString("region"), opts...)
+	if err != nil {
+		msg.ShowError("", "Failed to configure the AWS client", err)
+		return err
+	}
+
+	smClient := client.NewSecretsManager(awsCfg, logger, time.Duration(cfg.Timeouts.API), cfg.DescribeConcurrency)
+	rotator, err := rotation.NewRotatorWithClient(cfg, rotation.Event{Arn: aws.String(secretId)}, logger,
+		smClient)
+	if err != nil {
+		msg.ShowError("", "Failed to set up the rotator", err)
+		return err
+	}
+
+	sink, err := rotation.NewAuditSink(ctx, cfg.Audit, logger)
+	if err != nil {
+		msg.ShowError("", "Failed to set up the audit sinks", err)
+		return err
+	}
+
+	msg.ShowInfo("", fmt.Sprintf("Rolling back secret %s to its AWSPREVIOUS version", secretId))
+
+	result, err := rotator.Rollback(ctx, secretId, rotation.RollbackOptions{
+		RestoreTarget:   viper.GetBool("restore-target"),
+		OnlyIfTestFails: viper.GetBool("if-test-fails"),
+		Reason:          viper.GetString("reason"),
+		Audit:           sink,
+		Salt:            cfg.Audit.Salt,
+	})
+	if err != nil {
+		msg.ShowError("", "The rollback failed", err)
+		return err
+	}
+
+	if !result.RolledBack {
+		msg.ShowInfo("", fmt.Sprintf("AWSCURRENT version %s passed its test, it was not rolled back",
+			result.FromVersion))
+		return nil
+	}
+
+	if result.TestError != "" {
+		msg.ShowWarning("", fmt.Sprintf("AWSCURRENT version %s failed its test: %s", result.FromVersion,
+			result.TestError))
+	}
+
+	if result.TargetRestored {
+		msg.ShowInfo("", fmt.Sprintf("AWSPREVIOUS value restored in the target system of the %s strategy",
+			result.Strategy))
+	}
+
+	msg.ShowSuccess("", fmt.Sprintf("Secret %s rolled back from version %s to version %s", result.SecretARN,
+		result.FromVersion, result.ToVersion))
+	return nil
+}
@@ -0,0 +1,134 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/excoriate/aws-secrets-rotation-lambda/dagger-pipeline/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/dagger-pipeline/internal/simulator"
+	"github.com/excoriate/aws-secrets-rotation-lambda/dagger-pipeline/internal/tui"
+	"github.com/pterm/pterm"
+	"github.com/spf13/viper"
+	"go.uber.org/zap"
+	"os"
+	"strings"
+)
+
+func SimulateRotation() error {
+	ux := tui.NewTitle()
+	msg := tui.NewTUIMessage()
+	ux.ShowSubTitle("secret:", "Simulate")
+
+	secret, err := getSecretDefinition()
+	if err != nil {
+		msg.ShowError("", "Failed to get the secret definition", err)
+		return err
+	}
+
+	// The lambda logs are only shown in debug mode, so they don't hide the version tables.
+	logger := zap.NewNop()
+	if viper.GetBool("debug") {
+		logger, _ = zap.NewDevelopment()
+	}
+
+	ctx := context.Background()
+	var sim *simulator.Simulator
+	endpoint := strings.TrimSpace(viper.GetString("endpoint"))
+	if endpoint == "" {
+		msg.ShowInfo("", "Simulating the rotation against the in-memory Secrets Manager")
+		sim, err = simulator.NewInMemorySimulator(logger, secret)
+	} else {
+		msg.ShowInfo("", fmt.Sprintf("Simulating the rotation against the emulator at %s", endpoint))
+		region := viper.GetString("region")
+		if region == "" {
+			region = "us-east-1"
+		}
+
+		sim, err = simulator.NewEmulatorSimulator(ctx, logger, endpoint, region, secret)
+	}
+
+	if err != nil {
+		msg.ShowError("", "Failed to set up the simulation", err)
+		return err
+	}
+
+	msg.ShowInfo("", fmt.Sprintf("Rotating secret %s with ClientRequestToken %s", sim.SecretArn,
+		sim.Token))
+
+	versions, err := sim.Versions(ctx)
+	if err != nil {
+		msg.ShowError("", "Failed to describe the secret", err)
+		return err
+	}
+
+	showVersions("initial state", sim.Token, versions)
+
+	if err := sim.Run(ctx, func(result simulator.StepResult) {
+		showVersions(result.Step, sim.Token, result.Versions)
+	}); err != nil {
+		msg.ShowError("", "The rotation failed", err)
+		return err
+	}
+
+	msg.ShowSuccess("", fmt.Sprintf("Secret %s rotated successfully", sim.SecretArn))
+	return nil
+}
+
+// getSecretDefinition reads the secret from the secret-file flag (JSON), overridden by the
+// secret-name, secret-value and secret-tags flags.
+func getSecretDefinition() (simulator.Secret, error) {
+	var secret simulator.Secret
+
+	if secretFile := viper.GetString("secret-file"); secretFile != "" {
+		content, err := os.ReadFile(secretFile)
+		if err != nil {
+			return secret, erroer.NewTaskError(fmt.Sprintf("unable to read the secret file %s",
+				secretFile), err)
+		}
+
+		if err := json.Unmarshal(content, &secret); err != nil {
+			return secret, erroer.NewTaskError(fmt.Sprintf("the secret file %s is not valid JSON",
+				secretFile), err)
+		}
+	}
+
+	if name := viper.GetString("secret-name"); name != "" {
+		secret.Name = name
+	}
+
+	if value := viper.GetString("secret-value"); value != "" {
+		secret.Value = value
+	}
+
+	if tags := viper.GetStringMapString("secret-tags"); len(tags) > 0 {
+		if secret.Tags == nil {
+			secret.Tags = map[string]string{}
+		}
+
+		for key, value := range tags {
+			secret.Tags[key] = value
+		}
+	}
+
+	if secret.Name == "" || secret.Value == "" {
+		return secret, erroer.NewTaskError("the secret requires a name and a value", nil)
+	}
+
+	return secret, nil
+}
+
+func showVersions(title, token string, versions []simulator.Version) {
+	pterm.DefaultSection.Println(title)
+
+	data := pterm.TableData{{"Version", "Staging labels"}}
+	for _, version := range versions {
+		id := version.ID
+		if id == token {
+			id = fmt.Sprintf("%s (token)", id)
+		}
+
+		data = append(data, []string{id, strings.Join(version.Stages, ", ")})
+	}
+
+	_ = pterm.DefaultTable.WithHasHeader().WithData(data).Render()
+}
@@ -78,6 +78,7 @@ func initConfig() {
 func AddSubCommands() {
 	rootCmd.AddCommand(LambdaCMD)
 	rootCmd.AddCommand(InfraCMD)
+	rootCmd.AddCommand(SecretCMD)
 }
 
 func init() {
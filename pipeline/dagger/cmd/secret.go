@@ -0,0 +1,160 @@
+package cmd
+
+import (
+	"github.com/excoriate/aws-secrets-rotation-lambda/dagger-pipeline/ci/tasks"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"os"
+)
+
+var (
+	secretFile  string
+	secretName  string
+	secretValue string
+	secretTags  map[string]string
+	endpoint    string
+	region      string
+	// Posture audit specific flags.
+	reportFormat string
+	reportOutput string
+	lambdaARN    string
+	namePrefix   string
+	filterTags   string
+	// Rollback specific flags.
+	secretId      string
+	restoreTarget bool
+	ifTestFails   bool
+	reason        string
+)
+
+var SecretCMD = &cobra.Command{
+	Use: "secret",
+	Long: `Perform actions on secrets, such as running a rotation locally, auditing the rotation
+posture of an account, or rolling back a secret.`,
+	Example: `
+rotator secret simulate --secret-name=my-secret --secret-value='{"password":"changeme"}'
+rotator secret audit --region=us-east-1 --format=markdown --output=posture.md
+rotator secret rollback --secret-id=prod/db --restore-target --reason="bad password promoted"
+  `,
+	Run: func(cmd *cobra.Command, args []string) {
+		_ = cmd.Help()
+	},
+}
+
+var SimulateCMD = &cobra.Command{
+	Use: "simulate",
+	Long: `Run the createSecret, setSecret, testSecret and finishSecret steps of the rotator lambda,
+in order, against an in-memory Secrets Manager (or a local emulator, if an endpoint is set),
+printing the versions and staging labels of the secret after each step.`,
+	Example: `
+rotator secret simulate --secret-file=secret.json
+rotator secret simulate --secret-name=my-secret --secret-value='{"password":"changeme"}' \
+  --secret-tags=rotation:strategy=static --endpoint=http://localhost:4566
+  `,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := tasks.SimulateRotation(); err != nil {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	},
+}
+
+var AuditCMD = &cobra.Command{
+	Use: "audit",
+	Long: `Scan the secrets of the account and report their rotation posture: secrets with rotation
+disabled, overdue against their rotation rules, rotated by another lambda, or whose last
+rotation failed. The report is written as JSON, CSV or Markdown.`,
+	Example: `
+rotator secret audit --region=us-east-1
+rotator secret audit --format=csv --output=posture.csv \
+  --lambda-arn=arn:aws:lambda:us-east-1:123456789012:function:secrets-rotator
+rotator secret audit --name-prefix=prod/ --tags=team=payments,rotation
+  `,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := tasks.AuditPosture(); err != nil {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	},
+}
+
+var RollbackCMD = &cobra.Command{
+	Use: "rollback",
+	Long: `Move AWSCURRENT of a secret back to the version that holds AWSPREVIOUS, optionally setting
+the previous value back in the target system of its strategy first. Every rollback is written to
+the audit sinks of the lambda (TF_VAR_rotation_audit_*).`,
+	Example: `
+rotator secret rollback --secret-id=prod/db --reason="bad password promoted"
+rotator secret rollback --secret-id=prod/db --restore-target --if-test-fails
+  `,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := tasks.RollbackSecret(); err != nil {
+			os.Exit(1)
+		}
+
+		os.Exit(0)
+	},
+}
+
+func addSecretCMDFlags() {
+	SecretCMD.PersistentFlags().StringVarP(&endpoint, "endpoint", "e", "",
+		"Endpoint of a Secrets Manager emulator (e.g.: http://localhost:4566). If it's not set, "+
+			"simulations use the in-memory Secrets Manager, and the other commands the AWS account.")
+	SecretCMD.PersistentFlags().StringVarP(&region, "region", "r", "",
+		"Region of Secrets Manager. If it's not set, the region of the AWS configuration is used "+
+			"(us-east-1 in simulations).")
+
+	_ = viper.BindPFlag("endpoint", SecretCMD.PersistentFlags().Lookup("endpoint"))
+	_ = viper.BindPFlag("region", SecretCMD.PersistentFlags().Lookup("region"))
+
+	SimulateCMD.Flags().StringVarP(&secretFile, "secret-file", "f", "",
+		"JSON file with the secret definition (name, value, description and tags).")
+	SimulateCMD.Flags().StringVarP(&secretName, "secret-name", "n", "", "Name of the secret.")
+	SimulateCMD.Flags().StringVarP(&secretValue, "secret-value", "v", "", "Value of the secret.")
+	SimulateCMD.Flags().StringToStringVarP(&secretTags, "secret-tags", "t", nil,
+		"Tags of the secret (e.g.: rotation:strategy=static).")
+
+	_ = viper.BindPFlag("secret-file", SimulateCMD.Flags().Lookup("secret-file"))
+	_ = viper.BindPFlag("secret-name", SimulateCMD.Flags().Lookup("secret-name"))
+	_ = viper.BindPFlag("secret-value", SimulateCMD.Flags().Lookup("secret-value"))
+	_ = viper.BindPFlag("secret-tags", SimulateCMD.Flags().Lookup("secret-tags"))
+
+	AuditCMD.Flags().StringVarP(&reportFormat, "format", "f", "json",
+		"Format of the report: json, csv or markdown.")
+	AuditCMD.Flags().StringVarP(&reportOutput, "output", "o", "",
+		"File the report is written to. If it's not set, it's written to stdout.")
+	AuditCMD.Flags().StringVarP(&lambdaARN, "lambda-arn", "l", "",
+		"ARN of the rotation lambda the secrets are expected to be rotated by.")
+	AuditCMD.Flags().StringVarP(&namePrefix, "name-prefix", "p", "",
+		"Only audit the secrets whose name starts with this prefix.")
+	AuditCMD.Flags().StringVarP(&filterTags, "tags", "t", "",
+		"Only audit the secrets with these tags, as key=value pairs (or bare keys) separated by commas.")
+
+	_ = viper.BindPFlag("format", AuditCMD.Flags().Lookup("format"))
+	_ = viper.BindPFlag("output", AuditCMD.Flags().Lookup("output"))
+	_ = viper.BindPFlag("lambda-arn", AuditCMD.Flags().Lookup("lambda-arn"))
+	_ = viper.BindPFlag("name-prefix", AuditCMD.Flags().Lookup("name-prefix"))
+	_ = viper.BindPFlag("tags", AuditCMD.Flags().Lookup("tags"))
+
+	RollbackCMD.Flags().StringVarP(&secretId, "secret-id", "s", "", "Name or ARN of the secret to roll back.")
+	RollbackCMD.Flags().BoolVarP(&restoreTarget, "restore-target", "t", false,
+		"Set the AWSPREVIOUS value back in the target system (e.g.: the database) before rolling back.")
+	RollbackCMD.Flags().BoolVarP(&ifTestFails, "if-test-fails", "i", false,
+		"Only roll back if the AWSCURRENT value fails the test of its strategy.")
+	RollbackCMD.Flags().StringVarP(&reason, "reason", "m", "", "Why the secret is rolled back, for the audit trail.")
+
+	_ = viper.BindPFlag("secret-id", RollbackCMD.Flags().Lookup("secret-id"))
+	_ = viper.BindPFlag("restore-target", RollbackCMD.Flags().Lookup("restore-target"))
+	_ = viper.BindPFlag("if-test-fails", RollbackCMD.Flags().Lookup("if-test-fails"))
+	_ = viper.BindPFlag("reason", RollbackCMD.Flags().Lookup("reason"))
+
+	SecretCMD.AddCommand(SimulateCMD)
+	SecretCMD.AddCommand(AuditCMD)
+	SecretCMD.AddCommand(RollbackCMD)
+}
+
+func init() {
+	addSecretCMDFlags()
+}
@@ -0,0 +1,234 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/adapter"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/rotation"
+	"go.uber.org/zap"
+	"os"
+	"sort"
+)
+
+// Secret is the definition of the secret to rotate in a simulation.
+type Secret struct {
+	Name        string            `json:"name"`
+	Value       string            `json:"value"`
+	Description string            `json:"description"`
+	Tags        map[string]string `json:"tags"`
+}
+
+type Version struct {
+	ID     string
+	Stages []string
+}
+
+// StepResult is the state of the secret after a rotation step.
+type StepResult struct {
+	Step     string
+	Versions []Version
+}
+
+// Simulator runs the four rotation steps of the lambda, in order, against a Secrets Manager
+// that isn't a real account: the in-memory backend or a local emulator.
+type Simulator struct {
+	Logger    *zap.Logger
+	Client    client.SecretsManager
+	SecretArn string
+	Token     string
+	// validate runs the same pre-checks as the lambda. They're skipped on emulators, since there
+	// the AWSPENDING version only exists once createSecret has put it.
+	validate bool
+}
+
+// Run executes createSecret, setSecret, testSecret and finishSecret, calling onStep after each
+// one succeeds. It stops at the first step that fails.
+func (s *Simulator) Run(ctx context.Context, onStep func(StepResult)) error {
+	for _, step := range rotation.AllowedSteps {
+		event := rotation.Event{
+			Arn:   aws.String(s.SecretArn),
+			Token: aws.String(s.Token),
+			Step:  aws.String(step),
+		}
+
+		if err := s.runStep(ctx, event); err != nil {
+			return fmt.Errorf("step %s failed: %w", step, err)
+		}
+
+		versions, err := s.Versions(ctx)
+		if err != nil {
+			return err
+		}
+
+		onStep(StepResult{Step: step, Versions: versions})
+	}
+
+	return nil
+}
+
+func (s *Simulator) runStep(ctx context.Context, event rotation.Event) error {
+	cfg, err := config.FromEnv()
+	if err != nil {
+		return err
+	}
+
+	rotator, err := rotation.NewRotatorWithClient(cfg, event, s.Logger, s.Client)
+	if err != nil {
+		return err
+	}
+
+	if err := rotator.IsRotationAttemptValid(event); err != nil {
+		return err
+	}
+
+	var secret *secretsmanager.DescribeSecretOutput
+	if s.validate {
+		secret, err = rotator.IsSecretValidToRotate(ctx, s.SecretArn, s.Token)
+	} else {
+		secret, err = s.Client.GetSecret(ctx, s.SecretArn)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	// Like the lambda, a validated step of a rotation that already finished does nothing.
+	if s.validate && rotation.IsVersionCurrent(secret, s.Token) {
+		return nil
+	}
+
+	secretType, err := rotator.ResolveSecretType(ctx, secret)
+	if err != nil {
+		return err
+	}
+
+	return rotator.Rotate(ctx, event, secret, *event.Step, secretType)
+}
+
+// Versions returns the versions of the secret that have staging labels, sorted by id.
+func (s *Simulator) Versions(ctx context.Context) ([]Version, error) {
+	secret, err := s.Client.GetSecret(ctx, s.SecretArn)
+	if err != nil {
+		return nil, err
+	}
+
+	var versions []Version
+	for id, stages := range secret.VersionIdsToStages {
+		sortedStages := append([]string(nil), stages...)
+		sort.Strings(sortedStages)
+		versions = append(versions, Version{ID: id, Stages: sortedStages})
+	}
+
+	sort.Slice(versions, func(i, j int) bool {
+		return versions[i].ID < versions[j].ID
+	})
+
+	return versions, nil
+}
+
+// NewInMemorySimulator seeds the in-memory Secrets Manager backend with the secret, and starts
+// its rotation the same way Secrets Manager does.
+func NewInMemorySimulator(logger *zap.Logger, secret Secret) (*Simulator, error) {
+	backend := client.NewInMemorySecretsManager(logger)
+	arn, err := backend.CreateSecret(client.InMemorySecretInput{
+		Name:            secret.Name,
+		Description:     secret.Description,
+		Value:           secret.Value,
+		RotationEnabled: true,
+		Tags:            secret.Tags,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the secret %s: %w", secret.Name, err)
+	}
+
+	token, err := backend.StartRotation(arn, "")
+	if err != nil {
+		return nil, fmt.Errorf("unable to start the rotation of secret %s: %w", secret.Name, err)
+	}
+
+	return &Simulator{
+		Logger:    logger,
+		Client:    backend,
+		SecretArn: arn,
+		Token:     token,
+		validate:  true,
+	}, nil
+}
+
+// NewEmulatorSimulator creates the secret (unless it already exists) in the Secrets Manager
+// emulator listening on the given endpoint (e.g.: LocalStack or moto).
+func NewEmulatorSimulator(ctx context.Context, logger *zap.Logger, endpoint, region string,
+	secret Secret) (*Simulator, error) {
+	opts := []adapter.Option{adapter.WithSecretsManagerEndpoint(endpoint)}
+
+	// Emulators accept any credentials, so dummy ones are used unless they're set.
+	if os.Getenv("AWS_ACCESS_KEY_ID") == "" {
+		opts = append(opts, adapter.WithStaticCredentials("test", "test", ""))
+	}
+
+	cfg, err := adapter.NewAWS(ctx, region, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to configure the emulator client: %w", err)
+	}
+
+	arn, err := createEmulatorSecret(ctx, secretsmanager.NewFromConfig(cfg), secret)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := generator.NewGenerator().Generate(ctx, generator.Policy{Format: generator.FormatUUID})
+	if err != nil {
+		return nil, fmt.Errorf("unable to generate the ClientRequestToken: %w", err)
+	}
+
+	return &Simulator{
+		Logger:    logger,
+		Client:    client.NewSecretsManager(cfg, logger, client.DefaultTimeout, client.DefaultDescribeConcurrency),
+		SecretArn: arn,
+		Token:     token,
+	}, nil
+}
+
+func createEmulatorSecret(ctx context.Context, api *secretsmanager.Client, secret Secret) (string,
+	error) {
+	var tags []types.Tag
+	for key, value := range secret.Tags {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	input := &secretsmanager.CreateSecretInput{
+		Name:         aws.String(secret.Name),
+		SecretString: aws.String(secret.Value),
+		Tags:         tags,
+	}
+
+	if secret.Description != "" {
+		input.Description = aws.String(secret.Description)
+	}
+
+	created, err := api.CreateSecret(ctx, input)
+	if err == nil {
+		return aws.ToString(created.ARN), nil
+	}
+
+	var exists *types.ResourceExistsException
+	if !errors.As(err, &exists) {
+		return "", fmt.Errorf("unable to create the secret %s in the emulator: %w", secret.Name, err)
+	}
+
+	existing, err := api.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{
+		SecretId: aws.String(secret.Name),
+	})
+	if err != nil {
+		return "", fmt.Errorf("unable to describe the secret %s in the emulator: %w", secret.Name, err)
+	}
+
+	return aws.ToString(existing.ARN), nil
+}
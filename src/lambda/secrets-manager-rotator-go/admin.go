@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/posture"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/rotation"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/tracing"
+	"go.uber.org/zap"
+	"strconv"
+	"strings"
+)
+
+// handleInvocation is the entrypoint of the lambda. It decodes the payload, and routes rotation
+// events (native or wrapped by EventBridge) to handleRequest, and admin actions to
+// handleAdminAction.
+func handleInvocation(ctx context.Context, payload json.RawMessage) (interface{}, error) {
+	invocation, err := rotation.DecodeInvocation(payload)
+	if err != nil {
+		logger := GetLogger()
+		logger.Error("Invocation payload can not be decoded", zap.Error(err))
+		_ = logger.Sync()
+		return nil, err
+	}
+
+	if invocation.Action != nil {
+		return handleAdminAction(ctx, *invocation.Action)
+	}
+
+	return handleRequest(ctx, *invocation.Event)
+}
+
+func handleAdminAction(ctx context.Context, action rotation.AdminAction) (result interface{}, err error) {
+	logger := GetLogger()
+
+	ctx, span := tracing.Start(ctx, "handleAdminAction",
+		tracing.AttributeSecretArn.String(action.SecretId))
+
+	// Like handleRequest, a panic is reported as a function error instead of crashing the process,
+	// and the outcome of the action is logged and traced in any case.
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Admin action panicked", zap.Any("panic", r), zap.Stack("stack"))
+			result = nil
+			err = erroer.NewRotationError(fmt.Sprintf("admin action %s panicked: %v", action.Action, r), nil)
+		}
+
+		if err != nil {
+			logger.Error("Admin action failed", zap.String("action", action.Action),
+				zap.String("errorClass", erroer.Class(err)), zap.Error(err))
+		} else {
+			logger.Info("Admin action completed", zap.String("action", action.Action))
+		}
+
+		tracing.End(span, err)
+		if flushErr := tracing.Flush(ctx); flushErr != nil {
+			logger.Warn("Unable to export the spans of the invocation", zap.Error(flushErr))
+		}
+
+		_ = logger.Sync()
+	}()
+
+	logger.Info("Admin action received", zap.String("action", action.Action),
+		zap.String("secret_id", action.SecretId))
+
+	// The action is validated before the rotator is built, since building it may already call
+	// AWS (e.g.: to assume the role of the secret account).
+	if err := rotation.ValidateAdminAction(action); err != nil {
+		return nil, err
+	}
+
+	// The secret (if any) selects the account, and thus the role, the action runs in.
+	var event rotation.Event
+	if action.SecretId != "" {
+		event.Arn = aws.String(action.SecretId)
+	}
+
+	cfg, err := runtimeConfig(ctx, logger)
+	if err != nil {
+		logger.Error("Rotation lambda configuration is not valid", zap.Error(err))
+		return nil, err
+	}
+
+	c, err := newRotator(ctx, cfg, event, logger)
+	if err != nil {
+		logger.Error("AWS Secrets manager rotator lambda cannot be initialised", zap.Error(err))
+		return nil, fmt.Errorf("AWS Secrets manager rotator lambda cannot be initialised: %w", err)
+	}
+
+	switch action.Action {
+	case rotation.ActionListSecrets:
+		filter, err := listFilter(action.Arguments)
+		if err != nil {
+			logger.Error("Invalid secrets filter", zap.Error(err))
+			return nil, err
+		}
+
+		return ListSecretsInAccount(ctx, c, filter)
+	case rotation.ActionPostureAudit:
+		return postureAudit(ctx, c, action.Arguments)
+	case rotation.ActionRollback:
+		return rollback(ctx, c, cfg.Audit, action)
+	default:
+		// ValidateAdminAction only accepts the actions above.
+		return nil, erroer.NewValidationError(fmt.Sprintf("admin action %s is not handled", action.Action), nil)
+	}
+}
+
+// postureAudit scans the secrets of the account and reports their rotation posture. The
+// "format" argument selects json (the default, returned as an object), csv or markdown (returned
+// as a string). Secrets are expected to be rotated by this lambda, unless the "lambda_arn"
+// argument sets another one.
+func postureAudit(ctx context.Context, c *rotation.RotatorClient, arguments map[string]string) (interface{},
+	error) {
+	format, err := posture.ParseFormat(arguments["format"])
+	if err != nil {
+		c.Logger.Error("Invalid posture report format", zap.Error(err))
+		return nil, erroer.NewValidationError("invalid posture report format", err)
+	}
+
+	filter, err := listFilter(arguments)
+	if err != nil {
+		c.Logger.Error("Invalid secrets filter", zap.Error(err))
+		return nil, err
+	}
+
+	lambdaARN := arguments["lambda_arn"]
+	if lc, ok := lambdacontext.FromContext(ctx); ok && lambdaARN == "" {
+		lambdaARN = lc.InvokedFunctionArn
+	}
+
+	c.Logger.Info("Auditing the rotation posture of the account...")
+	secrets, err := c.Client.ListAll(ctx, filter)
+	if err != nil {
+		c.Logger.Error("failed to list secrets", zap.Error(err))
+		return nil, erroer.NewSecretError("failed to list secrets", err)
+	}
+
+	report := posture.Analyze(secrets, posture.Options{LambdaARN: lambdaARN})
+	c.Logger.Info("Rotation posture audited", zap.Int("secrets", report.Summary.Secrets),
+		zap.Int("compliant", report.Summary.Compliant))
+
+	if format == posture.FormatJSON {
+		return report, nil
+	}
+
+	var out strings.Builder
+	if err := posture.Write(&out, report, format); err != nil {
+		return nil, fmt.Errorf("unable to write the posture report: %w", err)
+	}
+
+	return out.String(), nil
+}
+
+// rollback moves AWSCURRENT of the action secret back to its AWSPREVIOUS version. The
+// "restore_target" argument sets the AWSPREVIOUS value back in the target system first, the
+// "if_test_fails" argument only rolls back if the AWSCURRENT value fails its test, and the
+// "reason" argument is recorded in the audit trail.
+func rollback(ctx context.Context, c *rotation.RotatorClient, auditCfg config.Audit,
+	action rotation.AdminAction) (interface{}, error) {
+	opts := rotation.RollbackOptions{Reason: strings.TrimSpace(action.Arguments["reason"])}
+	for argument, flag := range map[string]*bool{
+		"restore_target": &opts.RestoreTarget,
+		"if_test_fails":  &opts.OnlyIfTestFails,
+	} {
+		value := strings.TrimSpace(action.Arguments[argument])
+		if value == "" {
+			continue
+		}
+
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			c.Logger.Error("Invalid rollback argument", zap.String("argument", argument), zap.Error(err))
+			return nil, erroer.NewValidationError("invalid rollback argument",
+				erroer.NewEventError("arguments."+argument, err.Error(), erroer.ErrEventMalformed))
+		}
+
+		*flag = parsed
+	}
+
+	sink, err := newAuditSink(ctx, auditCfg, c.Logger)
+	if err != nil {
+		c.Logger.Error("Rotation audit sink cannot be initialised", zap.Error(err))
+		return nil, fmt.Errorf("rotation audit sink cannot be initialised: %w", err)
+	}
+
+	opts.Audit = sink
+	opts.Salt = auditCfg.Salt
+
+	return c.Rollback(ctx, action.SecretId, opts)
+}
+
+// listFilter builds the secrets filter of an admin action from its "name_prefix" argument, and
+// its "tags" argument: a comma separated list of key=value pairs, or bare keys that only require
+// the tag to be set.
+func listFilter(arguments map[string]string) (client.ListFilter, error) {
+	filter := client.ListFilter{NamePrefix: strings.TrimSpace(arguments["name_prefix"])}
+
+	tags, err := client.ParseTags(arguments["tags"])
+	if err != nil {
+		return client.ListFilter{}, erroer.NewValidationError("invalid secrets filter",
+			erroer.NewEventError("arguments.tags", err.Error(), erroer.ErrEventMalformed))
+	}
+
+	filter.Tags = tags
+	return filter, nil
+}
@@ -2,31 +2,165 @@ package adapter
 
 import (
 	"context"
+	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+	"net/url"
+	"strings"
+	"sync"
 )
 
-func NewAWS(region string) (aws.Config, error) {
-	if region == "" {
-		cfg, err := config.LoadDefaultConfig(context.TODO(), func(lo *config.LoadOptions) error {
-			return nil
-		})
+// AssumeRoleSessionName is the session name of the assumed roles, so the rotations can be
+// tracked in the CloudTrail logs of the target accounts.
+const AssumeRoleSessionName = "secrets-manager-rotator"
 
-		if err != nil {
-			return aws.Config{}, err
-		}
+// assumedRoles caches the credentials of each assumed role, so warm invocations of the lambda
+// reuse them until they expire instead of calling STS every time.
+var assumedRoles = struct {
+	sync.Mutex
+	credentials map[string]*aws.CredentialsCache
+}{credentials: map[string]*aws.CredentialsCache{}}
+
+// Options customises the AWS configuration: to point the rotator to a local emulator (e.g.:
+// LocalStack or moto) instead of a real account, or to assume a role in another account.
+type Options struct {
+	// SecretsManagerEndpoint is the base URL of the Secrets Manager API (e.g.:
+	// http://localhost:4566). If it's empty, the default endpoint of the region is used.
+	SecretsManagerEndpoint string
+	// AccessKeyID, SecretAccessKey and SessionToken are static credentials. If they're empty,
+	// the default credential chain is used.
+	AccessKeyID     string
+	SecretAccessKey string
+	SessionToken    string
+	// RoleARN is a role to assume (e.g.: to rotate secrets of another account), using the
+	// credentials resolved from the other options. ExternalID is optional.
+	RoleARN    string
+	ExternalID string
+}
+
+type Option func(*Options)
+
+func WithSecretsManagerEndpoint(endpoint string) Option {
+	return func(o *Options) {
+		o.SecretsManagerEndpoint = endpoint
+	}
+}
 
-		return cfg, nil
+func WithStaticCredentials(accessKeyID, secretAccessKey, sessionToken string) Option {
+	return func(o *Options) {
+		o.AccessKeyID = accessKeyID
+		o.SecretAccessKey = secretAccessKey
+		o.SessionToken = sessionToken
 	}
+}
 
-	cfg, err := config.LoadDefaultConfig(context.TODO(), func(lo *config.LoadOptions) error {
-		lo.DefaultRegion = region
-		return nil
-	})
+func WithAssumeRole(roleARN, externalID string) Option {
+	return func(o *Options) {
+		o.RoleARN = roleARN
+		o.ExternalID = externalID
+	}
+}
 
+func NewAWS(ctx context.Context, region string, opts ...Option) (aws.Config, error) {
+	var options Options
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	loadOptions, err := options.loadOptions()
 	if err != nil {
 		return aws.Config{}, err
 	}
 
+	if region != "" {
+		loadOptions = append(loadOptions, config.WithRegion(region))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOptions...)
+	if err != nil {
+		return aws.Config{}, err
+	}
+
+	if options.RoleARN != "" {
+		cfg.Credentials = assumeRoleCredentials(cfg, options)
+	}
+
 	return cfg, nil
 }
+
+// assumeRoleCredentials returns the cached credentials of the role, creating them (assuming it
+// with the credentials of cfg) the first time the role is requested. They're cached per region
+// and base credentials too, so a role assumed with other credentials is assumed again. The
+// default credential chain (an empty access key id) resolves to the same credentials for the
+// whole life of the process, e.g.: the execution role of the lambda.
+func assumeRoleCredentials(cfg aws.Config, options Options) *aws.CredentialsCache {
+	assumedRoles.Lock()
+	defer assumedRoles.Unlock()
+
+	roleARN, externalID := options.RoleARN, options.ExternalID
+	key := strings.Join([]string{cfg.Region, options.AccessKeyID, options.SessionToken, roleARN, externalID}, "|")
+	if cached, ok := assumedRoles.credentials[key]; ok {
+		return cached
+	}
+
+	provider := stscreds.NewAssumeRoleProvider(sts.NewFromConfig(cfg), roleARN,
+		func(o *stscreds.AssumeRoleOptions) {
+			o.RoleSessionName = AssumeRoleSessionName
+			if externalID != "" {
+				o.ExternalID = aws.String(externalID)
+			}
+		})
+
+	cached := aws.NewCredentialsCache(provider)
+	assumedRoles.credentials[key] = cached
+
+	return cached
+}
+
+func (o Options) loadOptions() ([]func(*config.LoadOptions) error, error) {
+	var loadOptions []func(*config.LoadOptions) error
+
+	if o.SecretsManagerEndpoint != "" {
+		endpoint, err := url.Parse(o.SecretsManagerEndpoint)
+		if err != nil || endpoint.Scheme == "" || endpoint.Host == "" {
+			return nil, fmt.Errorf("invalid secrets manager endpoint %q, it must be an absolute URL",
+				o.SecretsManagerEndpoint)
+		}
+
+		loadOptions = append(loadOptions, config.WithEndpointResolverWithOptions(
+			secretsManagerEndpointResolver(o.SecretsManagerEndpoint)))
+	}
+
+	if o.AccessKeyID != "" || o.SecretAccessKey != "" {
+		if o.AccessKeyID == "" || o.SecretAccessKey == "" {
+			return nil, fmt.Errorf("static credentials require both an access key id and a secret" +
+				" access key")
+		}
+
+		loadOptions = append(loadOptions, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(o.AccessKeyID, o.SecretAccessKey, o.SessionToken)))
+	}
+
+	return loadOptions, nil
+}
+
+// secretsManagerEndpointResolver resolves Secrets Manager to the given endpoint. Any other
+// service falls back to its default endpoint.
+func secretsManagerEndpointResolver(endpoint string) aws.EndpointResolverWithOptions {
+	return aws.EndpointResolverWithOptionsFunc(func(service, region string,
+		options ...interface{}) (aws.Endpoint, error) {
+		if service != secretsmanager.ServiceID {
+			return aws.Endpoint{}, &aws.EndpointNotFoundError{}
+		}
+
+		return aws.Endpoint{
+			URL:               endpoint,
+			SigningRegion:     region,
+			HostnameImmutable: true,
+		}, nil
+	})
+}
@@ -0,0 +1,69 @@
+package adapter
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestNewAWSWithEmulatorOptions(t *testing.T) {
+	ctx := context.Background()
+
+	cfg, err := NewAWS(ctx, "us-east-1", WithSecretsManagerEndpoint("http://localhost:4566"),
+		WithStaticCredentials("test", "test", ""))
+	assert.NoError(t, err)
+
+	endpoint, err := cfg.EndpointResolverWithOptions.ResolveEndpoint(secretsmanager.ServiceID, cfg.Region)
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:4566", endpoint.URL)
+
+	_, err = cfg.EndpointResolverWithOptions.ResolveEndpoint("STS", cfg.Region)
+	var notFound *aws.EndpointNotFoundError
+	assert.ErrorAs(t, err, &notFound, "other services should use their default endpoint")
+
+	creds, err := cfg.Credentials.Retrieve(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, "test", creds.AccessKeyID)
+	assert.Equal(t, "test", creds.SecretAccessKey)
+}
+
+func TestNewAWSInvalidOptions(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := NewAWS(ctx, "us-east-1", WithSecretsManagerEndpoint("localhost:4566"))
+	assert.Error(t, err, "the endpoint must be an absolute URL")
+
+	_, err = NewAWS(ctx, "us-east-1", WithStaticCredentials("test", "", ""))
+	assert.Error(t, err, "static credentials require a secret access key")
+}
+
+func TestNewAWSAssumeRoleCachesCredentials(t *testing.T) {
+	ctx := context.Background()
+	opts := []Option{WithStaticCredentials("test", "test", ""),
+		WithAssumeRole("arn:aws:iam::111111111111:role/rotator", "")}
+
+	first, err := NewAWS(ctx, "us-east-1", opts...)
+	assert.NoError(t, err)
+
+	second, err := NewAWS(ctx, "us-east-1", opts...)
+	assert.NoError(t, err)
+
+	assert.Same(t, first.Credentials, second.Credentials, "the credentials of a role should be reused")
+
+	other, err := NewAWS(ctx, "us-east-1", WithStaticCredentials("test", "test", ""),
+		WithAssumeRole("arn:aws:iam::222222222222:role/rotator", ""))
+	assert.NoError(t, err)
+	assert.NotSame(t, first.Credentials, other.Credentials)
+
+	otherRegion, err := NewAWS(ctx, "eu-west-1", opts...)
+	assert.NoError(t, err)
+	assert.NotSame(t, first.Credentials, otherRegion.Credentials, "the region should be part of the cache key")
+
+	otherCredentials, err := NewAWS(ctx, "us-east-1", WithStaticCredentials("other", "other", ""),
+		WithAssumeRole("arn:aws:iam::111111111111:role/rotator", ""))
+	assert.NoError(t, err)
+	assert.NotSame(t, first.Credentials, otherCredentials.Credentials,
+		"the base credentials should be part of the cache key")
+}
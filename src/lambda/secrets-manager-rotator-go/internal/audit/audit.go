@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"time"
+)
+
+// Record is the audit record of a rotation step, or of a rollback. It never includes any secret
+// value, only its salted fingerprint.
+type Record struct {
+	SecretArn string    `json:"secret_arn"`
+	Timestamp time.Time `json:"timestamp"`
+	Step      string    `json:"step"`
+	Outcome   string    `json:"outcome"`
+	// ErrorClass is the class of the error (see erroer.Class), if the step failed.
+	ErrorClass string `json:"error_class,omitempty"`
+	// PendingVersionID is the version being rotated in (the ClientRequestToken), or rolled back
+	// to, and CurrentVersionID the AWSCURRENT version when the step started.
+	PendingVersionID string `json:"pending_version_id"`
+	CurrentVersionID string `json:"current_version_id,omitempty"`
+	// RequestID and FunctionArn identify the lambda invocation that ran the step.
+	RequestID   string `json:"request_id,omitempty"`
+	FunctionArn string `json:"function_arn,omitempty"`
+	// Fingerprint is the salted fingerprint of the AWSPENDING value (see Fingerprint).
+	Fingerprint string `json:"fingerprint,omitempty"`
+	// Reason is why the rollback was requested, if the record is of a rollback.
+	Reason string `json:"reason,omitempty"`
+}
+
+// Sink stores the audit records, and returns the records of a secret sorted by timestamp.
+type Sink interface {
+	Write(ctx context.Context, record Record) error
+	Query(ctx context.Context, secretArn string) ([]Record, error)
+}
+
+// Fingerprint returns the HMAC-SHA256 of the value, keyed with the salt and hex encoded. It
+// allows checking whether two records refer to the same value, without storing it.
+func Fingerprint(salt, value string) string {
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// MultiSink writes every record to all its sinks, and queries the first one.
+type MultiSink []Sink
+
+func (m MultiSink) Write(ctx context.Context, record Record) error {
+	var errs []error
+	for _, sink := range m {
+		if err := sink.Write(ctx, record); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+func (m MultiSink) Query(ctx context.Context, secretArn string) ([]Record, error) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+
+	return m[0].Query(ctx, secretArn)
+}
+
+func sortByTimestamp(records []Record) {
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].Timestamp.Before(records[j].Timestamp)
+	})
+}
@@ -0,0 +1,132 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	dynamodbtypes "github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+const (
+	testSecretArn  = "arn:aws:secretsmanager:us-east-1:123456789012:secret:/dev/app/db-AbCdEf"
+	otherSecretArn = "arn:aws:secretsmanager:us-east-1:123456789012:secret:/dev/app/other-AbCdEf"
+)
+
+type fakeS3 struct {
+	objects map[string][]byte
+}
+
+func (f *fakeS3) PutObject(ctx context.Context, params *s3.PutObjectInput,
+	optFns ...func(*s3.Options)) (*s3.PutObjectOutput, error) {
+	body, _ := io.ReadAll(params.Body)
+	f.objects[aws.ToString(params.Key)] = body
+	return &s3.PutObjectOutput{}, nil
+}
+
+func (f *fakeS3) GetObject(ctx context.Context, params *s3.GetObjectInput,
+	optFns ...func(*s3.Options)) (*s3.GetObjectOutput, error) {
+	return &s3.GetObjectOutput{Body: io.NopCloser(bytes.NewReader(f.objects[aws.ToString(params.Key)]))}, nil
+}
+
+func (f *fakeS3) ListObjectsV2(ctx context.Context, params *s3.ListObjectsV2Input,
+	optFns ...func(*s3.Options)) (*s3.ListObjectsV2Output, error) {
+	var keys []string
+	for key := range f.objects {
+		if strings.HasPrefix(key, aws.ToString(params.Prefix)) {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	output := &s3.ListObjectsV2Output{}
+	for _, key := range keys {
+		output.Contents = append(output.Contents, s3types.Object{Key: aws.String(key)})
+	}
+
+	return output, nil
+}
+
+type fakeDynamoDB struct {
+	items []map[string]dynamodbtypes.AttributeValue
+}
+
+func (f *fakeDynamoDB) PutItem(ctx context.Context, params *dynamodb.PutItemInput,
+	optFns ...func(*dynamodb.Options)) (*dynamodb.PutItemOutput, error) {
+	f.items = append(f.items, params.Item)
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (f *fakeDynamoDB) Query(ctx context.Context, params *dynamodb.QueryInput,
+	optFns ...func(*dynamodb.Options)) (*dynamodb.QueryOutput, error) {
+	arn := params.ExpressionAttributeValues[":arn"].(*dynamodbtypes.AttributeValueMemberS).Value
+
+	output := &dynamodb.QueryOutput{}
+	for _, item := range f.items {
+		if item[DynamoDBPartitionKey].(*dynamodbtypes.AttributeValueMemberS).Value == arn {
+			output.Items = append(output.Items, item)
+		}
+	}
+
+	return output, nil
+}
+
+func TestSinks(t *testing.T) {
+	ctx := context.Background()
+	started := time.Date(2023, 5, 1, 10, 0, 0, 0, time.UTC)
+
+	sinks := map[string]Sink{
+		"File":     NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl")),
+		"S3":       &S3Sink{Client: &fakeS3{objects: map[string][]byte{}}, Bucket: "audit", Prefix: "rotations/"},
+		"DynamoDB": &DynamoDBSink{Client: &fakeDynamoDB{}, Table: "audit"},
+	}
+
+	for name, sink := range sinks {
+		t.Run(name, func(t *testing.T) {
+			for i, step := range []string{"createSecret", "setSecret"} {
+				assert.NoError(t, sink.Write(ctx, Record{
+					SecretArn:        testSecretArn,
+					Timestamp:        started.Add(time.Duration(i) * time.Second),
+					Step:             step,
+					Outcome:          "succeeded",
+					PendingVersionID: "token",
+					RequestID:        "request",
+					Fingerprint:      Fingerprint("salt", "new-value"),
+				}))
+			}
+
+			assert.NoError(t, sink.Write(ctx, Record{SecretArn: otherSecretArn, Timestamp: started,
+				Step: "createSecret", Outcome: "failed", ErrorClass: "rotation"}))
+
+			records, err := sink.Query(ctx, testSecretArn)
+			assert.NoError(t, err)
+
+			if assert.Len(t, records, 2) {
+				assert.Equal(t, "createSecret", records[0].Step)
+				assert.Equal(t, "setSecret", records[1].Step)
+				assert.True(t, started.Equal(records[0].Timestamp))
+				assert.Equal(t, "request", records[1].RequestID)
+				assert.Equal(t, Fingerprint("salt", "new-value"), records[1].Fingerprint)
+			}
+		})
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fingerprint := Fingerprint("salt", "new-value")
+
+	assert.NotContains(t, fingerprint, "new-value")
+	assert.Equal(t, fingerprint, Fingerprint("salt", "new-value"))
+	assert.NotEqual(t, fingerprint, Fingerprint("other-salt", "new-value"))
+	assert.NotEqual(t, fingerprint, Fingerprint("salt", "other-value"))
+}
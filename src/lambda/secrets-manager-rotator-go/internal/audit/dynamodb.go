@@ -0,0 +1,136 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// sortableTimestamp is a fixed width timestamp format, so the timestamps sort as strings.
+const sortableTimestamp = "2006-01-02T15:04:05.000000000Z07:00"
+
+const (
+	DynamoDBPartitionKey = "secret_arn"
+	DynamoDBSortKey      = "timestamp"
+)
+
+type DynamoDBAPI interface {
+	dynamodb.QueryAPIClient
+	PutItem(ctx context.Context, params *dynamodb.PutItemInput, optFns ...func(*dynamodb.Options)) (
+		*dynamodb.PutItemOutput, error)
+}
+
+// DynamoDBSink writes the records to a table whose partition key is DynamoDBPartitionKey and
+// sort key DynamoDBSortKey (both strings). Every field of the record is a string attribute.
+type DynamoDBSink struct {
+	Client DynamoDBAPI
+	Table  string
+}
+
+func (d *DynamoDBSink) Write(ctx context.Context, record Record) error {
+	fields, err := recordFields(record)
+	if err != nil {
+		return err
+	}
+
+	item := map[string]types.AttributeValue{}
+	for name, value := range fields {
+		item[name] = &types.AttributeValueMemberS{Value: value}
+	}
+
+	item[DynamoDBSortKey] = &types.AttributeValueMemberS{
+		Value: record.Timestamp.UTC().Format(sortableTimestamp),
+	}
+
+	_, err = d.Client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName: aws.String(d.Table),
+		Item:      item,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write the audit record to table %s: %w", d.Table, err)
+	}
+
+	return nil
+}
+
+func (d *DynamoDBSink) Query(ctx context.Context, secretArn string) ([]Record, error) {
+	var records []Record
+
+	paginator := dynamodb.NewQueryPaginator(d.Client, &dynamodb.QueryInput{
+		TableName:              aws.String(d.Table),
+		KeyConditionExpression: aws.String("#arn = :arn"),
+		ExpressionAttributeNames: map[string]string{
+			"#arn": DynamoDBPartitionKey,
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":arn": &types.AttributeValueMemberS{Value: secretArn},
+		},
+		ScanIndexForward: aws.Bool(true),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to query the audit records in table %s: %w", d.Table, err)
+		}
+
+		for _, item := range page.Items {
+			fields := map[string]string{}
+			for name, value := range item {
+				if s, ok := value.(*types.AttributeValueMemberS); ok {
+					fields[name] = s.Value
+				}
+			}
+
+			record, err := fieldsRecord(fields)
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, record)
+		}
+	}
+
+	return records, nil
+}
+
+// recordFields and fieldsRecord convert a record to and from its (JSON) fields, which are all
+// strings.
+func recordFields(record Record) (map[string]string, error) {
+	encoded, err := json.Marshal(record)
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode the audit record: %w", err)
+	}
+
+	fields := map[string]string{}
+	if err := json.Unmarshal(encoded, &fields); err != nil {
+		return nil, fmt.Errorf("unable to encode the audit record: %w", err)
+	}
+
+	return fields, nil
+}
+
+func fieldsRecord(fields map[string]string) (Record, error) {
+	var record Record
+
+	encoded, err := json.Marshal(fields)
+	if err != nil {
+		return record, fmt.Errorf("unable to decode the audit record: %w", err)
+	}
+
+	if err := json.Unmarshal(encoded, &record); err != nil {
+		return record, fmt.Errorf("unable to decode the audit record: %w", err)
+	}
+
+	return record, nil
+}
+
+func NewDynamoDBSink(cfg aws.Config, table string) Sink {
+	return &DynamoDBSink{
+		Client: dynamodb.NewFromConfig(cfg),
+		Table:  table,
+	}
+}
@@ -0,0 +1,91 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// FileSink appends the records, as JSON lines, to a local file.
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (f *FileSink) Write(ctx context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("unable to encode the audit record: %w", err)
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("unable to open the audit file %s: %w", f.Path, err)
+	}
+
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		_ = file.Close()
+		return fmt.Errorf("unable to write the audit file %s: %w", f.Path, err)
+	}
+
+	return file.Close()
+}
+
+func (f *FileSink) Query(ctx context.Context, secretArn string) ([]Record, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.Open(f.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to open the audit file %s: %w", f.Path, err)
+	}
+
+	defer file.Close()
+
+	records, err := readRecords(file, secretArn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the audit file %s: %w", f.Path, err)
+	}
+
+	sortByTimestamp(records)
+	return records, nil
+}
+
+// readRecords reads the JSON lines records of the given secret.
+func readRecords(file io.Reader, secretArn string) ([]Record, error) {
+	var records []Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var record Record
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			return nil, err
+		}
+
+		if record.SecretArn == secretArn {
+			records = append(records, record)
+		}
+	}
+
+	return records, scanner.Err()
+}
+
+func NewFileSink(path string) Sink {
+	return &FileSink{Path: path}
+}
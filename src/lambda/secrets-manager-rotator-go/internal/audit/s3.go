@@ -0,0 +1,115 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"net/url"
+	"strings"
+)
+
+type S3API interface {
+	s3.ListObjectsV2APIClient
+	PutObject(ctx context.Context, params *s3.PutObjectInput, optFns ...func(*s3.Options)) (*s3.PutObjectOutput,
+		error)
+	GetObject(ctx context.Context, params *s3.GetObjectInput, optFns ...func(*s3.Options)) (*s3.GetObjectOutput,
+		error)
+}
+
+// S3Sink writes each record as a JSON lines object, under a prefix per secret
+// (<prefix>/<escaped secret arn>/<timestamp>-<step>.jsonl), so the records of a secret can be
+// listed by prefix.
+type S3Sink struct {
+	Client S3API
+	Bucket string
+	Prefix string
+}
+
+func (s *S3Sink) Write(ctx context.Context, record Record) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("unable to encode the audit record: %w", err)
+	}
+
+	key := fmt.Sprintf("%s%s-%s.jsonl", s.secretPrefix(record.SecretArn),
+		record.Timestamp.UTC().Format(sortableTimestamp), record.Step)
+
+	_, err = s.Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(s.Bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(append(line, '\n')),
+		ContentType: aws.String("application/x-ndjson"),
+	})
+	if err != nil {
+		return fmt.Errorf("unable to write the audit record to bucket %s: %w", s.Bucket, err)
+	}
+
+	return nil
+}
+
+func (s *S3Sink) Query(ctx context.Context, secretArn string) ([]Record, error) {
+	var records []Record
+
+	paginator := s3.NewListObjectsV2Paginator(s.Client, &s3.ListObjectsV2Input{
+		Bucket: aws.String(s.Bucket),
+		Prefix: aws.String(s.secretPrefix(secretArn)),
+	})
+
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("unable to list the audit records in bucket %s: %w", s.Bucket, err)
+		}
+
+		for _, object := range page.Contents {
+			objectRecords, err := s.read(ctx, aws.ToString(object.Key), secretArn)
+			if err != nil {
+				return nil, err
+			}
+
+			records = append(records, objectRecords...)
+		}
+	}
+
+	sortByTimestamp(records)
+	return records, nil
+}
+
+func (s *S3Sink) read(ctx context.Context, key, secretArn string) ([]Record, error) {
+	object, err := s.Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the audit record %s: %w", key, err)
+	}
+
+	defer object.Body.Close()
+
+	records, err := readRecords(object.Body, secretArn)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode the audit record %s: %w", key, err)
+	}
+
+	return records, nil
+}
+
+func (s *S3Sink) secretPrefix(secretArn string) string {
+	prefix := strings.Trim(s.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return prefix + url.PathEscape(secretArn) + "/"
+}
+
+func NewS3Sink(cfg aws.Config, bucket, prefix string) Sink {
+	return &S3Sink{
+		Client: s3.NewFromConfig(cfg),
+		Bucket: bucket,
+		Prefix: prefix,
+	}
+}
@@ -0,0 +1,96 @@
+package client
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"sort"
+	"strings"
+)
+
+// ListFilter selects the secrets returned by ListAll. The zero value selects every secret.
+type ListFilter struct {
+	// NamePrefix selects the secrets whose name starts with it.
+	NamePrefix string
+	// Tags selects the secrets that have every tag, with the same value. An empty value only
+	// requires the tag key.
+	Tags map[string]string
+}
+
+// listSecretsFilters returns the ListSecrets filters that narrow the listing down server-side.
+// Secrets Manager matches tag keys and values independently, and names case-insensitively, so
+// the listed secrets must still be checked with Matches.
+func (f ListFilter) listSecretsFilters() []types.Filter {
+	var filters []types.Filter
+	if f.NamePrefix != "" {
+		filters = append(filters, types.Filter{
+			Key:    types.FilterNameStringTypeName,
+			Values: []string{f.NamePrefix},
+		})
+	}
+
+	var keys []string
+	for key := range f.Tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		filters = append(filters, types.Filter{
+			Key:    types.FilterNameStringTypeTagKey,
+			Values: []string{key},
+		})
+
+		if value := f.Tags[key]; value != "" {
+			filters = append(filters, types.Filter{
+				Key:    types.FilterNameStringTypeTagValue,
+				Values: []string{value},
+			})
+		}
+	}
+
+	return filters
+}
+
+// Matches reports whether the secret is selected by the filter.
+func (f ListFilter) Matches(secret *secretsmanager.DescribeSecretOutput) bool {
+	if !strings.HasPrefix(aws.ToString(secret.Name), f.NamePrefix) {
+		return false
+	}
+
+	tags := map[string]string{}
+	for _, tag := range secret.Tags {
+		tags[aws.ToString(tag.Key)] = aws.ToString(tag.Value)
+	}
+
+	for key, value := range f.Tags {
+		actual, ok := tags[key]
+		if !ok || (value != "" && actual != value) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// ParseTags parses a comma separated list of key=value tags. A key without a value (or with an
+// empty one) only requires the tag to be set.
+func ParseTags(tags string) (map[string]string, error) {
+	if strings.TrimSpace(tags) == "" {
+		return nil, nil
+	}
+
+	parsed := map[string]string{}
+	for _, pair := range strings.Split(tags, ",") {
+		key, value, _ := strings.Cut(pair, "=")
+		key = strings.TrimSpace(key)
+		if key == "" {
+			return nil, fmt.Errorf("tag %q has no key", strings.TrimSpace(pair))
+		}
+
+		parsed[key] = strings.TrimSpace(value)
+	}
+
+	return parsed, nil
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestListFilterMatches(t *testing.T) {
+	secret := &secretsmanager.DescribeSecretOutput{
+		Name: aws.String("prod/db"),
+		Tags: []types.Tag{
+			{Key: aws.String("team"), Value: aws.String("payments")},
+			{Key: aws.String("rotation"), Value: aws.String("")},
+		},
+	}
+
+	assert.True(t, ListFilter{}.Matches(secret))
+	assert.True(t, ListFilter{NamePrefix: "prod/"}.Matches(secret))
+	assert.False(t, ListFilter{NamePrefix: "PROD/"}.Matches(secret))
+	assert.True(t, ListFilter{Tags: map[string]string{"team": "payments", "rotation": ""}}.Matches(secret))
+	assert.False(t, ListFilter{Tags: map[string]string{"team": "platform"}}.Matches(secret))
+	assert.False(t, ListFilter{Tags: map[string]string{"owner": ""}}.Matches(secret))
+}
+
+func TestListSecretsFilters(t *testing.T) {
+	assert.Empty(t, ListFilter{}.listSecretsFilters())
+
+	filter := ListFilter{NamePrefix: "prod/", Tags: map[string]string{"team": "payments", "env": ""}}
+	assert.Equal(t, []types.Filter{
+		{Key: types.FilterNameStringTypeName, Values: []string{"prod/"}},
+		{Key: types.FilterNameStringTypeTagKey, Values: []string{"env"}},
+		{Key: types.FilterNameStringTypeTagKey, Values: []string{"team"}},
+		{Key: types.FilterNameStringTypeTagValue, Values: []string{"payments"}},
+	}, filter.listSecretsFilters())
+}
+
+func TestParseTags(t *testing.T) {
+	tags, err := ParseTags("")
+	assert.NoError(t, err)
+	assert.Nil(t, tags)
+
+	tags, err = ParseTags(" team = payments, env ")
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"team": "payments", "env": ""}, tags)
+
+	_, err = ParseTags("team=payments,=orphan")
+	assert.Error(t, err)
+}
+
+func TestInMemoryListAllFilter(t *testing.T) {
+	backend := NewInMemorySecretsManager(zap.NewNop())
+	for _, input := range []InMemorySecretInput{
+		{ARN: "arn:a", Name: "prod/a", Tags: map[string]string{"team": "payments"}},
+		{ARN: "arn:b", Name: "prod/b", Tags: map[string]string{"team": "platform"}},
+		{ARN: "arn:c", Name: "dev/c", Tags: map[string]string{"team": "payments"}},
+	} {
+		_, err := backend.CreateSecret(input)
+		assert.NoError(t, err)
+	}
+
+	secrets, err := backend.ListAll(context.Background(), ListFilter{})
+	assert.NoError(t, err)
+	assert.Len(t, secrets, 3)
+
+	secrets, err = backend.ListAll(context.Background(),
+		ListFilter{NamePrefix: "prod/", Tags: map[string]string{"team": "payments"}})
+	assert.NoError(t, err)
+	if assert.Len(t, secrets, 1) {
+		assert.Equal(t, "arn:a", aws.ToString(secrets[0].ARN))
+	}
+}
@@ -0,0 +1,491 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"go.uber.org/zap"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	inMemoryAccountID = "123456789012"
+	inMemoryRegion    = "us-east-1"
+
+	stageCurrent  = "AWSCURRENT"
+	stagePending  = "AWSPENDING"
+	stagePrevious = "AWSPREVIOUS"
+)
+
+// InMemorySecretsManager is an in-memory implementation of SecretsManager. It models the
+// secret versions, their ClientRequestTokens and the staging labels the same way Secrets
+// Manager does, so full rotations can run offline (tests, local simulations, CI).
+type InMemorySecretsManager struct {
+	Logger *zap.Logger
+
+	mu      sync.Mutex
+	secrets map[string]*inMemorySecret
+	errors  map[string]error
+	// Now returns the current time. It can be replaced to control the dates of the secrets.
+	Now func() time.Time
+}
+
+type InMemorySecretInput struct {
+	// ARN of the secret. If it's not set, one is built from the name.
+	ARN               string
+	Name              string
+	Description       string
+	Value             string
+	RotationEnabled   bool
+	RotationLambdaARN string
+	RotationRules     *types.RotationRulesType
+	Tags              map[string]string
+	// Replicas is the replication status of the secret. Replicas aren't modelled, the status is
+	// only reported.
+	Replicas []types.ReplicationStatusType
+}
+
+type inMemorySecret struct {
+	input           InMemorySecretInput
+	createdDate     time.Time
+	lastChangedDate time.Time
+	lastRotatedDate *time.Time
+	versions        map[string]*inMemoryVersion
+}
+
+type inMemoryVersion struct {
+	// value is nil while the version is just a placeholder, created when a rotation starts.
+	value  *string
+	stages []string
+}
+
+// CreateSecret creates a secret, with its initial value as the AWSCURRENT version. It
+// returns the ARN of the secret.
+func (m *InMemorySecretsManager) CreateSecret(input InMemorySecretInput) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if input.Name == "" {
+		return "", &types.InvalidParameterException{Message: aws.String("secret name is required")}
+	}
+
+	if input.ARN == "" {
+		input.ARN = fmt.Sprintf("arn:aws:secretsmanager:%s:%s:secret:%s-%s", inMemoryRegion,
+			inMemoryAccountID, input.Name, m.randomSuffix())
+	}
+
+	if _, ok := m.secrets[input.ARN]; ok {
+		return "", &types.ResourceExistsException{Message: aws.String(fmt.Sprintf(
+			"secret %s already exists", input.ARN))}
+	}
+
+	now := m.Now()
+	value := input.Value
+	m.secrets[input.ARN] = &inMemorySecret{
+		input:           input,
+		createdDate:     now,
+		lastChangedDate: now,
+		versions: map[string]*inMemoryVersion{
+			m.newToken(): {value: &value, stages: []string{stageCurrent}},
+		},
+	}
+
+	return input.ARN, nil
+}
+
+// StartRotation does what Secrets Manager does when a rotation starts: it creates a
+// placeholder version (with no value) labelled as AWSPENDING. If the token is empty, a new
+// one is generated. It returns the token, to be used as the ClientRequestToken of each step.
+func (m *InMemorySecretsManager) StartRotation(arn, token string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	secret, err := m.find(arn)
+	if err != nil {
+		return "", err
+	}
+
+	if token == "" {
+		token = m.newToken()
+	}
+
+	if _, ok := secret.versions[token]; !ok {
+		secret.versions[token] = &inMemoryVersion{}
+	}
+
+	secret.moveStage(stagePending, token)
+	return token, nil
+}
+
+// InjectError makes every call to the given operation (the name of the SecretsManager method,
+// e.g.: PutSecretValue) fail with the given error, until ClearErrors is called.
+func (m *InMemorySecretsManager) InjectError(operation string, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.errors[operation] = err
+}
+
+func (m *InMemorySecretsManager) ClearErrors() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.errors = map[string]error{}
+}
+
+func (m *InMemorySecretsManager) ListAll(ctx context.Context,
+	filter ListFilter) ([]*secretsmanager.DescribeSecretOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.before(ctx, "ListAll"); err != nil {
+		return nil, err
+	}
+
+	var arns []string
+	for arn := range m.secrets {
+		arns = append(arns, arn)
+	}
+
+	sort.Strings(arns)
+
+	var allSecrets []*secretsmanager.DescribeSecretOutput
+	for _, arn := range arns {
+		if secret := m.secrets[arn].describe(); filter.Matches(secret) {
+			allSecrets = append(allSecrets, secret)
+		}
+	}
+
+	return allSecrets, nil
+}
+
+func (m *InMemorySecretsManager) GetSecret(ctx context.Context,
+	arn string) (*secretsmanager.DescribeSecretOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.before(ctx, "GetSecret"); err != nil {
+		return nil, err
+	}
+
+	secret, err := m.find(arn)
+	if err != nil {
+		return nil, fmt.Errorf("error describing secret: %w", err)
+	}
+
+	return secret.describe(), nil
+}
+
+func (m *InMemorySecretsManager) GetSecretValue(ctx context.Context, arn, token,
+	stage string) (*secretsmanager.GetSecretValueOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.before(ctx, "GetSecretValue"); err != nil {
+		return nil, err
+	}
+
+	return m.getValue(arn, token, stage)
+}
+
+func (m *InMemorySecretsManager) GetSecretValueByStageLabel(ctx context.Context, arn, token,
+	stageLabel string) (*secretsmanager.GetSecretValueOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.before(ctx, "GetSecretValueByStageLabel"); err != nil {
+		return nil, err
+	}
+
+	return m.getValue(arn, token, stageLabel)
+}
+
+// PutSecretValue follows the Secrets Manager idempotency rules: putting the same value again
+// with the same token is a no-op, while putting a different one fails.
+func (m *InMemorySecretsManager) PutSecretValue(ctx context.Context, arn, token, value,
+	stage string) (*secretsmanager.PutSecretValueOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.before(ctx, "PutSecretValue"); err != nil {
+		return nil, err
+	}
+
+	secret, err := m.find(arn)
+	if err != nil {
+		return nil, fmt.Errorf("error putting secret value: %w", err)
+	}
+
+	output := &secretsmanager.PutSecretValueOutput{
+		ARN:       aws.String(secret.input.ARN),
+		Name:      aws.String(secret.input.Name),
+		VersionId: aws.String(token),
+	}
+
+	version, ok := secret.versions[token]
+	if ok && version.value != nil {
+		if *version.value != value {
+			return nil, fmt.Errorf("error putting secret value: %w", &types.ResourceExistsException{
+				Message: aws.String(fmt.Sprintf("a version with token %s already exists with a"+
+					" different value", token)),
+			})
+		}
+
+		output.VersionStages = append([]string(nil), version.stages...)
+		return output, nil
+	}
+
+	if !ok {
+		version = &inMemoryVersion{}
+		secret.versions[token] = version
+	}
+
+	version.value = &value
+	secret.moveStage(stage, token)
+	secret.lastChangedDate = m.Now()
+
+	output.VersionStages = append([]string(nil), version.stages...)
+	return output, nil
+}
+
+func (m *InMemorySecretsManager) GenerateRandomPassword(ctx context.Context, length int64,
+	excludeChars string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.before(ctx, "GenerateRandomPassword"); err != nil {
+		return "", err
+	}
+
+	policy := generator.DefaultPolicy()
+	policy.Length = int(length)
+	policy.ExcludeCharacters = excludeChars
+
+	return generator.NewGenerator().Generate(ctx, policy)
+}
+
+// UpdateSecretVersion follows the Secrets Manager rules: if the stage is attached to another
+// version, it must be the one to remove it from. Moving AWSCURRENT moves AWSPREVIOUS to the
+// version that was AWSCURRENT.
+func (m *InMemorySecretsManager) UpdateSecretVersion(ctx context.Context, arn, token, stage,
+	currentVersion string) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.before(ctx, "UpdateSecretVersion"); err != nil {
+		return nil, err
+	}
+
+	secret, err := m.find(arn)
+	if err != nil {
+		return nil, fmt.Errorf("error updating secret version stage: %w", err)
+	}
+
+	if _, ok := secret.versions[token]; !ok {
+		return nil, fmt.Errorf("error updating secret version stage: %w", &types.ResourceNotFoundException{
+			Message: aws.String(fmt.Sprintf("version %s does not exist", token)),
+		})
+	}
+
+	holder := secret.versionWithStage(stage)
+	if currentVersion != "" && currentVersion != holder {
+		return nil, fmt.Errorf("error updating secret version stage: %w", &types.InvalidParameterException{
+			Message: aws.String(fmt.Sprintf("stage %s is not attached to version %s", stage,
+				currentVersion)),
+		})
+	}
+
+	if holder != "" && holder != token && currentVersion == "" {
+		return nil, fmt.Errorf("error updating secret version stage: %w", &types.InvalidParameterException{
+			Message: aws.String(fmt.Sprintf("stage %s is attached to version %s, it must be"+
+				" removed from it", stage, holder)),
+		})
+	}
+
+	secret.moveStage(stage, token)
+	if stage == stageCurrent && holder != token {
+		now := m.Now()
+		secret.lastRotatedDate = &now
+		secret.lastChangedDate = now
+	}
+
+	return &secretsmanager.UpdateSecretVersionStageOutput{
+		ARN:  aws.String(secret.input.ARN),
+		Name: aws.String(secret.input.Name),
+	}, nil
+}
+
+func (m *InMemorySecretsManager) getValue(arn, token,
+	stage string) (*secretsmanager.GetSecretValueOutput, error) {
+	secret, err := m.find(arn)
+	if err != nil {
+		return nil, fmt.Errorf("error getting secret value: %w", err)
+	}
+
+	versionId := token
+	if versionId == "" {
+		versionId = secret.versionWithStage(stage)
+	}
+
+	version, ok := secret.versions[versionId]
+	if !ok || version.value == nil || (stage != "" && !hasStage(version.stages, stage)) {
+		return nil, fmt.Errorf("error getting secret value: %w", &types.ResourceNotFoundException{
+			Message: aws.String(fmt.Sprintf("can't find the secret value for version %s and"+
+				" staging label %s", token, stage)),
+		})
+	}
+
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:           aws.String(secret.input.ARN),
+		Name:          aws.String(secret.input.Name),
+		VersionId:     aws.String(versionId),
+		SecretString:  aws.String(*version.value),
+		VersionStages: append([]string(nil), version.stages...),
+	}, nil
+}
+
+// before runs the checks common to every operation: context cancellation, and injected errors.
+func (m *InMemorySecretsManager) before(ctx context.Context, operation string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	return m.errors[operation]
+}
+
+// find looks up a secret by ARN or by name.
+func (m *InMemorySecretsManager) find(secretId string) (*inMemorySecret, error) {
+	if secret, ok := m.secrets[secretId]; ok {
+		return secret, nil
+	}
+
+	for _, secret := range m.secrets {
+		if secret.input.Name == secretId {
+			return secret, nil
+		}
+	}
+
+	return nil, &types.ResourceNotFoundException{Message: aws.String(fmt.Sprintf(
+		"secret %s does not exist", secretId))}
+}
+
+func (m *InMemorySecretsManager) newToken() string {
+	token, err := generator.NewGenerator().Generate(context.Background(),
+		generator.Policy{Format: generator.FormatUUID})
+	if err != nil {
+		// Only possible if crypto/rand fails, which is not recoverable.
+		panic(err)
+	}
+
+	return token
+}
+
+func (m *InMemorySecretsManager) randomSuffix() string {
+	return strings.ReplaceAll(m.newToken(), "-", "")[:6]
+}
+
+func (s *inMemorySecret) describe() *secretsmanager.DescribeSecretOutput {
+	versions := map[string][]string{}
+	for id, version := range s.versions {
+		if len(version.stages) > 0 {
+			versions[id] = append([]string(nil), version.stages...)
+		}
+	}
+
+	var tags []types.Tag
+	for key, value := range s.input.Tags {
+		tags = append(tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	sort.Slice(tags, func(i, j int) bool {
+		return *tags[i].Key < *tags[j].Key
+	})
+
+	output := &secretsmanager.DescribeSecretOutput{
+		ARN:                aws.String(s.input.ARN),
+		Name:               aws.String(s.input.Name),
+		RotationEnabled:    aws.Bool(s.input.RotationEnabled),
+		RotationRules:      s.input.RotationRules,
+		ReplicationStatus:  s.input.Replicas,
+		Tags:               tags,
+		VersionIdsToStages: versions,
+		CreatedDate:        aws.Time(s.createdDate),
+		LastChangedDate:    aws.Time(s.lastChangedDate),
+		LastRotatedDate:    s.lastRotatedDate,
+	}
+
+	if s.input.Description != "" {
+		output.Description = aws.String(s.input.Description)
+	}
+
+	if s.input.RotationLambdaARN != "" {
+		output.RotationLambdaARN = aws.String(s.input.RotationLambdaARN)
+	}
+
+	return output
+}
+
+func (s *inMemorySecret) versionWithStage(stage string) string {
+	for id, version := range s.versions {
+		if hasStage(version.stages, stage) {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// moveStage attaches the stage to the given version, removing it from any other version.
+// Moving AWSCURRENT moves AWSPREVIOUS to the version that held AWSCURRENT.
+func (s *inMemorySecret) moveStage(stage, versionId string) {
+	holder := s.versionWithStage(stage)
+	if holder == versionId {
+		return
+	}
+
+	if holder != "" {
+		s.versions[holder].stages = withoutStage(s.versions[holder].stages, stage)
+	}
+
+	s.versions[versionId].stages = append(s.versions[versionId].stages, stage)
+
+	if stage == stageCurrent && holder != "" {
+		s.moveStage(stagePrevious, holder)
+	}
+}
+
+func hasStage(stages []string, stage string) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+
+	return false
+}
+
+func withoutStage(stages []string, stage string) []string {
+	var result []string
+	for _, s := range stages {
+		if s != stage {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+func NewInMemorySecretsManager(logger *zap.Logger) *InMemorySecretsManager {
+	return &InMemorySecretsManager{
+		Logger:  logger,
+		secrets: map[string]*inMemorySecret{},
+		errors:  map[string]error{},
+		Now:     time.Now,
+	}
+}
@@ -0,0 +1,97 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+)
+
+const (
+	testSecretArn = "arn:aws:secretsmanager:us-east-1:123456789012:secret:test-AbCdEf"
+	testToken     = "2d493794-4bf3-4aba-bae4-d372c431f75a"
+)
+
+func newTestBackend(t *testing.T) *InMemorySecretsManager {
+	backend := NewInMemorySecretsManager(zap.NewNop())
+	_, err := backend.CreateSecret(InMemorySecretInput{
+		ARN:             testSecretArn,
+		Name:            "test",
+		Value:           "current-value",
+		RotationEnabled: true,
+	})
+	assert.NoError(t, err)
+
+	_, err = backend.StartRotation(testSecretArn, testToken)
+	assert.NoError(t, err)
+
+	return backend
+}
+
+func TestInMemoryPutSecretValue(t *testing.T) {
+	ctx := context.Background()
+	backend := newTestBackend(t)
+
+	_, err := backend.GetSecretValue(ctx, testSecretArn, testToken, "AWSPENDING")
+	var notFound *types.ResourceNotFoundException
+	assert.ErrorAs(t, err, &notFound, "the placeholder version has no value yet")
+
+	_, err = backend.PutSecretValue(ctx, testSecretArn, testToken, "pending-value", "AWSPENDING")
+	assert.NoError(t, err)
+
+	_, err = backend.PutSecretValue(ctx, testSecretArn, testToken, "pending-value", "AWSPENDING")
+	assert.NoError(t, err, "putting the same value again is idempotent")
+
+	_, err = backend.PutSecretValue(ctx, testSecretArn, testToken, "other-value", "AWSPENDING")
+	var exists *types.ResourceExistsException
+	assert.ErrorAs(t, err, &exists)
+
+	pending, err := backend.GetSecretValue(ctx, testSecretArn, "", "AWSPENDING")
+	assert.NoError(t, err)
+	assert.Equal(t, "pending-value", aws.ToString(pending.SecretString))
+}
+
+func TestInMemoryUpdateSecretVersion(t *testing.T) {
+	ctx := context.Background()
+	backend := newTestBackend(t)
+
+	_, err := backend.PutSecretValue(ctx, testSecretArn, testToken, "pending-value", "AWSPENDING")
+	assert.NoError(t, err)
+
+	current, err := backend.GetSecretValue(ctx, testSecretArn, "", "AWSCURRENT")
+	assert.NoError(t, err)
+
+	_, err = backend.UpdateSecretVersion(ctx, testSecretArn, testToken, "AWSCURRENT", "")
+	var invalid *types.InvalidParameterException
+	assert.ErrorAs(t, err, &invalid, "AWSCURRENT must be removed from the version holding it")
+
+	_, err = backend.UpdateSecretVersion(ctx, testSecretArn, testToken, "AWSCURRENT", testToken)
+	assert.ErrorAs(t, err, &invalid, "AWSCURRENT is not attached to the given version")
+
+	_, err = backend.UpdateSecretVersion(ctx, testSecretArn, testToken, "AWSCURRENT",
+		aws.ToString(current.VersionId))
+	assert.NoError(t, err)
+
+	secret, err := backend.GetSecret(ctx, testSecretArn)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{"AWSPENDING", "AWSCURRENT"}, secret.VersionIdsToStages[testToken])
+	assert.Equal(t, []string{"AWSPREVIOUS"}, secret.VersionIdsToStages[aws.ToString(current.VersionId)])
+	assert.NotNil(t, secret.LastRotatedDate)
+}
+
+func TestInMemoryInjectError(t *testing.T) {
+	ctx := context.Background()
+	backend := newTestBackend(t)
+	throttled := errors.New("throttled")
+
+	backend.InjectError("GetSecret", throttled)
+	_, err := backend.GetSecret(ctx, testSecretArn)
+	assert.ErrorIs(t, err, throttled)
+
+	backend.ClearErrors()
+	_, err = backend.GetSecret(ctx, testSecretArn)
+	assert.NoError(t, err)
+}
@@ -2,45 +2,70 @@ package client
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/metrics"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/tracing"
 	"go.uber.org/zap"
+	"sync"
 	"time"
 )
 
+// DefaultTimeout is the timeout of each Secrets Manager API call, unless it's set through
+// SecretsManagerClient.Timeout.
+const DefaultTimeout = 30 * time.Second
+
+// DefaultDescribeConcurrency is how many secrets ListAll describes at once, unless it's
+// configured (see NewSecretsManager).
+const DefaultDescribeConcurrency = 10
+
+// listSecretsPageSize is the maximum page size of ListSecrets.
+const listSecretsPageSize = 100
+
 type SecretsManagerClient struct {
 	Client *secretsmanager.Client
 	Logger *zap.Logger
+	// Timeout of each API call. The deadline of the context passed to each call (e.g.: the
+	// Lambda deadline) is respected as well.
+	Timeout time.Duration
+	// DescribeConcurrency is how many secrets ListAll describes at once.
+	DescribeConcurrency int
 }
 
 type SecretsManager interface {
-	ListAll() ([]*secretsmanager.DescribeSecretOutput, error)
-	GetSecret(arn string) (*secretsmanager.DescribeSecretOutput, error)
-	GetSecretValue(arn, token, stage string) (*secretsmanager.GetSecretValueOutput, error)
-	GetSecretValueByStageLabel(arn, token, stageLabel string) (*secretsmanager.
-	GetSecretValueOutput,
+	ListAll(ctx context.Context, filter ListFilter) ([]*secretsmanager.DescribeSecretOutput, error)
+	GetSecret(ctx context.Context, arn string) (*secretsmanager.DescribeSecretOutput, error)
+	GetSecretValue(ctx context.Context, arn, token, stage string) (*secretsmanager.GetSecretValueOutput,
 		error)
-	PutSecretValue(arn, token, value, stage string) (*secretsmanager.PutSecretValueOutput, error)
-	GenerateRandomPassword(excludeChars string) (string, error)
-	UpdateSecretVersion(arn, token, stage, currentVersion string) (*secretsmanager.UpdateSecretVersionStageOutput, error)
+	GetSecretValueByStageLabel(ctx context.Context, arn, token,
+		stageLabel string) (*secretsmanager.GetSecretValueOutput, error)
+	PutSecretValue(ctx context.Context, arn, token, value,
+		stage string) (*secretsmanager.PutSecretValueOutput, error)
+	GenerateRandomPassword(ctx context.Context, length int64, excludeChars string) (string, error)
+	UpdateSecretVersion(ctx context.Context, arn, token, stage,
+		currentVersion string) (*secretsmanager.UpdateSecretVersionStageOutput, error)
 }
 
-func (s *SecretsManagerClient) UpdateSecretVersion(arn, token, stage,
+func (s *SecretsManagerClient) UpdateSecretVersion(ctx context.Context, arn, token, stage,
 	currentVersion string) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
-	secretVersionOutput, err := s.Client.UpdateSecretVersionStage(
-		ctx,
-		&secretsmanager.UpdateSecretVersionStageInput{
-			SecretId:            aws.String(arn),
-			VersionStage:        aws.String(stage),
-			MoveToVersionId:     aws.String(token),
-			RemoveFromVersionId: aws.String(currentVersion),
-		},
-	)
+	input := &secretsmanager.UpdateSecretVersionStageInput{
+		SecretId:        aws.String(arn),
+		VersionStage:    aws.String(stage),
+		MoveToVersionId: aws.String(token),
+	}
+
+	// If no version holds the stage yet, there's nothing to remove it from.
+	if currentVersion != "" {
+		input.RemoveFromVersionId = aws.String(currentVersion)
+	}
+
+	secretVersionOutput, err := s.Client.UpdateSecretVersionStage(ctx, input)
 
 	if err != nil {
 		s.Logger.Error("error updating secret version stage", zap.Error(err))
@@ -50,14 +75,16 @@ func (s *SecretsManagerClient) UpdateSecretVersion(arn, token, stage,
 	return secretVersionOutput, nil
 }
 
-func (s *SecretsManagerClient) GenerateRandomPassword(excludeChars string) (string, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (s *SecretsManagerClient) GenerateRandomPassword(ctx context.Context, length int64,
+	excludeChars string) (string, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
 	passwordOutput, err := s.Client.GetRandomPassword(
 		ctx,
 		&secretsmanager.GetRandomPasswordInput{
 			ExcludeCharacters: aws.String(excludeChars),
+			PasswordLength:    aws.Int64(length),
 		},
 	)
 
@@ -69,9 +96,9 @@ func (s *SecretsManagerClient) GenerateRandomPassword(excludeChars string) (stri
 	return *passwordOutput.RandomPassword, nil
 }
 
-func (s *SecretsManagerClient) GetSecretValueByStageLabel(arn,
+func (s *SecretsManagerClient) GetSecretValueByStageLabel(ctx context.Context, arn,
 	token, stageLabel string) (*secretsmanager.GetSecretValueOutput, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
 	var secretValueOutput *secretsmanager.GetSecretValueOutput
@@ -103,9 +130,9 @@ func (s *SecretsManagerClient) GetSecretValueByStageLabel(arn,
 	return secretValueOutput, nil
 }
 
-func (s *SecretsManagerClient) PutSecretValue(arn, token, value,
+func (s *SecretsManagerClient) PutSecretValue(ctx context.Context, arn, token, value,
 	stage string) (*secretsmanager.PutSecretValueOutput, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
 	secretValueOutput, err := s.Client.PutSecretValue(
@@ -126,8 +153,9 @@ func (s *SecretsManagerClient) PutSecretValue(arn, token, value,
 	return secretValueOutput, nil
 }
 
-func (s *SecretsManagerClient) GetSecret(arn string) (*secretsmanager.DescribeSecretOutput, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (s *SecretsManagerClient) GetSecret(ctx context.Context,
+	arn string) (*secretsmanager.DescribeSecretOutput, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
 	secretOutput, err := s.Client.DescribeSecret(
@@ -145,8 +173,9 @@ func (s *SecretsManagerClient) GetSecret(arn string) (*secretsmanager.DescribeSe
 	return secretOutput, nil
 }
 
-func (s *SecretsManagerClient) GetSecretValue(arn, token, stage string) (*secretsmanager.GetSecretValueOutput, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+func (s *SecretsManagerClient) GetSecretValue(ctx context.Context, arn, token,
+	stage string) (*secretsmanager.GetSecretValueOutput, error) {
+	ctx, cancel := s.withTimeout(ctx)
 	defer cancel()
 
 	secretValueOutput, err := s.Client.GetSecretValue(
@@ -166,20 +195,47 @@ func (s *SecretsManagerClient) GetSecretValue(arn, token, stage string) (*secret
 	return secretValueOutput, nil
 }
 
-func (s *SecretsManagerClient) ListAll() ([]*secretsmanager.DescribeSecretOutput, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+// ListAll returns the description of the secrets selected by the filter. The secrets are listed
+// page by page, and described concurrently by up to DescribeConcurrency workers. Each API call
+// gets its own timeout, so large accounts don't exhaust a single deadline.
+func (s *SecretsManagerClient) ListAll(ctx context.Context, filter ListFilter) ([]*secretsmanager.DescribeSecretOutput,
+	error) {
+	entries, err := s.listSecrets(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	described, err := s.describeSecrets(ctx, entries)
+	if err != nil {
+		return nil, err
+	}
 
+	var allSecrets []*secretsmanager.DescribeSecretOutput
+	for _, secret := range described {
+		if secret != nil && filter.Matches(secret) {
+			allSecrets = append(allSecrets, secret)
+		}
+	}
+
+	return allSecrets, nil
+}
+
+func (s *SecretsManagerClient) listSecrets(ctx context.Context, filter ListFilter) ([]types.SecretListEntry,
+	error) {
 	var allOutput []types.SecretListEntry
 	var nextToken *string
-externalLoop:
 	for {
+		pageCtx, cancel := s.withTimeout(ctx)
 		listOutput, err := s.Client.ListSecrets(
-			ctx,
+			pageCtx,
 			&secretsmanager.ListSecretsInput{
-				NextToken: nextToken,
+				Filters:    filter.listSecretsFilters(),
+				MaxResults: aws.Int32(listSecretsPageSize),
+				NextToken:  nextToken,
 			},
 		)
+		cancel()
+
 		if err != nil {
 			s.Logger.Error("error listing secret values", zap.Error(err))
 			return nil, fmt.Errorf("error listing secret values: %w", err)
@@ -191,32 +247,122 @@ externalLoop:
 		allOutput = append(allOutput, listOutput.SecretList...)
 		nextToken = listOutput.NextToken
 		if nextToken == nil {
-			break externalLoop
+			return allOutput, nil
 		}
 	}
+}
 
-	var allSecrets []*secretsmanager.DescribeSecretOutput
-	for _, secret := range allOutput {
-		secretOutput, err := s.Client.DescribeSecret(
-			ctx,
-			&secretsmanager.DescribeSecretInput{
-				SecretId: secret.ARN,
-			},
-		)
+// describeSecrets describes the listed secrets, keeping their order. Secrets deleted since
+// they were listed are left as nil. The first error stops the remaining calls.
+func (s *SecretsManagerClient) describeSecrets(ctx context.Context,
+	entries []types.SecretListEntry) ([]*secretsmanager.DescribeSecretOutput, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-		if err != nil {
-			s.Logger.Error("error describing secret", zap.Error(err))
-			return nil, fmt.Errorf("error describing secret: %w", err)
+	workers := s.DescribeConcurrency
+	if workers <= 0 {
+		workers = DefaultDescribeConcurrency
+	}
+
+	if workers > len(entries) {
+		workers = len(entries)
+	}
+
+	described := make([]*secretsmanager.DescribeSecretOutput, len(entries))
+	jobs := make(chan int)
+
+	var mu sync.Mutex
+	var firstErr error
+	var wg sync.WaitGroup
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				secret, err := s.describeSecret(ctx, entries[i].ARN)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					mu.Unlock()
+					continue
+				}
+
+				described[i] = secret
+			}
+		}()
+	}
+
+feed:
+	for i := range entries {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break feed
 		}
-		allSecrets = append(allSecrets, secretOutput)
 	}
 
-	return allSecrets, nil
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, fmt.Errorf("error describing secrets: %w", err)
+	}
+
+	return described, nil
+}
+
+func (s *SecretsManagerClient) describeSecret(ctx context.Context,
+	arn *string) (*secretsmanager.DescribeSecretOutput, error) {
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	callCtx, cancel := s.withTimeout(ctx)
+	defer cancel()
+
+	secretOutput, err := s.Client.DescribeSecret(callCtx, &secretsmanager.DescribeSecretInput{SecretId: arn})
+	if err != nil {
+		var notFound *types.ResourceNotFoundException
+		if errors.As(err, &notFound) {
+			s.Logger.Warn(fmt.Sprintf("secret %s was deleted while it was being listed", aws.ToString(arn)))
+			return nil, nil
+		}
+
+		s.Logger.Error("error describing secret", zap.Error(err))
+		return nil, fmt.Errorf("error describing secret: %w", err)
+	}
+
+	return secretOutput, nil
+}
+
+func (s *SecretsManagerClient) withTimeout(ctx context.Context) (context.Context,
+	context.CancelFunc) {
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return context.WithTimeout(ctx, timeout)
 }
 
-func NewSecretsManager(cfg aws.Config, logger *zap.Logger) SecretsManager {
+// NewSecretsManager returns the Secrets Manager client, with the given timeout for each API call,
+// and describing up to describeConcurrency secrets at once when they're listed.
+func NewSecretsManager(cfg aws.Config, logger *zap.Logger, timeout time.Duration,
+	describeConcurrency int) SecretsManager {
 	return &SecretsManagerClient{
-		Client: secretsmanager.NewFromConfig(cfg),
-		Logger: logger,
+		Client: secretsmanager.NewFromConfig(cfg, func(o *secretsmanager.Options) {
+			o.APIOptions = append(o.APIOptions, tracing.TraceAPICalls, metrics.RecordAPICalls)
+		}),
+		Logger:              logger,
+		Timeout:             timeout,
+		DescribeConcurrency: describeConcurrency,
 	}
 }
@@ -0,0 +1,182 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// fakeSecretsManagerAPI serves ListSecrets, in pages of two secrets, and DescribeSecret for the
+// given secret names. It tracks the highest number of DescribeSecret calls in flight.
+type fakeSecretsManagerAPI struct {
+	names    []string
+	failing  string
+	deleted  string
+	mu       sync.Mutex
+	filters  [][]map[string]interface{}
+	inFlight int32
+	maxCalls int32
+}
+
+func (f *fakeSecretsManagerAPI) roundTrip(req *http.Request) (*http.Response, error) {
+	var input map[string]interface{}
+	_ = json.NewDecoder(req.Body).Decode(&input)
+
+	switch req.Header.Get("X-Amz-Target") {
+	case "secretsmanager.ListSecrets":
+		return f.listSecrets(req, input)
+	case "secretsmanager.DescribeSecret":
+		return f.describeSecret(req, input)
+	}
+
+	return response(req, http.StatusBadRequest, `{"__type":"InvalidRequestException"}`), nil
+}
+
+func (f *fakeSecretsManagerAPI) listSecrets(req *http.Request, input map[string]interface{}) (*http.Response,
+	error) {
+	var filters []map[string]interface{}
+	if raw, ok := input["Filters"].([]interface{}); ok {
+		for _, filter := range raw {
+			filters = append(filters, filter.(map[string]interface{}))
+		}
+	}
+
+	f.mu.Lock()
+	f.filters = append(f.filters, filters)
+	f.mu.Unlock()
+
+	start := 0
+	if token, ok := input["NextToken"].(string); ok {
+		_, _ = fmt.Sscanf(token, "%d", &start)
+	}
+
+	end := start + 2
+	if end > len(f.names) {
+		end = len(f.names)
+	}
+
+	var entries []string
+	for _, name := range f.names[start:end] {
+		entries = append(entries, fmt.Sprintf(`{"ARN":"arn:%s","Name":"%s"}`, name, name))
+	}
+
+	body := fmt.Sprintf(`{"SecretList":[%s]`, strings.Join(entries, ","))
+	if end < len(f.names) {
+		body += fmt.Sprintf(`,"NextToken":"%d"`, end)
+	}
+
+	return response(req, http.StatusOK, body+"}"), nil
+}
+
+func (f *fakeSecretsManagerAPI) describeSecret(req *http.Request, input map[string]interface{}) (*http.Response,
+	error) {
+	calls := atomic.AddInt32(&f.inFlight, 1)
+	defer atomic.AddInt32(&f.inFlight, -1)
+
+	for {
+		highest := atomic.LoadInt32(&f.maxCalls)
+		if calls <= highest || atomic.CompareAndSwapInt32(&f.maxCalls, highest, calls) {
+			break
+		}
+	}
+
+	time.Sleep(10 * time.Millisecond)
+
+	name := strings.TrimPrefix(input["SecretId"].(string), "arn:")
+	switch name {
+	case f.failing:
+		return response(req, http.StatusBadRequest, `{"__type":"InvalidRequestException"}`), nil
+	case f.deleted:
+		return response(req, http.StatusBadRequest, `{"__type":"ResourceNotFoundException"}`), nil
+	}
+
+	return response(req, http.StatusOK, fmt.Sprintf(
+		`{"ARN":"arn:%s","Name":"%s","Tags":[{"Key":"team","Value":"payments"}]}`, name, name)), nil
+}
+
+func response(req *http.Request, status int, body string) *http.Response {
+	return &http.Response{
+		StatusCode: status,
+		Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.1"}},
+		Body:       io.NopCloser(strings.NewReader(body)),
+		Request:    req,
+	}
+}
+
+func newTestClient(api *fakeSecretsManagerAPI, concurrency int) *SecretsManagerClient {
+	return &SecretsManagerClient{
+		Client: secretsmanager.NewFromConfig(aws.Config{
+			Region:      "us-east-1",
+			Credentials: credentials.NewStaticCredentialsProvider("test", "test", ""),
+			HTTPClient:  &http.Client{Transport: roundTripperFunc(api.roundTrip)},
+		}, func(o *secretsmanager.Options) {
+			o.RetryMaxAttempts = 1
+		}),
+		Logger:              zap.NewNop(),
+		Timeout:             time.Second,
+		DescribeConcurrency: concurrency,
+	}
+}
+
+func TestListAll(t *testing.T) {
+	api := &fakeSecretsManagerAPI{names: []string{"prod/a", "prod/b", "prod/c", "prod/d", "prod/e"}}
+
+	secrets, err := newTestClient(api, 2).ListAll(context.Background(), ListFilter{
+		NamePrefix: "prod/",
+		Tags:       map[string]string{"team": "payments"},
+	})
+	assert.NoError(t, err)
+
+	var names []string
+	for _, secret := range secrets {
+		names = append(names, aws.ToString(secret.Name))
+	}
+
+	assert.Equal(t, api.names, names, "the listing order is kept")
+	assert.Equal(t, int32(2), api.maxCalls, "the describe calls are bounded by the concurrency")
+
+	if assert.Len(t, api.filters, 3, "every page is listed") {
+		assert.Equal(t, []map[string]interface{}{
+			{"Key": "name", "Values": []interface{}{"prod/"}},
+			{"Key": "tag-key", "Values": []interface{}{"team"}},
+			{"Key": "tag-value", "Values": []interface{}{"payments"}},
+		}, api.filters[2])
+	}
+}
+
+func TestListAllSkipsDeletedSecrets(t *testing.T) {
+	api := &fakeSecretsManagerAPI{names: []string{"a", "b", "c"}, deleted: "b"}
+
+	secrets, err := newTestClient(api, 0).ListAll(context.Background(), ListFilter{})
+	assert.NoError(t, err)
+	if assert.Len(t, secrets, 2) {
+		assert.Equal(t, "a", aws.ToString(secrets[0].Name))
+		assert.Equal(t, "c", aws.ToString(secrets[1].Name))
+	}
+}
+
+func TestListAllDescribeError(t *testing.T) {
+	api := &fakeSecretsManagerAPI{names: []string{"a", "b", "c", "d"}, failing: "b"}
+
+	secrets, err := newTestClient(api, 1).ListAll(context.Background(), ListFilter{})
+	assert.ErrorContains(t, err, "error describing secret")
+	assert.Nil(t, secrets)
+}
@@ -0,0 +1,504 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/adapter"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/metrics"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/tracing"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Sources of the new secret values: the Secrets Manager GetRandomPassword API, or the local
+// cryptographic generator.
+const (
+	GeneratorSourceAWS   = "aws"
+	GeneratorSourceLocal = "local"
+)
+
+// DefaultReplicaTimeout is how long the testSecret step waits for the replicas, unless it's
+// configured.
+const DefaultReplicaTimeout = 30 * time.Second
+
+// DefaultJSONKeys are the keys rotated in a JSON secret value, unless they're configured.
+var DefaultJSONKeys = []string{"password"}
+
+// Config is the runtime configuration of the lambda. Every setting has a default, which can be
+// overridden by the environment and then by a remote document (see Load).
+type Config struct {
+	// Enabled is the feature flag of the rotations. Admin actions run even if it's disabled.
+	Enabled bool `json:"enabled"`
+	// DryRun runs every read and check of the rotations, but skips their writes (see
+	// rotation.Plan).
+	DryRun   bool          `json:"dry_run"`
+	LogLevel zapcore.Level `json:"log_level"`
+	// Generator configures the new secret values. The tags of a secret can still override it.
+	Generator Generator `json:"generator"`
+	// JSONKeys are the keys rotated in a JSON secret value.
+	JSONKeys []string `json:"json_keys"`
+	// AllowedPrefixes restricts the secrets the lambda rotates to the ones whose name starts
+	// with any of them. If it's empty, every secret can be rotated.
+	AllowedPrefixes []string `json:"allowed_prefixes"`
+	// DescribeConcurrency is how many secrets are described at once when the secrets of the
+	// account are listed (e.g.: by the admin actions).
+	DescribeConcurrency int           `json:"describe_concurrency"`
+	Notifications       Notifications `json:"notifications"`
+	Timeouts            Timeouts      `json:"timeouts"`
+	Audit               Audit         `json:"audit"`
+	Metrics             Metrics       `json:"metrics"`
+	Tracing             Tracing       `json:"tracing"`
+	Roles               Roles         `json:"roles"`
+}
+
+type Generator struct {
+	// Source is either GeneratorSourceAWS or GeneratorSourceLocal.
+	Source string           `json:"source"`
+	Format generator.Format `json:"format"`
+	// Length and ExcludeCharacters override the defaults of the format, if they're set.
+	Length            int     `json:"length,omitempty"`
+	ExcludeCharacters *string `json:"exclude_characters,omitempty"`
+}
+
+// Notifications holds the sinks that receive the rotation outcomes. Empty fields are disabled.
+type Notifications struct {
+	SNSTopicARN    string            `json:"sns_topic_arn"`
+	EventBusName   string            `json:"event_bus_name"`
+	WebhookURL     string            `json:"webhook_url"`
+	WebhookHeaders map[string]string `json:"webhook_headers"`
+}
+
+type Timeouts struct {
+	// API is the timeout of each Secrets Manager API call.
+	API Duration `json:"api"`
+	// Replica is how long the testSecret step waits for the AWSPENDING version to be visible
+	// in every replica region.
+	Replica Duration `json:"replica"`
+}
+
+// Audit holds the sinks of the audit records, and the salt of the value fingerprints. Empty
+// sinks are disabled.
+type Audit struct {
+	TableName    string `json:"table_name"`
+	BucketName   string `json:"bucket_name"`
+	BucketPrefix string `json:"bucket_prefix"`
+	FilePath     string `json:"file_path"`
+	Salt         string `json:"salt"`
+}
+
+// Enabled reports whether any audit sink is configured.
+func (a Audit) Enabled() bool {
+	return a.TableName != "" || a.BucketName != "" || a.FilePath != ""
+}
+
+type Metrics struct {
+	// Namespace is the CloudWatch namespace of the metrics.
+	Namespace string `json:"namespace"`
+}
+
+type Tracing struct {
+	// Exporter of the OpenTelemetry spans. Tracing is disabled if it's empty.
+	Exporter tracing.Exporter `json:"exporter"`
+}
+
+// Roles are the roles assumed to rotate the secrets of other accounts. The rotation:role-arn
+// tag of a secret takes precedence over them.
+type Roles struct {
+	// Accounts maps each account id to the ARN of the role to assume in it.
+	Accounts   map[string]string `json:"accounts"`
+	ExternalID string            `json:"external_id"`
+}
+
+// Duration is a time.Duration that's written in documents as a string (e.g.: "10s").
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var value string
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("duration must be a string (e.g.: \"10s\"): %w", err)
+	}
+
+	parsed, err := time.ParseDuration(strings.TrimSpace(value))
+	if err != nil {
+		return err
+	}
+
+	*d = Duration(parsed)
+	return nil
+}
+
+// Default returns the configuration used when nothing is overridden.
+func Default() Config {
+	return Config{
+		Enabled:             true,
+		LogLevel:            zapcore.InfoLevel,
+		Generator:           Generator{Source: GeneratorSourceAWS, Format: generator.FormatPassword},
+		JSONKeys:            DefaultJSONKeys,
+		DescribeConcurrency: client.DefaultDescribeConcurrency,
+		Timeouts: Timeouts{
+			API:     Duration(client.DefaultTimeout),
+			Replica: Duration(DefaultReplicaTimeout),
+		},
+		Metrics: Metrics{Namespace: metrics.DefaultNamespace},
+		Roles:   Roles{Accounts: map[string]string{}},
+	}
+}
+
+// Load builds the configuration of a cold start: the defaults, overridden by the environment
+// (see FromEnv) and then by the document of the remote source, if the environment sets one
+// (see NewSourceFromEnv). The result is validated.
+func Load(ctx context.Context, logger *zap.Logger, opts ...adapter.Option) (Config, error) {
+	cfg, err := FromEnv()
+	if err != nil {
+		return Config{}, err
+	}
+
+	source, err := NewSourceFromEnv(ctx, opts...)
+	if err != nil {
+		return Config{}, err
+	}
+
+	if source != nil {
+		document, err := source.Fetch(ctx)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Unable to fetch the configuration from %s", source.Name()), zap.Error(err))
+			return Config{}, erroer.NewConfigurationError(fmt.Sprintf(
+				"unable to fetch the configuration from %s", source.Name()), err)
+		}
+
+		if cfg, err = cfg.Apply(document); err != nil {
+			logger.Error(fmt.Sprintf("Invalid configuration document in %s", source.Name()), zap.Error(err))
+			return Config{}, err
+		}
+
+		logger.Info(fmt.Sprintf("Configuration overridden by %s", source.Name()))
+	}
+
+	if err := cfg.Validate(); err != nil {
+		logger.Error("Invalid configuration", zap.Error(err))
+		return Config{}, err
+	}
+
+	return cfg, nil
+}
+
+// FromEnv returns the defaults, overridden by the TF_VAR_rotation_* environment variables:
+//   - lambda_enabled: "false" disables the rotations.
+//   - dry_run: "true" runs the rotations without writing anything.
+//   - log_level: debug, info, warn or error.
+//   - generator, generator_format, generator_length and generator_exclude_chars.
+//   - json_keys and allowed_prefixes, as comma separated lists.
+//   - describe_concurrency, as a number.
+//   - sns_topic_arn, event_bus_name, webhook_url and webhook_headers (a comma separated list of
+//     name=value pairs).
+//   - api_timeout and replica_timeout, as durations (e.g.: 10s).
+//   - audit_table, audit_bucket, audit_prefix, audit_file and audit_salt.
+//   - metrics_namespace and trace_exporter (otlp or stdout).
+//   - account_roles (a comma separated list of account_id=role_arn pairs) and role_external_id.
+//
+// It isn't validated, since the remote document may still fix it.
+//
+// The AWS client settings are only read from the environment, since they configure the clients
+// that fetch the remote document (see rotation.GetAWSOptions): secretsmanager_endpoint,
+// access_key_id, secret_access_key and session_token.
+func FromEnv() (Config, error) {
+	cfg := Default()
+
+	for name, flag := range map[string]*bool{
+		"TF_VAR_rotation_lambda_enabled": &cfg.Enabled,
+		"TF_VAR_rotation_dry_run":        &cfg.DryRun,
+	} {
+		if value := env(name); value != "" {
+			parsed, err := strconv.ParseBool(value)
+			if err != nil {
+				return Config{}, invalidVariable(name, err)
+			}
+
+			*flag = parsed
+		}
+	}
+
+	if level := env("TF_VAR_rotation_log_level"); level != "" {
+		if err := cfg.LogLevel.UnmarshalText([]byte(level)); err != nil {
+			return Config{}, invalidVariable("TF_VAR_rotation_log_level", err)
+		}
+	}
+
+	if source := env("TF_VAR_rotation_generator"); source != "" {
+		cfg.Generator.Source = source
+	}
+
+	if format := env("TF_VAR_rotation_generator_format"); format != "" {
+		cfg.Generator.Format = generator.Format(format)
+	}
+
+	if length := env("TF_VAR_rotation_generator_length"); length != "" {
+		value, err := strconv.Atoi(length)
+		if err != nil {
+			return Config{}, invalidVariable("TF_VAR_rotation_generator_length", err)
+		}
+
+		cfg.Generator.Length = value
+	}
+
+	if excluded, ok := os.LookupEnv("TF_VAR_rotation_generator_exclude_chars"); ok {
+		cfg.Generator.ExcludeCharacters = &excluded
+	}
+
+	if keys := list(env("TF_VAR_rotation_json_keys")); len(keys) > 0 {
+		cfg.JSONKeys = keys
+	}
+
+	cfg.AllowedPrefixes = list(env("TF_VAR_rotation_allowed_prefixes"))
+
+	if concurrency := env("TF_VAR_rotation_describe_concurrency"); concurrency != "" {
+		value, err := strconv.Atoi(concurrency)
+		if err != nil {
+			return Config{}, invalidVariable("TF_VAR_rotation_describe_concurrency", err)
+		}
+
+		cfg.DescribeConcurrency = value
+	}
+
+	cfg.Notifications = Notifications{
+		SNSTopicARN:    env("TF_VAR_rotation_sns_topic_arn"),
+		EventBusName:   env("TF_VAR_rotation_event_bus_name"),
+		WebhookURL:     env("TF_VAR_rotation_webhook_url"),
+		WebhookHeaders: pairs(os.Getenv("TF_VAR_rotation_webhook_headers")),
+	}
+
+	cfg.Audit = Audit{
+		TableName:    env("TF_VAR_rotation_audit_table"),
+		BucketName:   env("TF_VAR_rotation_audit_bucket"),
+		BucketPrefix: env("TF_VAR_rotation_audit_prefix"),
+		FilePath:     env("TF_VAR_rotation_audit_file"),
+		Salt:         os.Getenv("TF_VAR_rotation_audit_salt"),
+	}
+
+	if namespace := env("TF_VAR_rotation_metrics_namespace"); namespace != "" {
+		cfg.Metrics.Namespace = namespace
+	}
+
+	cfg.Tracing.Exporter = tracing.Exporter(strings.ToLower(env("TF_VAR_rotation_trace_exporter")))
+
+	cfg.Roles = Roles{
+		Accounts:   pairs(os.Getenv("TF_VAR_rotation_account_roles")),
+		ExternalID: env("TF_VAR_rotation_role_external_id"),
+	}
+
+	for name, timeout := range map[string]*Duration{
+		"TF_VAR_rotation_api_timeout":     &cfg.Timeouts.API,
+		"TF_VAR_rotation_replica_timeout": &cfg.Timeouts.Replica,
+	} {
+		if value := env(name); value != "" {
+			parsed, err := time.ParseDuration(value)
+			if err != nil {
+				return Config{}, invalidVariable(name, err)
+			}
+
+			*timeout = Duration(parsed)
+		}
+	}
+
+	return cfg, nil
+}
+
+// Apply returns the configuration overridden by the given JSON document. Only the settings in
+// the document are overridden, and unknown settings are rejected.
+func (c Config) Apply(document []byte) (Config, error) {
+	// The lists and maps are copied, so the document doesn't change the ones of c.
+	c.JSONKeys = append([]string(nil), c.JSONKeys...)
+	c.AllowedPrefixes = append([]string(nil), c.AllowedPrefixes...)
+	headers := map[string]string{}
+	for name, value := range c.Notifications.WebhookHeaders {
+		headers[name] = value
+	}
+
+	c.Notifications.WebhookHeaders = headers
+	accounts := map[string]string{}
+	for account, role := range c.Roles.Accounts {
+		accounts[account] = role
+	}
+
+	c.Roles.Accounts = accounts
+
+	decoder := json.NewDecoder(bytes.NewReader(document))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&c); err != nil {
+		return Config{}, erroer.NewConfigurationError("invalid configuration document", err)
+	}
+
+	return c, nil
+}
+
+// Validate checks that the lambda can run with this configuration.
+func (c Config) Validate() error {
+	if c.Generator.Source != GeneratorSourceAWS && c.Generator.Source != GeneratorSourceLocal {
+		return erroer.NewConfigurationError(fmt.Sprintf(
+			"generator source %s is not supported, supported sources are: %s, %s", c.Generator.Source,
+			GeneratorSourceAWS, GeneratorSourceLocal), nil)
+	}
+
+	if c.Generator.Length < 0 {
+		return erroer.NewConfigurationError(fmt.Sprintf("generator length must not be negative, got %d",
+			c.Generator.Length), nil)
+	}
+
+	if err := c.Generator.Policy().Validate(); err != nil {
+		return erroer.NewConfigurationError("invalid generation policy", err)
+	}
+
+	if err := ValidateGeneratorSource(c.Generator.Source, c.Generator.Policy()); err != nil {
+		return err
+	}
+
+	if len(c.JSONKeys) == 0 {
+		return erroer.NewConfigurationError("at least one JSON key must be rotated", nil)
+	}
+
+	for _, key := range c.JSONKeys {
+		if strings.TrimSpace(key) == "" {
+			return erroer.NewConfigurationError("JSON keys must not be empty", nil)
+		}
+	}
+
+	for _, prefix := range c.AllowedPrefixes {
+		if strings.TrimSpace(prefix) == "" {
+			return erroer.NewConfigurationError("allowed secret name prefixes must not be empty", nil)
+		}
+	}
+
+	if c.DescribeConcurrency <= 0 {
+		return erroer.NewConfigurationError(fmt.Sprintf("describe concurrency must be greater than zero, got %d",
+			c.DescribeConcurrency), nil)
+	}
+
+	if c.Notifications.WebhookURL != "" {
+		parsed, err := url.Parse(c.Notifications.WebhookURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+			return erroer.NewConfigurationError(fmt.Sprintf("webhook url %s is not a valid http(s) url",
+				c.Notifications.WebhookURL), err)
+		}
+	}
+
+	if c.Timeouts.API <= 0 || c.Timeouts.Replica <= 0 {
+		return erroer.NewConfigurationError("timeouts must be greater than zero", nil)
+	}
+
+	if c.Audit.Enabled() && c.Audit.Salt == "" {
+		return erroer.NewConfigurationError("the audit sinks require a fingerprint salt", nil)
+	}
+
+	if strings.TrimSpace(c.Metrics.Namespace) == "" {
+		return erroer.NewConfigurationError("the metrics namespace must not be empty", nil)
+	}
+
+	switch c.Tracing.Exporter {
+	case tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout:
+	default:
+		return erroer.NewConfigurationError(fmt.Sprintf(
+			"trace exporter %s is not supported, supported exporters are: %s, %s", c.Tracing.Exporter,
+			tracing.ExporterOTLP, tracing.ExporterStdout), nil)
+	}
+
+	for account, role := range c.Roles.Accounts {
+		if strings.TrimSpace(account) == "" || strings.TrimSpace(role) == "" {
+			return erroer.NewConfigurationError("account roles must have an account id and a role ARN", nil)
+		}
+	}
+
+	return nil
+}
+
+// ValidateGeneratorSource checks that the source can generate the values of the policy: the
+// Secrets Manager API only generates passwords.
+func ValidateGeneratorSource(source string, policy generator.Policy) error {
+	format := policy.WithDefaults().Format
+	if source == GeneratorSourceAWS && format != generator.FormatPassword {
+		return erroer.NewConfigurationError(fmt.Sprintf(
+			"the %s generator source only generates %s values, use the %s source for %s values",
+			GeneratorSourceAWS, generator.FormatPassword, GeneratorSourceLocal, format), nil)
+	}
+
+	return nil
+}
+
+// Policy returns the generation policy of the new secret values.
+func (g Generator) Policy() generator.Policy {
+	policy := generator.DefaultPolicy()
+	if g.Format != "" && g.Format != generator.FormatPassword {
+		policy = generator.Policy{Format: g.Format}
+	}
+
+	if g.Length > 0 {
+		policy.Length = g.Length
+	}
+
+	if g.ExcludeCharacters != nil {
+		policy.ExcludeCharacters = *g.ExcludeCharacters
+	}
+
+	return policy.WithDefaults()
+}
+
+// IsNameAllowed reports whether the name starts with any of the prefixes. Every name is
+// allowed if there are no prefixes.
+func IsNameAllowed(name string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func env(name string) string {
+	return strings.TrimSpace(os.Getenv(name))
+}
+
+func list(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+func pairs(value string) map[string]string {
+	parsed := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		name, value, found := strings.Cut(pair, "=")
+		name, value = strings.TrimSpace(name), strings.TrimSpace(value)
+		if found && name != "" {
+			parsed[name] = value
+		}
+	}
+
+	return parsed
+}
+
+func invalidVariable(name string, err error) error {
+	return erroer.NewConfigurationError(fmt.Sprintf("invalid environment variable %s", name), err)
+}
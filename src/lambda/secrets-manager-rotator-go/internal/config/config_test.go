@@ -0,0 +1,243 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/metrics"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func TestDefault(t *testing.T) {
+	cfg := Default()
+	assert.NoError(t, cfg.Validate())
+	assert.True(t, cfg.Enabled)
+	assert.Equal(t, generator.DefaultPolicy(), cfg.Generator.Policy())
+	assert.True(t, IsNameAllowed("any", cfg.AllowedPrefixes))
+}
+
+func TestFromEnv(t *testing.T) {
+	t.Setenv("TF_VAR_rotation_lambda_enabled", "false")
+	t.Setenv("TF_VAR_rotation_dry_run", "true")
+	t.Setenv("TF_VAR_rotation_log_level", "debug")
+	t.Setenv("TF_VAR_rotation_generator", "local")
+	t.Setenv("TF_VAR_rotation_generator_length", "40")
+	t.Setenv("TF_VAR_rotation_generator_exclude_chars", "")
+	t.Setenv("TF_VAR_rotation_json_keys", "password, api_key")
+	t.Setenv("TF_VAR_rotation_allowed_prefixes", "prod/,shared/")
+	t.Setenv("TF_VAR_rotation_describe_concurrency", "4")
+	t.Setenv("TF_VAR_rotation_webhook_url", "https://hooks.example.com/rotation")
+	t.Setenv("TF_VAR_rotation_webhook_headers", "Authorization=Bearer token")
+	t.Setenv("TF_VAR_rotation_api_timeout", "10s")
+	t.Setenv("TF_VAR_rotation_audit_file", "/tmp/audit.jsonl")
+	t.Setenv("TF_VAR_rotation_audit_salt", "salt")
+	t.Setenv("TF_VAR_rotation_trace_exporter", "OTLP")
+	t.Setenv("TF_VAR_rotation_account_roles", " 111111111111=arn:aws:iam::111111111111:role/a,"+
+		"invalid,222222222222=arn:aws:iam::222222222222:role/b ")
+	t.Setenv("TF_VAR_rotation_role_external_id", "rotator")
+
+	cfg, err := FromEnv()
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+
+	assert.False(t, cfg.Enabled)
+	assert.True(t, cfg.DryRun)
+	assert.Equal(t, zapcore.DebugLevel, cfg.LogLevel)
+	assert.Equal(t, GeneratorSourceLocal, cfg.Generator.Source)
+	assert.Equal(t, 40, cfg.Generator.Policy().Length)
+	assert.Equal(t, "", cfg.Generator.Policy().ExcludeCharacters)
+	assert.Equal(t, []string{"password", "api_key"}, cfg.JSONKeys)
+	assert.True(t, IsNameAllowed("prod/db", cfg.AllowedPrefixes))
+	assert.False(t, IsNameAllowed("dev/db", cfg.AllowedPrefixes))
+	assert.Equal(t, 4, cfg.DescribeConcurrency)
+	assert.Equal(t, map[string]string{"Authorization": "Bearer token"}, cfg.Notifications.WebhookHeaders)
+	assert.Equal(t, Duration(10*time.Second), cfg.Timeouts.API)
+	assert.Equal(t, Duration(DefaultReplicaTimeout), cfg.Timeouts.Replica)
+	assert.Equal(t, Audit{FilePath: "/tmp/audit.jsonl", Salt: "salt"}, cfg.Audit)
+	assert.Equal(t, metrics.DefaultNamespace, cfg.Metrics.Namespace)
+	assert.Equal(t, tracing.ExporterOTLP, cfg.Tracing.Exporter)
+	assert.Equal(t, Roles{
+		Accounts: map[string]string{
+			"111111111111": "arn:aws:iam::111111111111:role/a",
+			"222222222222": "arn:aws:iam::222222222222:role/b",
+		},
+		ExternalID: "rotator",
+	}, cfg.Roles)
+}
+
+func TestFromEnvInvalid(t *testing.T) {
+	for name, value := range map[string]string{
+		"TF_VAR_rotation_lambda_enabled":       "maybe",
+		"TF_VAR_rotation_dry_run":              "yes",
+		"TF_VAR_rotation_log_level":            "verbose",
+		"TF_VAR_rotation_generator_length":     "long",
+		"TF_VAR_rotation_replica_timeout":      "1 minute",
+		"TF_VAR_rotation_api_timeout":          "forever",
+		"TF_VAR_rotation_describe_concurrency": "many",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+
+			_, err := FromEnv()
+			var configurationError *erroer.RotatorConfigurationError
+			assert.ErrorAs(t, err, &configurationError)
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	base := Default()
+	base.Notifications.WebhookHeaders = map[string]string{"X-Team": "payments"}
+	base.Roles.Accounts = map[string]string{"111111111111": "arn:aws:iam::111111111111:role/a"}
+	base.Generator.Source = GeneratorSourceLocal
+
+	cfg, err := base.Apply([]byte(`{
+		"enabled": false,
+		"generator": {"format": "hex", "length": 16},
+		"allowed_prefixes": ["prod/"],
+		"notifications": {"webhook_headers": {"X-Env": "prod"}},
+		"timeouts": {"replica": "2m"},
+		"audit": {"table_name": "rotation-audit", "salt": "salt"},
+		"roles": {"accounts": {"222222222222": "arn:aws:iam::222222222222:role/b"}}
+	}`))
+	assert.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+
+	assert.False(t, cfg.Enabled)
+	assert.Equal(t, GeneratorSourceLocal, cfg.Generator.Source, "settings missing in the document are kept")
+	assert.Equal(t, generator.Policy{Format: generator.FormatHex, Length: 16}, cfg.Generator.Policy())
+	assert.Equal(t, []string{"prod/"}, cfg.AllowedPrefixes)
+	assert.Equal(t, map[string]string{"X-Team": "payments", "X-Env": "prod"}, cfg.Notifications.WebhookHeaders)
+	assert.Equal(t, map[string]string{"X-Team": "payments"}, base.Notifications.WebhookHeaders)
+	assert.Equal(t, Duration(2*time.Minute), cfg.Timeouts.Replica)
+	assert.Equal(t, Audit{TableName: "rotation-audit", Salt: "salt"}, cfg.Audit)
+	assert.Len(t, cfg.Roles.Accounts, 2)
+	assert.Len(t, base.Roles.Accounts, 1)
+
+	for name, document := range map[string]string{
+		"UnknownSetting":  `{"enabeld": false}`,
+		"InvalidDuration": `{"timeouts": {"api": 10}}`,
+		"NotJSON":         `enabled=false`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := base.Apply([]byte(document))
+			var configurationError *erroer.RotatorConfigurationError
+			assert.ErrorAs(t, err, &configurationError)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for name, update := range map[string]func(cfg *Config){
+		"UnknownGeneratorSource":  func(cfg *Config) { cfg.Generator.Source = "vault" },
+		"UnknownFormat":           func(cfg *Config) { cfg.Generator.Format = "emoji" },
+		"AWSSourceWithTokens":     func(cfg *Config) { cfg.Generator.Format = generator.FormatHex },
+		"AWSSourceWithUUIDs":      func(cfg *Config) { cfg.Generator.Format = generator.FormatUUID },
+		"NegativeLength":          func(cfg *Config) { cfg.Generator.Length = -1 },
+		"TooShortPassword":        func(cfg *Config) { cfg.Generator.Length = 2 },
+		"NoJSONKeys":              func(cfg *Config) { cfg.JSONKeys = nil },
+		"EmptyPrefix":             func(cfg *Config) { cfg.AllowedPrefixes = []string{" "} },
+		"InvalidWebhookURL":       func(cfg *Config) { cfg.Notifications.WebhookURL = "hooks.example.com" },
+		"ZeroTimeout":             func(cfg *Config) { cfg.Timeouts.API = 0 },
+		"ZeroDescribeConcurrency": func(cfg *Config) { cfg.DescribeConcurrency = 0 },
+		"AuditWithoutSalt":        func(cfg *Config) { cfg.Audit.BucketName = "rotation-audit" },
+		"EmptyMetricsNamespace":   func(cfg *Config) { cfg.Metrics.Namespace = "" },
+		"UnknownTraceExporter":    func(cfg *Config) { cfg.Tracing.Exporter = "zipkin" },
+		"AccountWithoutRole":      func(cfg *Config) { cfg.Roles.Accounts = map[string]string{"111111111111": ""} },
+	} {
+		t.Run(name, func(t *testing.T) {
+			cfg := Default()
+			update(&cfg)
+
+			var configurationError *erroer.RotatorConfigurationError
+			assert.ErrorAs(t, cfg.Validate(), &configurationError)
+		})
+	}
+}
+
+type fakeParameterStore struct {
+	value string
+	err   error
+}
+
+func (f *fakeParameterStore) GetParameter(ctx context.Context, params *ssm.GetParameterInput,
+	optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	return &ssm.GetParameterOutput{Parameter: &types.Parameter{Name: params.Name, Value: aws.String(f.value)}}, nil
+}
+
+func TestSSMSource(t *testing.T) {
+	source := &SSMSource{Client: &fakeParameterStore{value: `{"enabled":false}`}, Parameter: "/rotator/config"}
+
+	document, err := source.Fetch(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, `{"enabled":false}`, string(document))
+	assert.Equal(t, "SSM parameter /rotator/config", source.Name())
+
+	source.Client = &fakeParameterStore{err: errors.New("access denied")}
+	_, err = source.Fetch(context.Background())
+	assert.ErrorContains(t, err, "access denied")
+}
+
+func TestLoadFromAppConfig(t *testing.T) {
+	document := `{"log_level":"warn","json_keys":["token"]}`
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/applications/rotator/environments/prod/configurations/runtime" {
+			http.NotFound(w, r)
+			return
+		}
+
+		_, _ = w.Write([]byte(document))
+	}))
+	defer server.Close()
+
+	endpoint, err := url.Parse(server.URL)
+	assert.NoError(t, err)
+
+	t.Setenv("AWS_APPCONFIG_EXTENSION_HTTP_PORT", endpoint.Port())
+	t.Setenv("TF_VAR_rotation_config_appconfig", "rotator/prod/runtime")
+
+	cfg, err := Load(context.Background(), zap.NewNop())
+	assert.NoError(t, err)
+	assert.Equal(t, zapcore.WarnLevel, cfg.LogLevel)
+	assert.Equal(t, []string{"token"}, cfg.JSONKeys)
+
+	document = `{"generator":{"source":"vault"}}`
+	_, err = Load(context.Background(), zap.NewNop())
+	var configurationError *erroer.RotatorConfigurationError
+	assert.ErrorAs(t, err, &configurationError, "the overridden configuration is validated")
+
+	t.Setenv("TF_VAR_rotation_config_appconfig", "rotator/prod/missing")
+	_, err = Load(context.Background(), zap.NewNop())
+	assert.ErrorContains(t, err, "status 404")
+}
+
+func TestNewSourceFromEnv(t *testing.T) {
+	source, err := NewSourceFromEnv(context.Background())
+	assert.NoError(t, err)
+	assert.Nil(t, source)
+
+	t.Setenv("TF_VAR_rotation_config_appconfig", "rotator/prod")
+	_, err = NewSourceFromEnv(context.Background())
+	assert.Error(t, err)
+
+	t.Setenv("TF_VAR_rotation_config_parameter", "/rotator/config")
+	t.Setenv("TF_VAR_rotation_config_appconfig", "rotator/prod/runtime")
+	_, err = NewSourceFromEnv(context.Background())
+	assert.Error(t, err, "only one source can be set")
+}
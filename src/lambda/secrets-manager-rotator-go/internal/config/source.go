@@ -0,0 +1,155 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/adapter"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Source is a remote JSON document that overrides the configuration (see Config.Apply).
+type Source interface {
+	Fetch(ctx context.Context) ([]byte, error)
+	// Name describes the source in logs and errors.
+	Name() string
+}
+
+// NewSourceFromEnv returns the source set in the environment, or nil if there's none: either
+// the SSM parameter named in TF_VAR_rotation_config_parameter, or the AppConfig profile set in
+// TF_VAR_rotation_config_appconfig as application/environment/profile.
+func NewSourceFromEnv(ctx context.Context, opts ...adapter.Option) (Source, error) {
+	parameter := env("TF_VAR_rotation_config_parameter")
+	profile := env("TF_VAR_rotation_config_appconfig")
+
+	switch {
+	case parameter != "" && profile != "":
+		return nil, erroer.NewConfigurationError("the configuration can be read either from an SSM "+
+			"parameter or from an AppConfig profile, not both", nil)
+	case parameter != "":
+		awsCfg, err := adapter.NewAWS(ctx, "", opts...)
+		if err != nil {
+			return nil, erroer.NewConfigurationError("can't instantiate the AWS client of the configuration", err)
+		}
+
+		return NewSSMSource(awsCfg, parameter), nil
+	case profile != "":
+		return NewAppConfigSource(profile, env("AWS_APPCONFIG_EXTENSION_HTTP_PORT"))
+	}
+
+	return nil, nil
+}
+
+type SSMParameterGetter interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (
+		*ssm.GetParameterOutput, error)
+}
+
+// SSMSource reads the document from an SSM parameter. SecureString parameters are decrypted.
+type SSMSource struct {
+	Client    SSMParameterGetter
+	Parameter string
+}
+
+func (s *SSMSource) Fetch(ctx context.Context) ([]byte, error) {
+	output, err := s.Client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name:           aws.String(s.Parameter),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("unable to get the parameter %s: %w", s.Parameter, err)
+	}
+
+	if output.Parameter == nil {
+		return nil, fmt.Errorf("parameter %s has no value", s.Parameter)
+	}
+
+	return []byte(aws.ToString(output.Parameter.Value)), nil
+}
+
+func (s *SSMSource) Name() string {
+	return fmt.Sprintf("SSM parameter %s", s.Parameter)
+}
+
+func NewSSMSource(cfg aws.Config, parameter string) Source {
+	return &SSMSource{
+		Client:    ssm.NewFromConfig(cfg),
+		Parameter: parameter,
+	}
+}
+
+// DefaultAppConfigEndpoint is the local endpoint of the AWS AppConfig Lambda extension.
+const DefaultAppConfigEndpoint = "http://localhost:2772"
+
+// AppConfigSource reads the document from an AppConfig configuration profile, through the AWS
+// AppConfig Lambda extension (which caches and polls it, so cold starts stay cheap).
+type AppConfigSource struct {
+	HTTPClient  *http.Client
+	Endpoint    string
+	Application string
+	Environment string
+	Profile     string
+}
+
+func (s *AppConfigSource) Fetch(ctx context.Context) ([]byte, error) {
+	endpoint := fmt.Sprintf("%s/applications/%s/environments/%s/configurations/%s",
+		strings.TrimSuffix(s.Endpoint, "/"), url.PathEscape(s.Application), url.PathEscape(s.Environment),
+		url.PathEscape(s.Profile))
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("unable to build the AppConfig request: %w", err)
+	}
+
+	resp, err := s.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach the AppConfig extension at %s: %w", s.Endpoint, err)
+	}
+
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read the AppConfig configuration: %w", err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("AppConfig extension responded with status %d: %s", resp.StatusCode,
+			strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+func (s *AppConfigSource) Name() string {
+	return fmt.Sprintf("AppConfig profile %s/%s/%s", s.Application, s.Environment, s.Profile)
+}
+
+// NewAppConfigSource builds the source of the given application/environment/profile. The
+// extension listens on the given port, or on the default one if it's empty.
+func NewAppConfigSource(profile, port string) (Source, error) {
+	parts := strings.Split(profile, "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		return nil, erroer.NewConfigurationError(fmt.Sprintf(
+			"AppConfig profile %s must be set as application/environment/profile", profile), nil)
+	}
+
+	endpoint := DefaultAppConfigEndpoint
+	if port != "" {
+		endpoint = fmt.Sprintf("http://localhost:%s", port)
+	}
+
+	return &AppConfigSource{
+		HTTPClient:  &http.Client{Timeout: 10 * time.Second},
+		Endpoint:    endpoint,
+		Application: parts[0],
+		Environment: parts[1],
+		Profile:     parts[2],
+	}, nil
+}
@@ -0,0 +1,58 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Credentials is the JSON structure of a secret that holds database credentials. It follows
+// the same structure used by the AWS managed rotation templates.
+type Credentials struct {
+	Engine   string `json:"engine,omitempty"`
+	Host     string `json:"host"`
+	Port     int    `json:"port,omitempty"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	DBName   string `json:"dbname,omitempty"`
+	SSLMode  string `json:"sslmode,omitempty"`
+	// MasterARN is the ARN of the secret holding the credentials of a user that can manage
+	// other users. It's only used by the alternating-users rotation.
+	MasterARN string `json:"masterarn,omitempty"`
+}
+
+// Driver performs the database operations required to rotate a database credential.
+type Driver interface {
+	// Ping checks that it's possible to log in with the given credentials.
+	Ping(ctx context.Context, creds Credentials) error
+	// SetPassword logs in with the given credentials, and changes the password of the given user.
+	SetPassword(ctx context.Context, creds Credentials, username, password string) error
+	// UserExists logs in with the given credentials, and checks if the given user exists.
+	UserExists(ctx context.Context, creds Credentials, username string) (bool, error)
+	// CreateUser logs in with the given credentials, and creates a login user with the given
+	// password. The new user is granted the same roles as the template user.
+	CreateUser(ctx context.Context, creds Credentials, username, password, templateUser string) error
+}
+
+// ParseCredentials parses a secret value into database credentials, and validates that the
+// fields required to log in are present.
+func ParseCredentials(secretValue string) (Credentials, error) {
+	var creds Credentials
+	if err := json.Unmarshal([]byte(secretValue), &creds); err != nil {
+		return Credentials{}, fmt.Errorf("secret value is not a valid database credential JSON: %w", err)
+	}
+
+	if creds.Host == "" {
+		return Credentials{}, fmt.Errorf("database credential has no host")
+	}
+
+	if creds.Username == "" {
+		return Credentials{}, fmt.Errorf("database credential has no username")
+	}
+
+	if creds.Password == "" {
+		return Credentials{}, fmt.Errorf("database credential has no password")
+	}
+
+	return creds, nil
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/lib/pq"
+	"net"
+	"net/url"
+	"strconv"
+)
+
+const (
+	postgresDefaultPort    = 5432
+	postgresDefaultDBName  = "postgres"
+	postgresDefaultSSLMode = "require"
+)
+
+type PostgresDriver struct{}
+
+func (p *PostgresDriver) Ping(ctx context.Context, creds Credentials) error {
+	db, err := p.open(creds)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("unable to log in into postgres %s as user %s: %w", creds.Host,
+			creds.Username, err)
+	}
+
+	return nil
+}
+
+func (p *PostgresDriver) SetPassword(ctx context.Context, creds Credentials, username,
+	password string) error {
+	db, err := p.open(creds)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	// ALTER ROLE doesn't support bind parameters, so both the role and the password are quoted
+	// instead.
+	statement := fmt.Sprintf("ALTER ROLE %s WITH PASSWORD %s", pq.QuoteIdentifier(username),
+		pq.QuoteLiteral(password))
+
+	if _, err := db.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("unable to set the password of postgres user %s: %w", username, err)
+	}
+
+	return nil
+}
+
+func (p *PostgresDriver) UserExists(ctx context.Context, creds Credentials, username string) (bool,
+	error) {
+	db, err := p.open(creds)
+	if err != nil {
+		return false, err
+	}
+
+	defer db.Close()
+
+	var exists bool
+	if err := db.QueryRowContext(ctx, "SELECT EXISTS (SELECT 1 FROM pg_roles WHERE rolname = $1)",
+		username).Scan(&exists); err != nil {
+		return false, fmt.Errorf("unable to check if postgres user %s exists: %w", username, err)
+	}
+
+	return exists, nil
+}
+
+func (p *PostgresDriver) CreateUser(ctx context.Context, creds Credentials, username, password,
+	templateUser string) error {
+	db, err := p.open(creds)
+	if err != nil {
+		return err
+	}
+
+	defer db.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("unable to start a transaction to create postgres user %s: %w", username, err)
+	}
+
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	statement := fmt.Sprintf("CREATE ROLE %s WITH LOGIN PASSWORD %s", pq.QuoteIdentifier(username),
+		pq.QuoteLiteral(password))
+	if _, err := tx.ExecContext(ctx, statement); err != nil {
+		return fmt.Errorf("unable to create postgres user %s: %w", username, err)
+	}
+
+	rows, err := tx.QueryContext(ctx, "SELECT r.rolname FROM pg_auth_members m "+
+		"JOIN pg_roles r ON r.oid = m.roleid "+
+		"JOIN pg_roles u ON u.oid = m.member WHERE u.rolname = $1", templateUser)
+	if err != nil {
+		return fmt.Errorf("unable to list the roles of postgres user %s: %w", templateUser, err)
+	}
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		if err := rows.Scan(&role); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("unable to list the roles of postgres user %s: %w", templateUser, err)
+		}
+
+		roles = append(roles, role)
+	}
+
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("unable to list the roles of postgres user %s: %w", templateUser, err)
+	}
+
+	// The template user is granted as well, so the new user can access the objects it owns.
+	roles = append(roles, templateUser)
+	for _, role := range roles {
+		statement := fmt.Sprintf("GRANT %s TO %s", pq.QuoteIdentifier(role),
+			pq.QuoteIdentifier(username))
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("unable to grant role %s to postgres user %s: %w", role, username, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("unable to create postgres user %s: %w", username, err)
+	}
+
+	return nil
+}
+
+func (p *PostgresDriver) open(creds Credentials) (*sql.DB, error) {
+	db, err := sql.Open("postgres", PostgresDSN(creds))
+	if err != nil {
+		return nil, fmt.Errorf("unable to open a postgres connection to %s: %w", creds.Host, err)
+	}
+
+	return db, nil
+}
+
+// PostgresDSN builds the connection URL for the given credentials, using the postgres
+// defaults for the fields that aren't set.
+func PostgresDSN(creds Credentials) string {
+	port := creds.Port
+	if port == 0 {
+		port = postgresDefaultPort
+	}
+
+	dbName := creds.DBName
+	if dbName == "" {
+		dbName = postgresDefaultDBName
+	}
+
+	sslMode := creds.SSLMode
+	if sslMode == "" {
+		sslMode = postgresDefaultSSLMode
+	}
+
+	query := url.Values{}
+	query.Set("sslmode", sslMode)
+	query.Set("connect_timeout", "5")
+
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(creds.Username, creds.Password),
+		Host:     net.JoinHostPort(creds.Host, strconv.Itoa(port)),
+		Path:     "/" + dbName,
+		RawQuery: query.Encode(),
+	}
+
+	return dsn.String()
+}
+
+func NewPostgresDriver() Driver {
+	return &PostgresDriver{}
+}
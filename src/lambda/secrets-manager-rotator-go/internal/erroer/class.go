@@ -0,0 +1,34 @@
+package erroer
+
+import "errors"
+
+const (
+	ClassConfiguration = "configuration"
+	ClassValidation    = "validation"
+	ClassSecret        = "secret"
+	ClassRotation      = "rotation"
+	ClassUnknown       = "unknown"
+)
+
+// Class returns the class of the outermost rotator error wrapped in err, or ClassUnknown if
+// there's none. It's empty if err is nil.
+func Class(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	for e := err; e != nil; e = errors.Unwrap(e) {
+		switch e.(type) {
+		case *RotatorConfigurationError:
+			return ClassConfiguration
+		case *RotatorValidationError:
+			return ClassValidation
+		case *SecretError:
+			return ClassSecret
+		case *RotationError:
+			return ClassRotation
+		}
+	}
+
+	return ClassUnknown
+}
@@ -20,3 +20,7 @@ func NewConfigurationError(details string, err error) *RotatorConfigurationError
 		Err:     err,
 	}
 }
+
+func (e *RotatorConfigurationError) Unwrap() error {
+	return e.Err
+}
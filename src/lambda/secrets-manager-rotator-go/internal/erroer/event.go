@@ -0,0 +1,47 @@
+package erroer
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Reasons why an invocation payload is rejected. They're wrapped by EventError, so callers can
+// check them with errors.Is.
+var (
+	ErrEventMalformed     = errors.New("malformed payload")
+	ErrEventFieldMissing  = errors.New("required field is missing")
+	ErrEventUnknownStep   = errors.New("unknown step")
+	ErrEventUnknownAction = errors.New("unknown action")
+)
+
+// EventError is an invalid invocation payload. Field is the offending field (e.g.: Step), or
+// empty if the payload as a whole is invalid.
+type EventError struct {
+	Field   string
+	Details string
+	Err     error
+}
+
+func (e *EventError) Error() string {
+	details := e.Details
+	if e.Field != "" {
+		details = fmt.Sprintf("field %s: %s", e.Field, e.Details)
+	}
+
+	if e.Err != nil {
+		return fmt.Sprintf("Rotator lambda event error: %s: %s", details, e.Err.Error())
+	}
+	return fmt.Sprintf("Rotator lambda event error: %s", details)
+}
+
+func (e *EventError) Unwrap() error {
+	return e.Err
+}
+
+func NewEventError(field, details string, err error) *EventError {
+	return &EventError{
+		Field:   field,
+		Details: details,
+		Err:     err,
+	}
+}
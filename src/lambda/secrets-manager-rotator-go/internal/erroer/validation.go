@@ -20,3 +20,7 @@ func NewValidationError(details string, err error) *RotatorValidationError {
 		Err:     err,
 	}
 }
+
+func (e *RotatorValidationError) Unwrap() error {
+	return e.Err
+}
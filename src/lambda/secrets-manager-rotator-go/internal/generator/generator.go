@@ -0,0 +1,181 @@
+package generator
+
+import (
+	"context"
+	"crypto/rand"
+	_ "embed"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strings"
+)
+
+const (
+	upperChars  = "ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+	lowerChars  = "abcdefghijklmnopqrstuvwxyz"
+	digitChars  = "0123456789"
+	symbolChars = "!\"#$%&'()*+,-./:;<=>?@[\\]^_`{|}~"
+)
+
+// effShortWordList is the EFF short word list (2.0), from
+// https://www.eff.org/files/2016/09/08/eff_short_wordlist_2_0.txt
+//
+//go:embed eff_short_wordlist.txt
+var effShortWordList string
+
+var wordList = strings.Fields(effShortWordList)
+
+func isWordListed(word string) bool {
+	i := sort.SearchStrings(wordList, word)
+	return i < len(wordList) && wordList[i] == word
+}
+
+// Generator generates new secret values.
+type Generator interface {
+	Generate(ctx context.Context, policy Policy) (string, error)
+}
+
+// CryptoGenerator generates the values locally, reading the randomness from Reader
+// (crypto/rand, unless it's replaced).
+type CryptoGenerator struct {
+	Reader io.Reader
+}
+
+func (g *CryptoGenerator) Generate(ctx context.Context, policy Policy) (string, error) {
+	policy = policy.WithDefaults()
+	if err := policy.Validate(); err != nil {
+		return "", fmt.Errorf("invalid generation policy: %w", err)
+	}
+
+	switch policy.Format {
+	case FormatHex:
+		token, err := g.randomBytes(policy.Length)
+		if err != nil {
+			return "", err
+		}
+
+		return hex.EncodeToString(token), nil
+	case FormatBase64:
+		token, err := g.randomBytes(policy.Length)
+		if err != nil {
+			return "", err
+		}
+
+		return base64.RawURLEncoding.EncodeToString(token), nil
+	case FormatUUID:
+		return g.uuid()
+	case FormatPassphrase:
+		return g.passphrase(policy)
+	}
+
+	return g.password(policy)
+}
+
+func (g *CryptoGenerator) password(policy Policy) (string, error) {
+	var password []rune
+
+	// One character of each required class first, and then the rest from the whole alphabet.
+	for _, class := range policy.requiredClasses() {
+		char, err := g.pick(removeCharacters(class, policy.ExcludeCharacters))
+		if err != nil {
+			return "", err
+		}
+
+		password = append(password, char)
+	}
+
+	alphabet := policy.alphabet()
+	for len(password) < policy.Length {
+		char, err := g.pick(alphabet)
+		if err != nil {
+			return "", err
+		}
+
+		password = append(password, char)
+	}
+
+	// Shuffle (Fisher-Yates), so the required characters aren't always at the beginning.
+	for i := len(password) - 1; i > 0; i-- {
+		j, err := g.intn(i + 1)
+		if err != nil {
+			return "", err
+		}
+
+		password[i], password[j] = password[j], password[i]
+	}
+
+	return string(password), nil
+}
+
+func (g *CryptoGenerator) passphrase(policy Policy) (string, error) {
+	words := make([]string, 0, policy.Length)
+	for len(words) < policy.Length {
+		i, err := g.intn(len(wordList))
+		if err != nil {
+			return "", err
+		}
+
+		words = append(words, wordList[i])
+	}
+
+	return strings.Join(words, policy.Separator), nil
+}
+
+func (g *CryptoGenerator) uuid() (string, error) {
+	id, err := g.randomBytes(16)
+	if err != nil {
+		return "", err
+	}
+
+	id[6] = (id[6] & 0x0f) | 0x40 // version 4
+	id[8] = (id[8] & 0x3f) | 0x80 // variant 10
+
+	return fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:]), nil
+}
+
+func (g *CryptoGenerator) pick(chars []rune) (rune, error) {
+	i, err := g.intn(len(chars))
+	if err != nil {
+		return 0, err
+	}
+
+	return chars[i], nil
+}
+
+func (g *CryptoGenerator) intn(n int) (int, error) {
+	i, err := rand.Int(g.Reader, big.NewInt(int64(n)))
+	if err != nil {
+		return 0, fmt.Errorf("unable to read random data: %w", err)
+	}
+
+	return int(i.Int64()), nil
+}
+
+func (g *CryptoGenerator) randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	if _, err := io.ReadFull(g.Reader, b); err != nil {
+		return nil, fmt.Errorf("unable to read random data: %w", err)
+	}
+
+	return b, nil
+}
+
+func removeCharacters(chars, exclude string) []rune {
+	var result []rune
+	for _, char := range chars {
+		if !strings.ContainsRune(exclude, char) {
+			result = append(result, char)
+		}
+	}
+
+	return result
+}
+
+func NewGenerator() Generator {
+	return &CryptoGenerator{
+		Reader: rand.Reader,
+	}
+}
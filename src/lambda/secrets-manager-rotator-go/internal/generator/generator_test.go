@@ -0,0 +1,129 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/stretchr/testify/assert"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestGeneratePassword(t *testing.T) {
+	ctx := context.Background()
+
+	g := NewGenerator()
+
+	t.Run("DefaultPolicy", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			password, err := g.Generate(ctx, DefaultPolicy())
+			assert.NoError(t, err)
+			assert.Len(t, password, DefaultPasswordLength)
+			assert.True(t, strings.ContainsAny(password, upperChars))
+			assert.True(t, strings.ContainsAny(password, lowerChars))
+			assert.True(t, strings.ContainsAny(password, digitChars))
+			assert.True(t, strings.ContainsAny(password, removeExcluded(symbolChars, DefaultExcludeCharacters)))
+			assert.False(t, strings.ContainsAny(password, DefaultExcludeCharacters))
+		}
+	})
+
+	t.Run("ExcludedClass", func(t *testing.T) {
+		password, err := g.Generate(ctx, Policy{
+			Format:            FormatPassword,
+			Length:            16,
+			RequireDigits:     true,
+			ExcludeCharacters: upperChars + lowerChars + symbolChars,
+		})
+		assert.NoError(t, err)
+		assert.Regexp(t, regexp.MustCompile(`^[0-9]{16}$`), password)
+	})
+
+	t.Run("InvalidPolicies", func(t *testing.T) {
+		_, err := g.Generate(ctx, Policy{Format: FormatPassword, Length: 2, RequireUppercase: true,
+			RequireLowercase: true, RequireDigits: true})
+		assert.Error(t, err, "length shorter than the required classes")
+
+		_, err = g.Generate(ctx, Policy{Format: FormatPassword, Length: 8, RequireDigits: true,
+			ExcludeCharacters: digitChars})
+		assert.Error(t, err, "required class fully excluded")
+
+		_, err = g.Generate(ctx, Policy{Format: "emoji"})
+		assert.Error(t, err, "unsupported format")
+	})
+}
+
+func TestGenerateTokens(t *testing.T) {
+	ctx := context.Background()
+
+	g := NewGenerator()
+
+	token, err := g.Generate(ctx, Policy{Format: FormatHex, Length: 16})
+	assert.NoError(t, err)
+	decoded, err := hex.DecodeString(token)
+	assert.NoError(t, err)
+	assert.Len(t, decoded, 16)
+
+	token, err = g.Generate(ctx, Policy{Format: FormatBase64})
+	assert.NoError(t, err)
+	decoded, err = base64.RawURLEncoding.DecodeString(token)
+	assert.NoError(t, err)
+	assert.Len(t, decoded, DefaultTokenBytes)
+}
+
+func TestGenerateUUID(t *testing.T) {
+	ctx := context.Background()
+
+	g := &CryptoGenerator{Reader: bytes.NewReader(bytes.Repeat([]byte{0xff}, 16))}
+
+	id, err := g.Generate(ctx, Policy{Format: FormatUUID})
+	assert.NoError(t, err)
+	assert.Equal(t, "ffffffff-ffff-4fff-bfff-ffffffffffff", id)
+}
+
+func TestGeneratePassphrase(t *testing.T) {
+	ctx := context.Background()
+
+	g := NewGenerator()
+
+	passphrase, err := g.Generate(ctx, Policy{Format: FormatPassphrase, Length: 5, Separator: " "})
+	assert.NoError(t, err)
+
+	words := strings.Split(passphrase, " ")
+	assert.Len(t, words, 5)
+	for _, word := range words {
+		assert.Contains(t, wordList, word)
+	}
+
+	assert.Len(t, wordList, 1296)
+}
+
+func removeExcluded(chars, exclude string) string {
+	return string(removeCharacters(chars, exclude))
+}
+
+func TestPolicyCheck(t *testing.T) {
+	ctx := context.Background()
+
+	g := NewGenerator()
+
+	for _, policy := range []Policy{
+		DefaultPolicy(),
+		{Format: FormatHex},
+		{Format: FormatBase64, Length: 12},
+		{Format: FormatUUID},
+		{Format: FormatPassphrase, Length: 4},
+	} {
+		value, err := g.Generate(ctx, policy)
+		assert.NoError(t, err)
+		assert.NoError(t, policy.Check(value), "generated %s value should satisfy its policy", policy.Format)
+	}
+
+	assert.Error(t, DefaultPolicy().Check("short"))
+	assert.Error(t, DefaultPolicy().Check(strings.Repeat("aA1!", 7)+"aA1/"), "excluded character")
+	assert.Error(t, DefaultPolicy().Check(strings.Repeat("aA1b", 8)), "missing symbol")
+	assert.Error(t, Policy{Format: FormatHex, Length: 4}.Check("zzzzzzzz"))
+	assert.Error(t, Policy{Format: FormatUUID}.Check("not-a-uuid"))
+	assert.Error(t, Policy{Format: FormatPassphrase, Length: 2}.Check("aardvark-notaword"))
+}
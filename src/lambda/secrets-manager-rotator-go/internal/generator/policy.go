@@ -0,0 +1,240 @@
+package generator
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+type Format string
+
+const (
+	// FormatPassword is a random password built from the upper, lower, digit and symbol
+	// character classes.
+	FormatPassword Format = "password"
+	// FormatHex is a random token, hex encoded.
+	FormatHex Format = "hex"
+	// FormatBase64 is a random token, encoded with the (unpadded) URL-safe base64 alphabet.
+	FormatBase64 Format = "base64"
+	// FormatUUID is a random (version 4) UUID.
+	FormatUUID Format = "uuid"
+	// FormatPassphrase is a diceware-style passphrase, built from the EFF short word list.
+	FormatPassphrase Format = "passphrase"
+)
+
+var Formats = []Format{FormatPassword, FormatHex, FormatBase64, FormatUUID, FormatPassphrase}
+
+// DefaultExcludeCharacters are the characters that are left out of the generated passwords,
+// since they tend to break connection strings and shell commands.
+const DefaultExcludeCharacters = "/@'\"\\"
+
+const (
+	DefaultPasswordLength   = 32
+	DefaultTokenBytes       = 32
+	DefaultPassphraseWords  = 8
+	DefaultPassphraseSpacer = "-"
+)
+
+// Policy describes the values to generate. Length means the number of characters for
+// passwords, the number of random bytes for hex and base64 tokens, and the number of words
+// for passphrases. It's ignored for UUIDs.
+type Policy struct {
+	Format            Format
+	Length            int
+	RequireUppercase  bool
+	RequireLowercase  bool
+	RequireDigits     bool
+	RequireSymbols    bool
+	ExcludeCharacters string
+	Separator         string
+}
+
+// DefaultPolicy returns the policy used when nothing else is configured: a 32 characters
+// password, with at least one character of each class.
+func DefaultPolicy() Policy {
+	return Policy{
+		Format:            FormatPassword,
+		Length:            DefaultPasswordLength,
+		RequireUppercase:  true,
+		RequireLowercase:  true,
+		RequireDigits:     true,
+		RequireSymbols:    true,
+		ExcludeCharacters: DefaultExcludeCharacters,
+	}
+}
+
+// WithDefaults returns a copy of the policy, with the unset fields filled with the defaults
+// of its format.
+func (p Policy) WithDefaults() Policy {
+	if p.Format == "" {
+		p.Format = FormatPassword
+	}
+
+	if p.Length == 0 {
+		switch p.Format {
+		case FormatPassword:
+			p.Length = DefaultPasswordLength
+		case FormatHex, FormatBase64:
+			p.Length = DefaultTokenBytes
+		case FormatPassphrase:
+			p.Length = DefaultPassphraseWords
+		}
+	}
+
+	if p.Format == FormatPassphrase && p.Separator == "" {
+		p.Separator = DefaultPassphraseSpacer
+	}
+
+	return p
+}
+
+// Validate checks that it's possible to generate values with this policy.
+func (p Policy) Validate() error {
+	if !IsFormatSupported(p.Format) {
+		return fmt.Errorf("format %s is not supported", p.Format)
+	}
+
+	if p.Format == FormatUUID {
+		return nil
+	}
+
+	if p.Length <= 0 {
+		return fmt.Errorf("length must be greater than zero, got %d", p.Length)
+	}
+
+	if p.Format != FormatPassword {
+		return nil
+	}
+
+	required := 0
+	for _, class := range p.requiredClasses() {
+		if len(removeCharacters(class, p.ExcludeCharacters)) == 0 {
+			return fmt.Errorf("all the characters of a required class are excluded: %s", class)
+		}
+
+		required++
+	}
+
+	if p.Length < required {
+		return fmt.Errorf("length %d is too short to include the %d required character classes",
+			p.Length, required)
+	}
+
+	if len(p.alphabet()) == 0 {
+		return fmt.Errorf("all the characters are excluded")
+	}
+
+	return nil
+}
+
+// Check verifies that the given value could have been generated with this policy. The errors
+// never include the value itself.
+func (p Policy) Check(value string) error {
+	p = p.WithDefaults()
+
+	switch p.Format {
+	case FormatHex:
+		decoded, err := hex.DecodeString(value)
+		if err != nil || len(decoded) != p.Length {
+			return fmt.Errorf("value is not a hex encoded token of %d bytes", p.Length)
+		}
+
+		return nil
+	case FormatBase64:
+		decoded, err := base64.RawURLEncoding.DecodeString(value)
+		if err != nil || len(decoded) != p.Length {
+			return fmt.Errorf("value is not a base64 encoded token of %d bytes", p.Length)
+		}
+
+		return nil
+	case FormatUUID:
+		if !uuidPattern.MatchString(value) {
+			return fmt.Errorf("value is not a UUID")
+		}
+
+		return nil
+	case FormatPassphrase:
+		words := strings.Split(value, p.Separator)
+		if len(words) != p.Length {
+			return fmt.Errorf("passphrase has %d words, expected %d", len(words), p.Length)
+		}
+
+		for i, word := range words {
+			if !isWordListed(word) {
+				return fmt.Errorf("passphrase word %d is not in the word list", i+1)
+			}
+		}
+
+		return nil
+	case FormatPassword:
+		return p.checkPassword(value)
+	}
+
+	return fmt.Errorf("format %s is not supported", p.Format)
+}
+
+func (p Policy) checkPassword(value string) error {
+	if length := utf8.RuneCountInString(value); length != p.Length {
+		return fmt.Errorf("password has %d characters, expected %d", length, p.Length)
+	}
+
+	if strings.ContainsAny(value, p.ExcludeCharacters) {
+		return fmt.Errorf("password contains excluded characters")
+	}
+
+	for _, class := range p.requiredClasses() {
+		if !strings.ContainsAny(value, class) {
+			return fmt.Errorf("password is missing a character of a required class")
+		}
+	}
+
+	alphabet := string(p.alphabet())
+	for _, char := range value {
+		if !strings.ContainsRune(alphabet, char) {
+			return fmt.Errorf("password contains characters out of the allowed alphabet")
+		}
+	}
+
+	return nil
+}
+
+func (p Policy) requiredClasses() []string {
+	var classes []string
+	if p.RequireUppercase {
+		classes = append(classes, upperChars)
+	}
+
+	if p.RequireLowercase {
+		classes = append(classes, lowerChars)
+	}
+
+	if p.RequireDigits {
+		classes = append(classes, digitChars)
+	}
+
+	if p.RequireSymbols {
+		classes = append(classes, symbolChars)
+	}
+
+	return classes
+}
+
+// alphabet returns every character a password can be built from.
+func (p Policy) alphabet() []rune {
+	return removeCharacters(upperChars+lowerChars+digitChars+symbolChars, p.ExcludeCharacters)
+}
+
+func IsFormatSupported(format Format) bool {
+	for _, f := range Formats {
+		if f == format {
+			return true
+		}
+	}
+
+	return false
+}
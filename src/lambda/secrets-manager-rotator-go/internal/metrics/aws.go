@@ -0,0 +1,31 @@
+package metrics
+
+import (
+	"context"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/smithy-go/middleware"
+	"time"
+)
+
+// RecordAPICalls is an APIOptions function of the AWS clients that records the latency of
+// each operation (including its retries), and how many times it was retried, to the recorder
+// of the request context.
+func RecordAPICalls(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("RecordAPICalls",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+			middleware.InitializeOutput, middleware.Metadata, error) {
+			started := time.Now()
+			out, metadata, err := next.HandleInitialize(ctx, in)
+
+			dimensions := map[string]string{DimensionOperation: awsmiddleware.GetOperationName(ctx)}
+			Record(ctx, APILatency, float64(time.Since(started).Milliseconds()), UnitMilliseconds,
+				dimensions)
+
+			if attempts, ok := retry.GetAttemptResults(metadata); ok && len(attempts.Results) > 0 {
+				Record(ctx, APIRetries, float64(len(attempts.Results)-1), UnitCount, dimensions)
+			}
+
+			return out, metadata, err
+		}), middleware.After)
+}
@@ -0,0 +1,103 @@
+package metrics
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultNamespace is the CloudWatch namespace of the metrics, unless another one is configured.
+const DefaultNamespace = "SecretsManagerRotator"
+
+// EMFRecorder writes each datapoint as a CloudWatch Embedded Metric Format (EMF) log line. The
+// Lambda runtime sends stdout to CloudWatch Logs, which extracts the metrics from those lines.
+type EMFRecorder struct {
+	Writer    io.Writer
+	Namespace string
+	// Now returns the timestamp of the datapoints. It defaults to time.Now.
+	Now func() time.Time
+
+	mu sync.Mutex
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit"`
+}
+
+// Record writes the datapoint. It's aggregated by all its dimensions, and also without any
+// dimension, so alarms can watch the metric as a whole. Write failures are ignored, since
+// metrics must never fail a rotation.
+func (r *EMFRecorder) Record(_ context.Context, datapoint Datapoint) {
+	line, err := r.encode(datapoint)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, _ = r.Writer.Write(append(line, '\n'))
+}
+
+func (r *EMFRecorder) encode(datapoint Datapoint) ([]byte, error) {
+	now := time.Now
+	if r.Now != nil {
+		now = r.Now
+	}
+
+	namespace := r.Namespace
+	if namespace == "" {
+		namespace = DefaultNamespace
+	}
+
+	keys := make([]string, 0, len(datapoint.Dimensions))
+	for key := range datapoint.Dimensions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	dimensionSets := [][]string{{}}
+	if len(keys) > 0 {
+		dimensionSets = [][]string{keys, {}}
+	}
+
+	document := map[string]interface{}{
+		"_aws": emfMetadata{
+			Timestamp: now().UnixMilli(),
+			CloudWatchMetrics: []emfDirective{{
+				Namespace:  namespace,
+				Dimensions: dimensionSets,
+				Metrics:    []emfMetric{{Name: datapoint.Name, Unit: datapoint.Unit}},
+			}},
+		},
+		datapoint.Name: datapoint.Value,
+	}
+
+	for key, value := range datapoint.Dimensions {
+		document[key] = value
+	}
+
+	return json.Marshal(document)
+}
+
+func NewEMFRecorder(w io.Writer, namespace string) *EMFRecorder {
+	return &EMFRecorder{
+		Writer:    w,
+		Namespace: namespace,
+	}
+}
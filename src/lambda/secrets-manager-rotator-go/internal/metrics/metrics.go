@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"context"
+	"sync"
+)
+
+type Unit string
+
+const (
+	UnitMilliseconds Unit = "Milliseconds"
+	UnitSeconds      Unit = "Seconds"
+	UnitCount        Unit = "Count"
+)
+
+// Names of the metrics emitted by the rotator.
+const (
+	StepDuration          = "StepDuration"
+	StepSucceeded         = "StepSucceeded"
+	StepFailed            = "StepFailed"
+	APILatency            = "SecretsManagerAPILatency"
+	APIRetries            = "SecretsManagerAPIRetries"
+	TimeSinceLastRotation = "TimeSinceLastRotation"
+)
+
+// Names of the dimensions of the metrics.
+const (
+	DimensionStep       = "step"
+	DimensionStrategy   = "strategy"
+	DimensionErrorClass = "error_class"
+	DimensionOperation  = "operation"
+)
+
+// Datapoint is a single value of a metric.
+type Datapoint struct {
+	Name       string
+	Value      float64
+	Unit       Unit
+	Dimensions map[string]string
+}
+
+// Recorder records the metrics of the rotator.
+type Recorder interface {
+	Record(ctx context.Context, datapoint Datapoint)
+}
+
+// NopRecorder discards every datapoint.
+type NopRecorder struct{}
+
+func (NopRecorder) Record(context.Context, Datapoint) {}
+
+// InMemoryRecorder keeps every datapoint, so tests can assert on them.
+type InMemoryRecorder struct {
+	mu         sync.Mutex
+	datapoints []Datapoint
+}
+
+func (r *InMemoryRecorder) Record(_ context.Context, datapoint Datapoint) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.datapoints = append(r.datapoints, datapoint)
+}
+
+// Datapoints returns the recorded datapoints, in order.
+func (r *InMemoryRecorder) Datapoints() []Datapoint {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Datapoint(nil), r.datapoints...)
+}
+
+// Find returns the recorded datapoints of the given metric, in order.
+func (r *InMemoryRecorder) Find(name string) []Datapoint {
+	var found []Datapoint
+	for _, datapoint := range r.Datapoints() {
+		if datapoint.Name == name {
+			found = append(found, datapoint)
+		}
+	}
+
+	return found
+}
+
+type recorderKey struct{}
+
+// WithRecorder returns a context that carries the recorder, so the code that handles the
+// request (including the middleware of the AWS clients) records to it.
+func WithRecorder(ctx context.Context, recorder Recorder) context.Context {
+	return context.WithValue(ctx, recorderKey{}, recorder)
+}
+
+// FromContext returns the recorder of the context, or a NopRecorder if there's none.
+func FromContext(ctx context.Context) Recorder {
+	if recorder, ok := ctx.Value(recorderKey{}).(Recorder); ok && recorder != nil {
+		return recorder
+	}
+
+	return NopRecorder{}
+}
+
+// Record records a datapoint to the recorder of the context.
+func Record(ctx context.Context, name string, value float64, unit Unit, dimensions map[string]string) {
+	FromContext(ctx).Record(ctx, Datapoint{Name: name, Value: value, Unit: unit, Dimensions: dimensions})
+}
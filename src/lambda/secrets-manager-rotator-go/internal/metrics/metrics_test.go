@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEMFRecorder(t *testing.T) {
+	var out bytes.Buffer
+	recorder := NewEMFRecorder(&out, "Rotator")
+	recorder.Now = func() time.Time {
+		return time.UnixMilli(1700000000000)
+	}
+
+	recorder.Record(context.Background(), Datapoint{
+		Name:  StepFailed,
+		Value: 1,
+		Unit:  UnitCount,
+		Dimensions: map[string]string{
+			DimensionStrategy:   "static",
+			DimensionStep:       "createSecret",
+			DimensionErrorClass: "rotation",
+		},
+	})
+
+	assert.JSONEq(t, `{
+		"_aws": {
+			"Timestamp": 1700000000000,
+			"CloudWatchMetrics": [{
+				"Namespace": "Rotator",
+				"Dimensions": [["error_class", "step", "strategy"], []],
+				"Metrics": [{"Name": "StepFailed", "Unit": "Count"}]
+			}]
+		},
+		"error_class": "rotation",
+		"step": "createSecret",
+		"strategy": "static",
+		"StepFailed": 1
+	}`, out.String())
+	assert.True(t, strings.HasSuffix(out.String(), "\n"))
+}
+
+func TestEMFRecorderWithoutDimensions(t *testing.T) {
+	var out bytes.Buffer
+	NewEMFRecorder(&out, "").Record(context.Background(), Datapoint{Name: APILatency, Value: 12,
+		Unit: UnitMilliseconds})
+
+	var document map[string]interface{}
+	assert.NoError(t, json.Unmarshal(out.Bytes(), &document))
+
+	directive := document["_aws"].(map[string]interface{})["CloudWatchMetrics"].([]interface{})[0]
+	assert.Equal(t, DefaultNamespace, directive.(map[string]interface{})["Namespace"])
+	assert.Equal(t, []interface{}{[]interface{}{}}, directive.(map[string]interface{})["Dimensions"])
+	assert.Equal(t, float64(12), document[APILatency])
+}
+
+func TestFromContext(t *testing.T) {
+	assert.Equal(t, NopRecorder{}, FromContext(context.Background()))
+
+	recorder := &InMemoryRecorder{}
+	ctx := WithRecorder(context.Background(), recorder)
+	Record(ctx, StepSucceeded, 1, UnitCount, map[string]string{DimensionStep: "setSecret"})
+
+	assert.Equal(t, []Datapoint{{
+		Name:       StepSucceeded,
+		Value:      1,
+		Unit:       UnitCount,
+		Dimensions: map[string]string{DimensionStep: "setSecret"},
+	}}, recorder.Datapoints())
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestRecordAPICalls(t *testing.T) {
+	calls := 0
+	httpClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		calls++
+		if calls == 1 {
+			return &http.Response{
+				StatusCode: http.StatusServiceUnavailable,
+				Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.1"}},
+				Body:       io.NopCloser(strings.NewReader(`{"__type":"ServiceUnavailable"}`)),
+				Request:    req,
+			}, nil
+		}
+
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": []string{"application/x-amz-json-1.1"}},
+			Body:       io.NopCloser(strings.NewReader(`{"ARN":"arn","Name":"name"}`)),
+			Request:    req,
+		}, nil
+	})}
+
+	api := secretsmanager.NewFromConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("test", "test", ""),
+		HTTPClient:  httpClient,
+	}, func(o *secretsmanager.Options) {
+		o.APIOptions = append(o.APIOptions, RecordAPICalls)
+		o.Retryer = retry.NewStandard(func(o *retry.StandardOptions) {
+			o.Backoff = retry.BackoffDelayerFunc(func(int, error) (time.Duration, error) {
+				return 0, nil
+			})
+		})
+	})
+
+	recorder := &InMemoryRecorder{}
+	_, err := api.DescribeSecret(WithRecorder(context.Background(), recorder),
+		&secretsmanager.DescribeSecretInput{SecretId: aws.String("name")})
+	assert.NoError(t, err)
+
+	if latencies := recorder.Find(APILatency); assert.Len(t, latencies, 1) {
+		assert.Equal(t, map[string]string{DimensionOperation: "DescribeSecret"}, latencies[0].Dimensions)
+		assert.Equal(t, UnitMilliseconds, latencies[0].Unit)
+	}
+
+	if retries := recorder.Find(APIRetries); assert.Len(t, retries, 1) {
+		assert.Equal(t, float64(1), retries[0].Value)
+	}
+}
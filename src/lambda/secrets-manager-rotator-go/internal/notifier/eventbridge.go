@@ -0,0 +1,62 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+)
+
+const (
+	EventBridgeSource     = "secrets-manager-rotator"
+	EventBridgeDetailType = "Secret Rotation Outcome"
+)
+
+type EventBridgePutter interface {
+	PutEvents(ctx context.Context, params *eventbridge.PutEventsInput,
+		optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error)
+}
+
+// EventBridgeNotifier puts the events in an EventBridge bus, with EventBridgeSource as source
+// and EventBridgeDetailType as detail type.
+type EventBridgeNotifier struct {
+	Client  EventBridgePutter
+	BusName string
+}
+
+func (n *EventBridgeNotifier) Notify(ctx context.Context, event Event) error {
+	detail, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to encode the rotation event: %w", err)
+	}
+
+	output, err := n.Client.PutEvents(ctx, &eventbridge.PutEventsInput{
+		Entries: []types.PutEventsRequestEntry{{
+			EventBusName: aws.String(n.BusName),
+			Source:       aws.String(EventBridgeSource),
+			DetailType:   aws.String(EventBridgeDetailType),
+			Detail:       aws.String(string(detail)),
+			Resources:    []string{event.SecretArn},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to put the rotation event in bus %s: %w", n.BusName, err)
+	}
+
+	// PutEvents doesn't fail when an entry is rejected, it's reported in the output instead.
+	if output.FailedEntryCount > 0 && len(output.Entries) > 0 {
+		return fmt.Errorf("the rotation event was rejected by bus %s: %s: %s", n.BusName,
+			aws.ToString(output.Entries[0].ErrorCode), aws.ToString(output.Entries[0].ErrorMessage))
+	}
+
+	return nil
+}
+
+func NewEventBridgeNotifier(cfg aws.Config, busName string) Notifier {
+	return &EventBridgeNotifier{
+		Client:  eventbridge.NewFromConfig(cfg),
+		BusName: busName,
+	}
+}
@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"context"
+	"errors"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"time"
+)
+
+type Outcome string
+
+const (
+	OutcomeSucceeded Outcome = "succeeded"
+	OutcomeFailed    Outcome = "failed"
+)
+
+// StepRotation is the step of the events that report the outcome of a whole rotation, instead
+// of a single step.
+const StepRotation = "rotation"
+
+// Event is the outcome of a rotation step, or of a whole rotation. It never includes any secret
+// value.
+type Event struct {
+	SecretArn  string    `json:"secret_arn"`
+	Step       string    `json:"step"`
+	Token      string    `json:"token"`
+	Outcome    Outcome   `json:"outcome"`
+	DurationMs int64     `json:"duration_ms"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// Notifier sends the rotation events to a sink.
+type Notifier interface {
+	Notify(ctx context.Context, event Event) error
+}
+
+// NewEvent builds the event of a step (or a whole rotation) that took the given duration and
+// ended with err.
+func NewEvent(secretArn, step, token string, duration time.Duration, err error) Event {
+	event := Event{
+		SecretArn:  secretArn,
+		Step:       step,
+		Token:      token,
+		Outcome:    OutcomeSucceeded,
+		DurationMs: duration.Milliseconds(),
+		Timestamp:  time.Now().UTC(),
+	}
+
+	if err != nil {
+		event.Outcome = OutcomeFailed
+		event.ErrorClass = erroer.Class(err)
+		event.Error = err.Error()
+	}
+
+	return event
+}
+
+// MultiNotifier sends every event to all its notifiers. A failing notifier doesn't stop the
+// others, and all the errors are returned.
+type MultiNotifier []Notifier
+
+func (m MultiNotifier) Notify(ctx context.Context, event Event) error {
+	var errs []error
+	for _, n := range m {
+		if err := n.Notify(ctx, event); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
@@ -0,0 +1,81 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+type fakeSNS struct {
+	inputs []*sns.PublishInput
+}
+
+func (f *fakeSNS) Publish(ctx context.Context, params *sns.PublishInput,
+	optFns ...func(*sns.Options)) (*sns.PublishOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &sns.PublishOutput{}, nil
+}
+
+type fakeEventBridge struct {
+	inputs []*eventbridge.PutEventsInput
+}
+
+func (f *fakeEventBridge) PutEvents(ctx context.Context, params *eventbridge.PutEventsInput,
+	optFns ...func(*eventbridge.Options)) (*eventbridge.PutEventsOutput, error) {
+	f.inputs = append(f.inputs, params)
+	return &eventbridge.PutEventsOutput{}, nil
+}
+
+type failingNotifier struct{}
+
+func (f failingNotifier) Notify(ctx context.Context, event Event) error {
+	return errors.New("unavailable")
+}
+
+func TestNewEvent(t *testing.T) {
+	succeeded := NewEvent("arn", "createSecret", "token", time.Second, nil)
+	assert.Equal(t, OutcomeSucceeded, succeeded.Outcome)
+	assert.Empty(t, succeeded.ErrorClass)
+
+	failed := NewEvent("arn", "createSecret", "token", time.Second,
+		fmt.Errorf("secret is not valid to rotate: %w", erroer.NewValidationError("no AWSCURRENT", nil)))
+	assert.Equal(t, OutcomeFailed, failed.Outcome)
+	assert.Equal(t, erroer.ClassValidation, failed.ErrorClass)
+	assert.Equal(t, erroer.ClassUnknown, NewEvent("arn", "setSecret", "token", time.Second,
+		errors.New("boom")).ErrorClass)
+}
+
+func TestAWSNotifiers(t *testing.T) {
+	ctx := context.Background()
+	topic := &fakeSNS{}
+	bus := &fakeEventBridge{}
+	event := NewEvent("arn:aws:secretsmanager:us-east-1:123456789012:secret:test-AbCdEf",
+		StepRotation, "token", time.Minute, nil)
+
+	notifiers := MultiNotifier{
+		failingNotifier{},
+		&SNSNotifier{Client: topic, TopicARN: "arn:aws:sns:us-east-1:123456789012:rotations"},
+		&EventBridgeNotifier{Client: bus, BusName: "default"},
+	}
+
+	assert.Error(t, notifiers.Notify(ctx, event), "the failing notifier should be reported")
+
+	assert.Len(t, topic.inputs, 1, "a failing notifier should not stop the others")
+	var published Event
+	assert.NoError(t, json.Unmarshal([]byte(aws.ToString(topic.inputs[0].Message)), &published))
+	assert.Equal(t, event.SecretArn, published.SecretArn)
+	assert.Equal(t, "succeeded", aws.ToString(topic.inputs[0].MessageAttributes["outcome"].StringValue))
+
+	assert.Len(t, bus.inputs, 1)
+	entry := bus.inputs[0].Entries[0]
+	assert.Equal(t, EventBridgeSource, aws.ToString(entry.Source))
+	assert.Equal(t, []string{event.SecretArn}, entry.Resources)
+}
@@ -0,0 +1,51 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+type SNSPublisher interface {
+	Publish(ctx context.Context, params *sns.PublishInput, optFns ...func(*sns.Options)) (*sns.PublishOutput,
+		error)
+}
+
+// SNSNotifier publishes the events as JSON messages to an SNS topic. The step and the outcome
+// are set as message attributes as well, so subscriptions can filter on them.
+type SNSNotifier struct {
+	Client   SNSPublisher
+	TopicARN string
+}
+
+func (n *SNSNotifier) Notify(ctx context.Context, event Event) error {
+	message, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to encode the rotation event: %w", err)
+	}
+
+	_, err = n.Client.Publish(ctx, &sns.PublishInput{
+		TopicArn: aws.String(n.TopicARN),
+		Subject:  aws.String(fmt.Sprintf("Secret rotation %s %s", event.Step, event.Outcome)),
+		Message:  aws.String(string(message)),
+		MessageAttributes: map[string]types.MessageAttributeValue{
+			"step":    {DataType: aws.String("String"), StringValue: aws.String(event.Step)},
+			"outcome": {DataType: aws.String("String"), StringValue: aws.String(string(event.Outcome))},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("unable to publish the rotation event to topic %s: %w", n.TopicARN, err)
+	}
+
+	return nil
+}
+
+func NewSNSNotifier(cfg aws.Config, topicARN string) Notifier {
+	return &SNSNotifier{
+		Client:   sns.NewFromConfig(cfg),
+		TopicARN: topicARN,
+	}
+}
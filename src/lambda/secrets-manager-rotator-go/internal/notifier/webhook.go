@@ -0,0 +1,73 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const DefaultWebhookTimeout = 10 * time.Second
+
+// WebhookNotifier posts the events as JSON to an HTTPS endpoint. Headers are added to every
+// request (e.g.: an Authorization header).
+type WebhookNotifier struct {
+	URL     string
+	Client  *http.Client
+	Headers map[string]string
+}
+
+func (n *WebhookNotifier) Notify(ctx context.Context, event Event) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("unable to encode the rotation event: %w", err)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, n.URL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("unable to build the webhook request: %w", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	for key, value := range n.Headers {
+		request.Header.Set(key, value)
+	}
+
+	response, err := n.Client.Do(request)
+	if err != nil {
+		return fmt.Errorf("unable to send the rotation event to the webhook: %w", err)
+	}
+
+	defer response.Body.Close()
+	_, _ = io.Copy(io.Discard, response.Body)
+
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return fmt.Errorf("the webhook rejected the rotation event with status %d", response.StatusCode)
+	}
+
+	return nil
+}
+
+// NewWebhookNotifier returns a notifier for the given webhook, which must be an HTTPS URL. If
+// httpClient is nil, a client with DefaultWebhookTimeout is used.
+func NewWebhookNotifier(webhookURL string, headers map[string]string,
+	httpClient *http.Client) (Notifier, error) {
+	parsed, err := url.Parse(webhookURL)
+	if err != nil || parsed.Scheme != "https" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid webhook url, it must be an https URL")
+	}
+
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultWebhookTimeout}
+	}
+
+	return &WebhookNotifier{
+		URL:     webhookURL,
+		Client:  httpClient,
+		Headers: headers,
+	}, nil
+}
@@ -0,0 +1,60 @@
+package notifier
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestWebhookNotifier(t *testing.T) {
+	ctx := context.Background()
+
+	var received Event
+	var authorization string
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		if err := json.NewDecoder(r.Body).Decode(&received); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		if received.Step == "rejected" {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	webhook, err := NewWebhookNotifier(server.URL, map[string]string{"Authorization": "Bearer test"},
+		server.Client())
+	assert.NoError(t, err)
+
+	t.Run("Delivered", func(t *testing.T) {
+		event := NewEvent("arn:aws:secretsmanager:us-east-1:123456789012:secret:test-AbCdEf",
+			"testSecret", "token", 1500*time.Millisecond,
+			erroer.NewRotationError("unable to log in", nil))
+
+		assert.NoError(t, webhook.Notify(ctx, event))
+		assert.Equal(t, "Bearer test", authorization)
+		assert.Equal(t, "testSecret", received.Step)
+		assert.Equal(t, OutcomeFailed, received.Outcome)
+		assert.Equal(t, erroer.ClassRotation, received.ErrorClass)
+		assert.Equal(t, int64(1500), received.DurationMs)
+	})
+
+	t.Run("Rejected", func(t *testing.T) {
+		assert.Error(t, webhook.Notify(ctx, NewEvent("arn", "rejected", "token", time.Second, nil)))
+	})
+}
+
+func TestNewWebhookNotifierRequiresHTTPS(t *testing.T) {
+	_, err := NewWebhookNotifier("http://example.com/hook", nil, nil)
+	assert.Error(t, err)
+}
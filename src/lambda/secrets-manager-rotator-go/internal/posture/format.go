@@ -0,0 +1,148 @@
+package posture
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Format string
+
+const (
+	FormatJSON     Format = "json"
+	FormatCSV      Format = "csv"
+	FormatMarkdown Format = "markdown"
+)
+
+// ParseFormat returns the report format of the given name. It defaults to JSON.
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "", string(FormatJSON):
+		return FormatJSON, nil
+	case string(FormatCSV):
+		return FormatCSV, nil
+	case string(FormatMarkdown), "md":
+		return FormatMarkdown, nil
+	}
+
+	return "", fmt.Errorf("unknown report format %q, it must be json, csv or markdown", name)
+}
+
+// Write writes the report in the given format.
+func Write(w io.Writer, report Report, format Format) error {
+	switch format {
+	case FormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(report)
+	case FormatCSV:
+		return writeCSV(w, report)
+	case FormatMarkdown:
+		return writeMarkdown(w, report)
+	}
+
+	return fmt.Errorf("unknown report format %q", format)
+}
+
+func writeCSV(w io.Writer, report Report) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write([]string{"name", "arn", "rotation_enabled", "rotation_lambda_arn",
+		"rotation_schedule", "last_rotated_date", "next_rotation_date", "findings", "details"}); err != nil {
+		return err
+	}
+
+	for _, secret := range report.Secrets {
+		codes, details := joinFindings(secret.Findings)
+		if err := writer.Write([]string{
+			secret.Name,
+			secret.ARN,
+			strconv.FormatBool(secret.RotationEnabled),
+			secret.RotationLambdaARN,
+			secret.RotationSchedule,
+			formatDate(secret.LastRotatedDate),
+			formatDate(secret.NextRotationDate),
+			codes,
+			details,
+		}); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeMarkdown(w io.Writer, report Report) error {
+	var b strings.Builder
+
+	b.WriteString("# Secrets rotation posture\n\n")
+	b.WriteString(fmt.Sprintf("Generated at %s.", report.GeneratedAt.Format(time.RFC3339)))
+	if report.LambdaARN != "" {
+		b.WriteString(fmt.Sprintf(" Expected rotation lambda: `%s`.", report.LambdaARN))
+	}
+
+	b.WriteString(fmt.Sprintf("\n\n%d secrets, %d compliant.\n\n", report.Summary.Secrets,
+		report.Summary.Compliant))
+
+	b.WriteString("| Finding | Secrets |\n|---|---|\n")
+	for _, code := range AllFindings {
+		b.WriteString(fmt.Sprintf("| %s | %d |\n", code, report.Summary.Findings[code]))
+	}
+
+	b.WriteString("\n| Secret | Rotation | Lambda | Schedule | Last rotated | Findings |\n")
+	b.WriteString("|---|---|---|---|---|---|\n")
+	for _, secret := range report.Secrets {
+		rotation := "disabled"
+		if secret.RotationEnabled {
+			rotation = "enabled"
+		}
+
+		findings := "-"
+		if len(secret.Findings) > 0 {
+			var lines []string
+			for _, finding := range secret.Findings {
+				lines = append(lines, fmt.Sprintf("**%s**: %s", finding.Code, finding.Details))
+			}
+
+			findings = strings.Join(lines, "<br>")
+		}
+
+		b.WriteString(fmt.Sprintf("| %s | %s | %s | %s | %s | %s |\n",
+			markdownCell(secret.Name), rotation, markdownCell(secret.RotationLambdaARN),
+			markdownCell(secret.RotationSchedule), markdownCell(formatDate(secret.LastRotatedDate)),
+			markdownCell(findings)))
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func joinFindings(findings []Finding) (string, string) {
+	var codes, details []string
+	for _, finding := range findings {
+		codes = append(codes, finding.Code)
+		details = append(details, finding.Details)
+	}
+
+	return strings.Join(codes, ";"), strings.Join(details, "; ")
+}
+
+func formatDate(date *time.Time) string {
+	if date == nil {
+		return ""
+	}
+
+	return date.UTC().Format(time.RFC3339)
+}
+
+func markdownCell(value string) string {
+	if value == "" {
+		return "-"
+	}
+
+	return strings.ReplaceAll(value, "|", "\\|")
+}
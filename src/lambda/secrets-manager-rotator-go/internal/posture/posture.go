@@ -0,0 +1,283 @@
+package posture
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/rotation"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Codes of the findings of a posture audit.
+const (
+	FindingRotationDisabled   = "rotation-disabled"
+	FindingRotationOverdue    = "rotation-overdue"
+	FindingForeignLambda      = "rotated-by-other-lambda"
+	FindingLastRotationFailed = "last-rotation-failed"
+	FindingRotationInProgress = "rotation-in-progress"
+)
+
+// DefaultPendingTimeout is how long a rotation can keep a version AWSPENDING before it's reported
+// as failed: its four steps, each at the maximum lambda timeout (15 minutes).
+const DefaultPendingTimeout = time.Hour
+
+// AllFindings are the finding codes, in the order they're reported.
+var AllFindings = []string{
+	FindingRotationDisabled,
+	FindingRotationOverdue,
+	FindingForeignLambda,
+	FindingLastRotationFailed,
+	FindingRotationInProgress,
+}
+
+type Finding struct {
+	Code    string `json:"code"`
+	Details string `json:"details"`
+}
+
+// SecretPosture is the rotation posture of a secret. A secret is compliant if it has no findings
+// other than a rotation in progress.
+type SecretPosture struct {
+	Name              string     `json:"name"`
+	ARN               string     `json:"arn"`
+	RotationEnabled   bool       `json:"rotation_enabled"`
+	RotationLambdaARN string     `json:"rotation_lambda_arn,omitempty"`
+	RotationSchedule  string     `json:"rotation_schedule,omitempty"`
+	LastRotatedDate   *time.Time `json:"last_rotated_date,omitempty"`
+	NextRotationDate  *time.Time `json:"next_rotation_date,omitempty"`
+	Findings          []Finding  `json:"findings"`
+}
+
+type Summary struct {
+	Secrets   int            `json:"secrets"`
+	Compliant int            `json:"compliant"`
+	Findings  map[string]int `json:"findings"`
+}
+
+// Report is the rotation posture of every secret of an account.
+type Report struct {
+	GeneratedAt time.Time       `json:"generated_at"`
+	LambdaARN   string          `json:"lambda_arn,omitempty"`
+	Summary     Summary         `json:"summary"`
+	Secrets     []SecretPosture `json:"secrets"`
+}
+
+type Options struct {
+	// LambdaARN is the rotation lambda the secrets are expected to be rotated by. If it's empty,
+	// secrets rotated by other lambdas aren't flagged.
+	LambdaARN string
+	// Now is the time the overdue rotations are checked against. It defaults to time.Now.
+	Now func() time.Time
+	// PendingTimeout is how long a version can be AWSPENDING before the rotation that created it
+	// is reported as failed instead of in progress. It defaults to DefaultPendingTimeout.
+	PendingTimeout time.Duration
+}
+
+var rateExpression = regexp.MustCompile(`^rate\((\d+) (hours?|days?)\)$`)
+
+// Analyze builds the posture report of the given secrets.
+func Analyze(secrets []*secretsmanager.DescribeSecretOutput, opts Options) Report {
+	now := time.Now
+	if opts.Now != nil {
+		now = opts.Now
+	}
+
+	report := Report{
+		GeneratedAt: now().UTC(),
+		LambdaARN:   opts.LambdaARN,
+		Summary:     Summary{Findings: map[string]int{}},
+	}
+
+	for _, code := range AllFindings {
+		report.Summary.Findings[code] = 0
+	}
+
+	pendingTimeout := opts.PendingTimeout
+	if pendingTimeout <= 0 {
+		pendingTimeout = DefaultPendingTimeout
+	}
+
+	for _, secret := range secrets {
+		posture := analyzeSecret(secret, opts.LambdaARN, report.GeneratedAt, pendingTimeout)
+
+		compliant := true
+		for _, finding := range posture.Findings {
+			report.Summary.Findings[finding.Code]++
+			if finding.Code != FindingRotationInProgress {
+				compliant = false
+			}
+		}
+
+		report.Summary.Secrets++
+		if compliant {
+			report.Summary.Compliant++
+		}
+
+		report.Secrets = append(report.Secrets, posture)
+	}
+
+	sort.Slice(report.Secrets, func(i, j int) bool {
+		return report.Secrets[i].Name < report.Secrets[j].Name
+	})
+
+	return report
+}
+
+func analyzeSecret(secret *secretsmanager.DescribeSecretOutput, lambdaARN string, now time.Time,
+	pendingTimeout time.Duration) SecretPosture {
+	posture := SecretPosture{
+		Name:              aws.ToString(secret.Name),
+		ARN:               aws.ToString(secret.ARN),
+		RotationEnabled:   aws.ToBool(secret.RotationEnabled),
+		RotationLambdaARN: aws.ToString(secret.RotationLambdaARN),
+		RotationSchedule:  rotationSchedule(secret),
+		LastRotatedDate:   secret.LastRotatedDate,
+		NextRotationDate:  secret.NextRotationDate,
+		Findings:          []Finding{},
+	}
+
+	if !posture.RotationEnabled {
+		posture.Findings = append(posture.Findings, Finding{
+			Code:    FindingRotationDisabled,
+			Details: "rotation is not enabled",
+		})
+	} else {
+		if due, ok := rotationDueDate(secret); ok && now.After(due) {
+			posture.Findings = append(posture.Findings, Finding{
+				Code:    FindingRotationOverdue,
+				Details: fmt.Sprintf("rotation was due at %s", due.UTC().Format(time.RFC3339)),
+			})
+		}
+
+		if lambdaARN != "" && posture.RotationLambdaARN != "" &&
+			unqualifiedFunctionARN(posture.RotationLambdaARN) != unqualifiedFunctionARN(lambdaARN) {
+			posture.Findings = append(posture.Findings, Finding{
+				Code:    FindingForeignLambda,
+				Details: fmt.Sprintf("rotated by %s", posture.RotationLambdaARN),
+			})
+		}
+	}
+
+	if version, ok := pendingVersion(secret); ok {
+		if pendingIsStale(secret, now, pendingTimeout) {
+			posture.Findings = append(posture.Findings, Finding{
+				Code:    FindingLastRotationFailed,
+				Details: fmt.Sprintf("version %s is still AWSPENDING", version),
+			})
+		} else {
+			posture.Findings = append(posture.Findings, Finding{
+				Code:    FindingRotationInProgress,
+				Details: fmt.Sprintf("version %s is AWSPENDING", version),
+			})
+		}
+	}
+
+	return posture
+}
+
+// rotationDueDate returns when the secret should have been rotated by: the next rotation date
+// reported by Secrets Manager or, if there's none, the last rotation (or the creation) of the
+// secret plus its rotation interval. Cron schedules are only checked through the former.
+func rotationDueDate(secret *secretsmanager.DescribeSecretOutput) (time.Time, bool) {
+	if secret.NextRotationDate != nil {
+		return *secret.NextRotationDate, true
+	}
+
+	interval, ok := rotationInterval(secret)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	last := secret.LastRotatedDate
+	if last == nil {
+		last = secret.CreatedDate
+	}
+
+	if last == nil {
+		return time.Time{}, false
+	}
+
+	return last.Add(interval), true
+}
+
+func rotationInterval(secret *secretsmanager.DescribeSecretOutput) (time.Duration, bool) {
+	if secret.RotationRules == nil {
+		return 0, false
+	}
+
+	if days := aws.ToInt64(secret.RotationRules.AutomaticallyAfterDays); days > 0 {
+		return time.Duration(days) * 24 * time.Hour, true
+	}
+
+	expression := strings.TrimSpace(aws.ToString(secret.RotationRules.ScheduleExpression))
+	match := rateExpression.FindStringSubmatch(expression)
+	if match == nil {
+		return 0, false
+	}
+
+	amount, err := strconv.Atoi(match[1])
+	if err != nil || amount <= 0 {
+		return 0, false
+	}
+
+	if strings.HasPrefix(match[2], "hour") {
+		return time.Duration(amount) * time.Hour, true
+	}
+
+	return time.Duration(amount) * 24 * time.Hour, true
+}
+
+func rotationSchedule(secret *secretsmanager.DescribeSecretOutput) string {
+	if secret.RotationRules == nil {
+		return ""
+	}
+
+	if expression := aws.ToString(secret.RotationRules.ScheduleExpression); expression != "" {
+		return expression
+	}
+
+	if days := aws.ToInt64(secret.RotationRules.AutomaticallyAfterDays); days > 0 {
+		return fmt.Sprintf("every %d days", days)
+	}
+
+	return ""
+}
+
+// pendingVersion returns the version that holds AWSPENDING but not AWSCURRENT, if any. It's either
+// a rotation that's still running or one that didn't finish, see pendingIsStale.
+func pendingVersion(secret *secretsmanager.DescribeSecretOutput) (string, bool) {
+	labels := rotation.GetStagingLabels()
+	for version, stages := range secret.VersionIdsToStages {
+		if rotation.HasStage(stages, labels.Pending) && !rotation.HasStage(stages, labels.Current) {
+			return version, true
+		}
+	}
+
+	return "", false
+}
+
+// pendingIsStale reports whether the AWSPENDING version was left by a rotation that didn't finish:
+// the secret hasn't changed for longer than the pending timeout, or its next rotation date passed.
+// If the last change date is unknown, the rotation is assumed to be running.
+func pendingIsStale(secret *secretsmanager.DescribeSecretOutput, now time.Time,
+	pendingTimeout time.Duration) bool {
+	if secret.NextRotationDate != nil && now.After(*secret.NextRotationDate) {
+		return true
+	}
+
+	return secret.LastChangedDate != nil && now.Sub(*secret.LastChangedDate) > pendingTimeout
+}
+
+// unqualifiedFunctionARN removes the version or alias from a lambda function ARN.
+func unqualifiedFunctionARN(functionARN string) string {
+	parts := strings.Split(functionARN, ":")
+	if len(parts) > 7 {
+		parts = parts[:7]
+	}
+
+	return strings.Join(parts, ":")
+}
@@ -0,0 +1,211 @@
+package posture
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+const lambdaARN = "arn:aws:lambda:us-east-1:123456789012:function:rotator"
+
+var now = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+func testSecrets() []*secretsmanager.DescribeSecretOutput {
+	return []*secretsmanager.DescribeSecretOutput{
+		{
+			Name:               aws.String("compliant"),
+			ARN:                aws.String("arn:compliant"),
+			RotationEnabled:    aws.Bool(true),
+			RotationLambdaARN:  aws.String(lambdaARN + ":live"),
+			RotationRules:      &types.RotationRulesType{AutomaticallyAfterDays: aws.Int64(30)},
+			LastRotatedDate:    aws.Time(now.AddDate(0, 0, -10)),
+			VersionIdsToStages: map[string][]string{"v2": {"AWSCURRENT", "AWSPENDING"}, "v1": {"AWSPREVIOUS"}},
+		},
+		{
+			Name:            aws.String("disabled"),
+			ARN:             aws.String("arn:disabled"),
+			RotationEnabled: aws.Bool(false),
+		},
+		{
+			Name:              aws.String("overdue"),
+			ARN:               aws.String("arn:overdue"),
+			RotationEnabled:   aws.Bool(true),
+			RotationLambdaARN: aws.String(lambdaARN),
+			RotationRules:     &types.RotationRulesType{ScheduleExpression: aws.String("rate(7 days)")},
+			CreatedDate:       aws.Time(now.AddDate(0, 0, -8)),
+		},
+		{
+			Name:              aws.String("foreign|failed"),
+			ARN:               aws.String("arn:foreign"),
+			RotationEnabled:   aws.Bool(true),
+			RotationLambdaARN: aws.String("arn:aws:lambda:us-east-1:123456789012:function:other"),
+			NextRotationDate:  aws.Time(now.AddDate(0, 0, 1)),
+			LastChangedDate:   aws.Time(now.Add(-2 * time.Hour)),
+			VersionIdsToStages: map[string][]string{
+				"v2": {"AWSPENDING"},
+				"v1": {"AWSCURRENT"},
+			},
+		},
+		{
+			Name:              aws.String("rotating"),
+			ARN:               aws.String("arn:rotating"),
+			RotationEnabled:   aws.Bool(true),
+			RotationLambdaARN: aws.String(lambdaARN),
+			NextRotationDate:  aws.Time(now.AddDate(0, 0, 1)),
+			LastChangedDate:   aws.Time(now.Add(-5 * time.Minute)),
+			VersionIdsToStages: map[string][]string{
+				"v2": {"AWSPENDING"},
+				"v1": {"AWSCURRENT"},
+			},
+		},
+	}
+}
+
+func findingCodes(secret SecretPosture) []string {
+	var codes []string
+	for _, finding := range secret.Findings {
+		codes = append(codes, finding.Code)
+	}
+
+	return codes
+}
+
+func TestAnalyze(t *testing.T) {
+	report := Analyze(testSecrets(), Options{LambdaARN: lambdaARN, Now: func() time.Time { return now }})
+
+	assert.Equal(t, now, report.GeneratedAt)
+	assert.Equal(t, Summary{
+		Secrets:   5,
+		Compliant: 2,
+		Findings: map[string]int{
+			FindingRotationDisabled:   1,
+			FindingRotationOverdue:    1,
+			FindingForeignLambda:      1,
+			FindingLastRotationFailed: 1,
+			FindingRotationInProgress: 1,
+		},
+	}, report.Summary)
+
+	if assert.Len(t, report.Secrets, 5) {
+		assert.Equal(t, "compliant", report.Secrets[0].Name)
+		assert.Empty(t, findingCodes(report.Secrets[0]))
+		assert.Equal(t, "every 30 days", report.Secrets[0].RotationSchedule)
+
+		assert.Equal(t, "disabled", report.Secrets[1].Name)
+		assert.Equal(t, []string{FindingRotationDisabled}, findingCodes(report.Secrets[1]))
+
+		assert.Equal(t, "foreign|failed", report.Secrets[2].Name)
+		assert.Equal(t, []string{FindingForeignLambda, FindingLastRotationFailed},
+			findingCodes(report.Secrets[2]))
+
+		assert.Equal(t, "overdue", report.Secrets[3].Name)
+		assert.Equal(t, []string{FindingRotationOverdue}, findingCodes(report.Secrets[3]))
+		assert.Equal(t, "rotation was due at 2024-02-29T12:00:00Z", report.Secrets[3].Findings[0].Details)
+
+		assert.Equal(t, "rotating", report.Secrets[4].Name)
+		assert.Equal(t, []string{FindingRotationInProgress}, findingCodes(report.Secrets[4]))
+	}
+}
+
+func TestAnalyzePendingVersion(t *testing.T) {
+	pending := func(lastChanged, nextRotation *time.Time) *secretsmanager.DescribeSecretOutput {
+		return &secretsmanager.DescribeSecretOutput{
+			Name:               aws.String("pending"),
+			RotationEnabled:    aws.Bool(true),
+			LastChangedDate:    lastChanged,
+			NextRotationDate:   nextRotation,
+			VersionIdsToStages: map[string][]string{"v2": {"AWSPENDING"}, "v1": {"AWSCURRENT"}},
+		}
+	}
+
+	for name, tc := range map[string]struct {
+		secret         *secretsmanager.DescribeSecretOutput
+		pendingTimeout time.Duration
+		expected       string
+	}{
+		"Running":            {pending(aws.Time(now.Add(-30*time.Minute)), nil), 0, FindingRotationInProgress},
+		"UnknownLastChange":  {pending(nil, nil), 0, FindingRotationInProgress},
+		"PastTimeout":        {pending(aws.Time(now.Add(-90*time.Minute)), nil), 0, FindingLastRotationFailed},
+		"CustomTimeout":      {pending(aws.Time(now.Add(-30*time.Minute)), nil), 10 * time.Minute, FindingLastRotationFailed},
+		"NextRotationPassed": {pending(nil, aws.Time(now.Add(-time.Minute))), 0, FindingLastRotationFailed},
+	} {
+		t.Run(name, func(t *testing.T) {
+			report := Analyze([]*secretsmanager.DescribeSecretOutput{tc.secret}, Options{
+				Now:            func() time.Time { return now },
+				PendingTimeout: tc.pendingTimeout,
+			})
+
+			assert.Contains(t, findingCodes(report.Secrets[0]), tc.expected)
+		})
+	}
+}
+
+func TestAnalyzeWithoutLambdaARN(t *testing.T) {
+	report := Analyze(testSecrets(), Options{Now: func() time.Time { return now }})
+	assert.Equal(t, 0, report.Summary.Findings[FindingForeignLambda])
+}
+
+func TestParseFormat(t *testing.T) {
+	for name, expected := range map[string]Format{
+		"":         FormatJSON,
+		"JSON":     FormatJSON,
+		"csv":      FormatCSV,
+		"markdown": FormatMarkdown,
+		" md ":     FormatMarkdown,
+	} {
+		format, err := ParseFormat(name)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, format)
+	}
+
+	_, err := ParseFormat("xml")
+	assert.Error(t, err)
+}
+
+func TestWrite(t *testing.T) {
+	report := Analyze(testSecrets(), Options{LambdaARN: lambdaARN, Now: func() time.Time { return now }})
+
+	t.Run("JSON", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, Write(&out, report, FormatJSON))
+
+		var decoded Report
+		assert.NoError(t, json.Unmarshal(out.Bytes(), &decoded))
+		assert.Equal(t, report.Summary, decoded.Summary)
+		assert.Len(t, decoded.Secrets, 5)
+	})
+
+	t.Run("CSV", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, Write(&out, report, FormatCSV))
+
+		rows, err := csv.NewReader(&out).ReadAll()
+		assert.NoError(t, err)
+		if assert.Len(t, rows, 6) {
+			assert.Equal(t, "name", rows[0][0])
+			assert.Equal(t, []string{"foreign|failed", "arn:foreign", "true",
+				"arn:aws:lambda:us-east-1:123456789012:function:other", "", "",
+				"2024-03-02T12:00:00Z", "rotated-by-other-lambda;last-rotation-failed",
+				"rotated by arn:aws:lambda:us-east-1:123456789012:function:other; version v2 is still AWSPENDING"},
+				rows[3])
+		}
+	})
+
+	t.Run("Markdown", func(t *testing.T) {
+		var out bytes.Buffer
+		assert.NoError(t, Write(&out, report, FormatMarkdown))
+
+		markdown := out.String()
+		assert.Contains(t, markdown, "# Secrets rotation posture")
+		assert.Contains(t, markdown, "5 secrets, 2 compliant.")
+		assert.Contains(t, markdown, "| rotation-overdue | 1 |")
+		assert.Contains(t, markdown, "| foreign\\|failed | enabled |")
+		assert.Contains(t, markdown, "| disabled | disabled | - | - | - | **rotation-disabled**: rotation is not enabled |")
+	})
+}
@@ -0,0 +1,186 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/database"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// CloneUserSuffix is appended to the username to get the name of its alternate user.
+const CloneUserSuffix = "_clone"
+
+// AlternatingUsersStrategy rotates a database credential by alternating between two users,
+// 'user' and 'user_clone'. Each rotation updates (or creates) the user that isn't in use, so the
+// AWSCURRENT credential keeps working until AWSCURRENT is moved to the new one.
+//
+// The users are managed with a master credential, whose secret ARN is set in the 'masterarn'
+// field of the secret value.
+type AlternatingUsersStrategy struct {
+	Logger    *zap.Logger
+	Client    client.SecretsManager
+	Generator generator.Generator
+	Policy    generator.Policy
+	Driver    database.Driver
+}
+
+func (a *AlternatingUsersStrategy) CreateSecret(ctx context.Context, current string) (string, error) {
+	currentCreds, err := database.ParseCredentials(current)
+	if err != nil {
+		a.Logger.Error("AWSCURRENT secret value is not a valid database credential", zap.Error(err))
+		return "", erroer.NewSecretError("AWSCURRENT secret value is not a valid database credential", err)
+	}
+
+	if currentCreds.MasterARN == "" {
+		a.Logger.Error("AWSCURRENT secret value has no masterarn")
+		return "", erroer.NewSecretError("AWSCURRENT secret value has no masterarn", nil)
+	}
+
+	newPassword, err := generateValue(ctx, a.Logger, a.Generator, a.Policy)
+	if err != nil {
+		return "", err
+	}
+
+	return withJSONFields(current, map[string]interface{}{
+		"username": AlternateUsername(currentCreds.Username),
+		"password": newPassword,
+	})
+}
+
+func (a *AlternatingUsersStrategy) SetSecret(ctx context.Context, current, pending string) error {
+	currentCreds, err := database.ParseCredentials(current)
+	if err != nil {
+		a.Logger.Error("AWSCURRENT secret value is not a valid database credential", zap.Error(err))
+		return erroer.NewSecretError("AWSCURRENT secret value is not a valid database credential", err)
+	}
+
+	pendingCreds, err := database.ParseCredentials(pending)
+	if err != nil {
+		a.Logger.Error("AWSPENDING secret value is not a valid database credential", zap.Error(err))
+		return erroer.NewSecretError("AWSPENDING secret value is not a valid database credential", err)
+	}
+
+	// If the pending credentials already work, the user was set on a previous attempt.
+	if err := a.Driver.Ping(ctx, pendingCreds); err == nil {
+		a.Logger.Info(fmt.Sprintf("AWSPENDING password is already set for database user %s",
+			pendingCreds.Username))
+		return nil
+	}
+
+	masterCreds, err := a.getMasterCredentials(ctx, pendingCreds.MasterARN)
+	if err != nil {
+		return err
+	}
+
+	exists, err := a.Driver.UserExists(ctx, masterCreds, pendingCreds.Username)
+	if err != nil {
+		a.Logger.Error(fmt.Sprintf("Error checking if database user %s exists",
+			pendingCreds.Username), zap.Error(err))
+		return erroer.NewRotationError(fmt.Sprintf("error checking if database user %s exists",
+			pendingCreds.Username), err)
+	}
+
+	if exists {
+		err = a.Driver.SetPassword(ctx, masterCreds, pendingCreds.Username, pendingCreds.Password)
+	} else {
+		err = a.Driver.CreateUser(ctx, masterCreds, pendingCreds.Username, pendingCreds.Password,
+			currentCreds.Username)
+	}
+
+	if err != nil {
+		a.Logger.Error(fmt.Sprintf("Error setting the AWSPENDING password for database user %s",
+			pendingCreds.Username), zap.Error(err))
+		return erroer.NewRotationError(fmt.Sprintf(
+			"error setting the AWSPENDING password for database user %s", pendingCreds.Username), err)
+	}
+
+	a.Logger.Info(fmt.Sprintf("AWSPENDING password set for database user %s", pendingCreds.Username))
+	return nil
+}
+
+func (a *AlternatingUsersStrategy) TestSecret(ctx context.Context, pending string) error {
+	pendingCreds, err := database.ParseCredentials(pending)
+	if err != nil {
+		a.Logger.Error("AWSPENDING secret value is not a valid database credential", zap.Error(err))
+		return erroer.NewSecretError("AWSPENDING secret value is not a valid database credential", err)
+	}
+
+	if err := a.Driver.Ping(ctx, pendingCreds); err != nil {
+		a.Logger.Error(fmt.Sprintf("Unable to log in as database user %s with the AWSPENDING password",
+			pendingCreds.Username), zap.Error(err))
+		return erroer.NewRotationError(fmt.Sprintf(
+			"unable to log in as database user %s with the AWSPENDING password",
+			pendingCreds.Username), err)
+	}
+
+	return nil
+}
+
+func (a *AlternatingUsersStrategy) FinishSecret(ctx context.Context, current, pending string) error {
+	return nil
+}
+
+func (a *AlternatingUsersStrategy) getMasterCredentials(ctx context.Context, masterArn string) (database.Credentials,
+	error) {
+	if masterArn == "" {
+		a.Logger.Error("AWSPENDING secret value has no masterarn")
+		return database.Credentials{}, erroer.NewSecretError("AWSPENDING secret value has no masterarn", nil)
+	}
+
+	master, err := a.Client.GetSecretValueByStageLabel(ctx, masterArn, "", GetStagingLabels().Current)
+	if err != nil {
+		a.Logger.Error(fmt.Sprintf("Error getting the master secret %s", masterArn), zap.Error(err))
+		return database.Credentials{}, erroer.NewSecretError(fmt.Sprintf(
+			"error getting the master secret %s", masterArn), err)
+	}
+
+	masterCreds, err := database.ParseCredentials(aws.ToString(master.SecretString))
+	if err != nil {
+		a.Logger.Error(fmt.Sprintf("Master secret %s is not a valid database credential", masterArn),
+			zap.Error(err))
+		return database.Credentials{}, erroer.NewSecretError(fmt.Sprintf(
+			"master secret %s is not a valid database credential", masterArn), err)
+	}
+
+	return masterCreds, nil
+}
+
+// AlternateUsername returns the user that alternates with the given one: 'user' for
+// 'user_clone', and 'user_clone' for 'user'.
+func AlternateUsername(username string) string {
+	if strings.HasSuffix(username, CloneUserSuffix) {
+		return strings.TrimSuffix(username, CloneUserSuffix)
+	}
+
+	return username + CloneUserSuffix
+}
+
+func (a *AlternatingUsersStrategy) GeneratedValues(pending string) ([]string, error) {
+	pendingCreds, err := database.ParseCredentials(pending)
+	if err != nil {
+		return nil, erroer.NewSecretError("AWSPENDING secret value is not a valid database credential", err)
+	}
+
+	return []string{pendingCreds.Password}, nil
+}
+
+func NewAlternatingUsersStrategy(opts StrategyOptions) (RotationStrategy, error) {
+	if err := rejectSecretJSONKeys(opts, GetSecretTypes().DbMultiUser); err != nil {
+		return nil, err
+	}
+
+	opts = opts.withDefaults()
+
+	return &AlternatingUsersStrategy{
+		Logger:    opts.Logger,
+		Client:    opts.Client,
+		Generator: opts.Generator,
+		Policy:    opts.Policy,
+		Driver:    database.NewPostgresDriver(),
+	}, nil
+}
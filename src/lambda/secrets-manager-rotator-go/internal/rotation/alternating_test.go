@@ -0,0 +1,76 @@
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/database"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+)
+
+const (
+	alternatingMasterArn    = "arn:aws:secretsmanager:us-east-1:123456789012:secret:master-AbCdEf"
+	alternatingCurrentValue = `{"engine":"postgres","host":"localhost","username":"app","password":"old","masterarn":"` + alternatingMasterArn + `"}`
+)
+
+func TestAlternatingUsersStrategy(t *testing.T) {
+	ctx := context.Background()
+
+	driver := &fakeDriver{passwords: map[string]string{"app": "old", "master": "root"}}
+	s := &AlternatingUsersStrategy{
+		Logger: zap.NewNop(),
+		Client: &fakePasswordClient{
+			secrets: map[string]string{
+				alternatingMasterArn: `{"host":"localhost","username":"master","password":"root"}`,
+			},
+		},
+		Generator: &fakeGenerator{value: "new"},
+		Driver:    driver,
+	}
+
+	// First rotation creates the clone user.
+	pending, err := s.CreateSecret(ctx, alternatingCurrentValue)
+	assert.NoError(t, err)
+
+	pendingCreds, err := database.ParseCredentials(pending)
+	assert.NoError(t, err)
+	assert.Equal(t, "app_clone", pendingCreds.Username)
+	assert.Equal(t, alternatingMasterArn, pendingCreds.MasterARN)
+
+	assert.NoError(t, s.SetSecret(ctx, alternatingCurrentValue, pending))
+	assert.NoError(t, s.TestSecret(ctx, pending))
+	assert.Equal(t, "old", driver.passwords["app"], "the current user should not be touched")
+
+	// Next rotation goes back to the original user, which already exists.
+	s.Generator = &fakeGenerator{value: "newer"}
+	next, err := s.CreateSecret(ctx, pending)
+	assert.NoError(t, err)
+
+	var nextValue map[string]interface{}
+	assert.NoError(t, json.Unmarshal([]byte(next), &nextValue))
+	assert.Equal(t, "app", nextValue["username"])
+
+	assert.NoError(t, s.SetSecret(ctx, pending, next))
+	assert.NoError(t, s.TestSecret(ctx, next))
+	assert.Equal(t, "newer", driver.passwords["app"])
+	assert.Equal(t, "new", driver.passwords["app_clone"])
+}
+
+func TestAlternatingUsersStrategyRequiresMaster(t *testing.T) {
+	ctx := context.Background()
+
+	s := &AlternatingUsersStrategy{
+		Logger:    zap.NewNop(),
+		Generator: &fakeGenerator{value: "new"},
+		Driver:    &fakeDriver{passwords: map[string]string{}},
+	}
+
+	_, err := s.CreateSecret(ctx, postgresCurrentValue)
+	assert.Error(t, err)
+}
+
+func TestAlternateUsername(t *testing.T) {
+	assert.Equal(t, "app_clone", AlternateUsername("app"))
+	assert.Equal(t, "app", AlternateUsername("app_clone"))
+}
@@ -0,0 +1,43 @@
+package rotation
+
+import (
+	"context"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/adapter"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/audit"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"go.uber.org/zap"
+)
+
+// NewAuditSink builds the audit sink of the rotation steps, with a sink for each one that's
+// configured. If none is, the returned sink is empty. A salt is required when any sink is
+// configured, to fingerprint the new values.
+func NewAuditSink(ctx context.Context, cfg config.Audit, logger *zap.Logger) (audit.Sink, error) {
+	sinks := audit.MultiSink{}
+
+	if cfg.TableName != "" || cfg.BucketName != "" {
+		awsCfg, err := adapter.NewAWS(ctx, "", GetAWSOptions()...)
+		if err != nil {
+			return nil, erroer.NewConfigurationError("can't instantiate the AWS client of the audit sinks", err)
+		}
+
+		if cfg.TableName != "" {
+			sinks = append(sinks, audit.NewDynamoDBSink(awsCfg, cfg.TableName))
+		}
+
+		if cfg.BucketName != "" {
+			sinks = append(sinks, audit.NewS3Sink(awsCfg, cfg.BucketName, cfg.BucketPrefix))
+		}
+	}
+
+	if cfg.FilePath != "" {
+		sinks = append(sinks, audit.NewFileSink(cfg.FilePath))
+	}
+
+	if len(sinks) > 0 && cfg.Salt == "" {
+		return nil, erroer.NewConfigurationError("the audit sinks require a fingerprint salt", nil)
+	}
+
+	logger.Info("Rotation audit sink initialised", zap.Int("sinks", len(sinks)))
+	return sinks, nil
+}
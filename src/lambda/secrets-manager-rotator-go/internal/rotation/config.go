@@ -1,7 +1,31 @@
 package rotation
 
+import (
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/adapter"
+	"os"
+	"strings"
+)
+
 var AllowedSteps = []string{"createSecret", "setSecret", "testSecret", "finishSecret"}
 
+// StrategyTagKey is the secret tag that selects the rotation strategy of a secret.
+const StrategyTagKey = "rotation:strategy"
+
+// Secret tags that override the rotation settings of a single secret. See SecretConfig.
+const (
+	LengthTagKey       = "rotation:length"
+	ExcludeCharsTagKey = "rotation:exclude-chars"
+	JSONKeyTagKey      = "rotation:json-key"
+)
+
+// StrategyPayloadKey is the key, in a JSON secret value, that selects the rotation strategy
+// when the secret isn't tagged with StrategyTagKey.
+const StrategyPayloadKey = "rotation_strategy"
+
+// RoleTagKey is the secret tag with the ARN of the role to assume to rotate the secret (e.g.:
+// when the secret lives in another account).
+const RoleTagKey = "rotation:role-arn"
+
 type StagingLabels struct {
 	Current  string
 	Pending  string
@@ -31,3 +55,32 @@ func GetSteps() Steps {
 		Finish: "finishSecret",
 	}
 }
+
+func GetSecretTypes() SecretType {
+	return SecretType{
+		Db:          "postgres",
+		DbMultiUser: "postgres-multiuser",
+		Static:      "static",
+	}
+}
+
+// GetAWSOptions returns the AWS configuration overrides, read from the environment:
+// TF_VAR_rotation_secretsmanager_endpoint points Secrets Manager to another endpoint (e.g.: a
+// local emulator), and TF_VAR_rotation_access_key_id, TF_VAR_rotation_secret_access_key and
+// TF_VAR_rotation_session_token set static credentials. They're not part of config.Config, since
+// the remote configuration document is fetched with them.
+func GetAWSOptions() []adapter.Option {
+	var opts []adapter.Option
+	if endpoint := strings.TrimSpace(os.Getenv("TF_VAR_rotation_secretsmanager_endpoint")); endpoint != "" {
+		opts = append(opts, adapter.WithSecretsManagerEndpoint(endpoint))
+	}
+
+	accessKeyID := strings.TrimSpace(os.Getenv("TF_VAR_rotation_access_key_id"))
+	secretAccessKey := strings.TrimSpace(os.Getenv("TF_VAR_rotation_secret_access_key"))
+	if accessKeyID != "" || secretAccessKey != "" {
+		opts = append(opts, adapter.WithStaticCredentials(accessKeyID, secretAccessKey,
+			strings.TrimSpace(os.Getenv("TF_VAR_rotation_session_token"))))
+	}
+
+	return opts
+}
@@ -0,0 +1,184 @@
+package rotation
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"strings"
+)
+
+// Sources of the invocation payloads.
+const (
+	SourceSecretsManager = "secretsmanager"
+	SourceEventBridge    = "eventbridge"
+	SourceAdmin          = "admin"
+)
+
+// Admin actions that can be invoked with an AdminAction payload.
+const (
+	ActionListSecrets  = "list-secrets"
+	ActionPostureAudit = "posture-audit"
+	ActionRollback     = "rollback"
+)
+
+var AllowedActions = []string{ActionListSecrets, ActionPostureAudit, ActionRollback}
+
+// AdminAction is an explicit operation requested to the lambda (e.g.: by an operator, or a
+// scheduled EventBridge rule), instead of a rotation step requested by Secrets Manager.
+type AdminAction struct {
+	Action    string            `json:"action"`
+	SecretId  string            `json:"secret_id,omitempty"`
+	Arguments map[string]string `json:"arguments,omitempty"`
+}
+
+// Invocation is a decoded invocation payload. Exactly one of Event and Action is set.
+type Invocation struct {
+	// Source is where the payload came from: SourceSecretsManager, SourceEventBridge (for both
+	// wrapped rotation events and wrapped admin actions) or SourceAdmin.
+	Source string
+	Event  *Event
+	Action *AdminAction
+}
+
+// eventBridgeEnvelope is the part of an EventBridge event needed to unwrap its detail.
+type eventBridgeEnvelope struct {
+	Detail json.RawMessage `json:"detail"`
+}
+
+// DecodeInvocation decodes the payload the lambda was invoked with. It accepts the native
+// Secrets Manager rotation event, an AdminAction, and either of them wrapped as the detail of
+// an EventBridge event. Payloads that can't be decoded are returned as validation errors that
+// wrap an erroer.EventError. The decoded event or action isn't validated: its handler does it
+// (see ValidateEvent and ValidateAdminAction), however it's invoked.
+func DecodeInvocation(payload []byte) (Invocation, error) {
+	fields, err := decodeObject(payload)
+	if err != nil {
+		return Invocation{}, err
+	}
+
+	if _, ok := fields["detail-type"]; ok {
+		var envelope eventBridgeEnvelope
+		if err := json.Unmarshal(payload, &envelope); err != nil {
+			return Invocation{}, invalidEvent("", "the EventBridge event can't be decoded",
+				erroer.ErrEventMalformed)
+		}
+
+		detail, err := decodeObject(envelope.Detail)
+		if err != nil {
+			return Invocation{}, invalidEvent("detail", "the EventBridge event detail must be an object",
+				erroer.ErrEventMalformed)
+		}
+
+		invocation, err := decodeFields(envelope.Detail, detail)
+		if err != nil {
+			return Invocation{}, err
+		}
+
+		invocation.Source = SourceEventBridge
+		return invocation, nil
+	}
+
+	return decodeFields(payload, fields)
+}
+
+func decodeFields(payload []byte, fields map[string]json.RawMessage) (Invocation, error) {
+	if _, ok := fields["action"]; ok {
+		var action AdminAction
+		if err := json.Unmarshal(payload, &action); err != nil {
+			return Invocation{}, invalidEvent("action", "the admin action can't be decoded",
+				erroer.ErrEventMalformed)
+		}
+
+		return Invocation{Source: SourceAdmin, Action: &action}, nil
+	}
+
+	_, hasSecretId := fields["SecretId"]
+	_, hasToken := fields["ClientRequestToken"]
+	_, hasStep := fields["Step"]
+	if !hasSecretId && !hasToken && !hasStep {
+		return Invocation{}, invalidEvent("", "the payload is neither a rotation event nor an admin action",
+			erroer.ErrEventMalformed)
+	}
+
+	var event Event
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return Invocation{}, invalidEvent("", "the rotation event can't be decoded", erroer.ErrEventMalformed)
+	}
+
+	return Invocation{Source: SourceSecretsManager, Event: &event}, nil
+}
+
+func decodeObject(payload []byte) (map[string]json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(payload)
+	if len(trimmed) == 0 || bytes.Equal(trimmed, []byte("null")) {
+		return nil, invalidEvent("", "the payload is empty", erroer.ErrEventMalformed)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(trimmed, &fields); err != nil {
+		return nil, invalidEvent("", "the payload must be a JSON object", erroer.ErrEventMalformed)
+	}
+
+	return fields, nil
+}
+
+// ValidateEvent checks that the rotation event has every field, and a step that's allowed.
+func ValidateEvent(event Event) error {
+	required := []struct {
+		field string
+		value *string
+	}{
+		{"SecretId", event.Arn},
+		{"ClientRequestToken", event.Token},
+		{"Step", event.Step},
+	}
+
+	for _, r := range required {
+		if r.value == nil || strings.TrimSpace(*r.value) == "" {
+			return invalidEvent(r.field, "it's required", erroer.ErrEventFieldMissing)
+		}
+	}
+
+	if !isAllowed(*event.Step, AllowedSteps) {
+		return invalidEvent("Step", fmt.Sprintf("%q isn't one of %s", *event.Step,
+			strings.Join(AllowedSteps, ", ")), erroer.ErrEventUnknownStep)
+	}
+
+	return nil
+}
+
+// ValidateAdminAction checks that the action is one of AllowedActions, and that it has the
+// secret it requires.
+func ValidateAdminAction(action AdminAction) error {
+	if strings.TrimSpace(action.Action) == "" {
+		return invalidEvent("action", "it's required", erroer.ErrEventFieldMissing)
+	}
+
+	if !isAllowed(action.Action, AllowedActions) {
+		return invalidEvent("action", fmt.Sprintf("%q isn't one of %s", action.Action,
+			strings.Join(AllowedActions, ", ")), erroer.ErrEventUnknownAction)
+	}
+
+	if action.Action == ActionRollback && strings.TrimSpace(action.SecretId) == "" {
+		return invalidEvent("secret_id", fmt.Sprintf("it's required by the %s action", action.Action),
+			erroer.ErrEventFieldMissing)
+	}
+
+	return nil
+}
+
+func isAllowed(value string, allowed []string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+
+	return false
+}
+
+func invalidEvent(field, details string, reason error) error {
+	eventErr := erroer.NewEventError(field, details, reason)
+	return erroer.NewValidationError("invalid event", eventErr)
+}
@@ -0,0 +1,134 @@
+package rotation
+
+import (
+	"errors"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestDecodeInvocation(t *testing.T) {
+	t.Run("NativeEvent", func(t *testing.T) {
+		invocation, err := DecodeInvocation([]byte(`{"SecretId":"arn:secret","ClientRequestToken":"token",
+			"Step":"createSecret","RotationToken":"ignored"}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, SourceSecretsManager, invocation.Source)
+		assert.Nil(t, invocation.Action)
+		if assert.NotNil(t, invocation.Event) {
+			assert.Equal(t, "arn:secret", *invocation.Event.Arn)
+			assert.Equal(t, "token", *invocation.Event.Token)
+			assert.Equal(t, "createSecret", *invocation.Event.Step)
+		}
+	})
+
+	t.Run("EventBridgeEvent", func(t *testing.T) {
+		invocation, err := DecodeInvocation([]byte(`{"version":"0","id":"1","detail-type":"Rotation",
+			"source":"custom.rotation","detail":{"SecretId":"arn:secret","ClientRequestToken":"token",
+			"Step":"finishSecret"}}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, SourceEventBridge, invocation.Source)
+		if assert.NotNil(t, invocation.Event) {
+			assert.Equal(t, "finishSecret", *invocation.Event.Step)
+		}
+	})
+
+	t.Run("AdminAction", func(t *testing.T) {
+		invocation, err := DecodeInvocation([]byte(`{"action":"list-secrets","arguments":{"a":"b"}}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, SourceAdmin, invocation.Source)
+		assert.Nil(t, invocation.Event)
+		assert.Equal(t, &AdminAction{Action: ActionListSecrets, Arguments: map[string]string{"a": "b"}},
+			invocation.Action)
+	})
+
+	t.Run("EventBridgeAdminAction", func(t *testing.T) {
+		invocation, err := DecodeInvocation([]byte(`{"detail-type":"Scheduled Event",
+			"detail":{"action":"list-secrets"}}`))
+
+		assert.NoError(t, err)
+		assert.Equal(t, SourceEventBridge, invocation.Source)
+		assert.Equal(t, &AdminAction{Action: ActionListSecrets}, invocation.Action)
+	})
+
+	assertInvalid := func(t *testing.T, err error, field string, reason error) {
+		var validationError *erroer.RotatorValidationError
+		assert.ErrorAs(t, err, &validationError)
+		assert.Equal(t, erroer.ClassValidation, erroer.Class(err))
+
+		var eventError *erroer.EventError
+		if assert.True(t, errors.As(err, &eventError)) {
+			assert.Equal(t, field, eventError.Field)
+			assert.ErrorIs(t, eventError, reason)
+		}
+	}
+
+	malformed := []struct {
+		name    string
+		payload string
+		field   string
+	}{
+		{"Empty", ``, ""},
+		{"Null", `null`, ""},
+		{"NotAnObject", `["createSecret"]`, ""},
+		{"UnknownShape", `{"hello":"world"}`, ""},
+		{"WrongType", `{"SecretId":1,"ClientRequestToken":"token","Step":"createSecret"}`, ""},
+		{"EventBridgeDetailNotAnObject", `{"detail-type":"Rotation","detail":"createSecret"}`, "detail"},
+	}
+
+	for _, tc := range malformed {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := DecodeInvocation([]byte(tc.payload))
+			assertInvalid(t, err, tc.field, erroer.ErrEventMalformed)
+		})
+	}
+
+	// Decoded payloads are validated by their handler, with ValidateEvent or ValidateAdminAction.
+	invalid := []struct {
+		name    string
+		payload string
+		field   string
+		reason  error
+	}{
+		{"MissingToken", `{"SecretId":"arn:secret","Step":"createSecret"}`, "ClientRequestToken",
+			erroer.ErrEventFieldMissing},
+		{"EmptyStep", `{"SecretId":"arn:secret","ClientRequestToken":"token","Step":" "}`, "Step",
+			erroer.ErrEventFieldMissing},
+		{"UnknownStep", `{"SecretId":"arn:secret","ClientRequestToken":"token","Step":"dropSecret"}`, "Step",
+			erroer.ErrEventUnknownStep},
+		{"UnknownAction", `{"action":"drop-secrets"}`, "action", erroer.ErrEventUnknownAction},
+		{"RollbackWithoutSecret", `{"action":"rollback"}`, "secret_id", erroer.ErrEventFieldMissing},
+		{"EventBridgeInvalidDetail", `{"detail-type":"Rotation","detail":{"SecretId":"arn:secret"}}`,
+			"ClientRequestToken", erroer.ErrEventFieldMissing},
+	}
+
+	for _, tc := range invalid {
+		t.Run(tc.name, func(t *testing.T) {
+			invocation, err := DecodeInvocation([]byte(tc.payload))
+			if !assert.NoError(t, err) {
+				return
+			}
+
+			if invocation.Action != nil {
+				err = ValidateAdminAction(*invocation.Action)
+			} else {
+				err = ValidateEvent(*invocation.Event)
+			}
+
+			assertInvalid(t, err, tc.field, tc.reason)
+		})
+	}
+}
+
+func TestIsRotationAttemptValidDoesNotPanic(t *testing.T) {
+	rotator := &RotatorClient{Logger: zap.NewNop()}
+	step := "createSecret"
+
+	assert.NotPanics(t, func() {
+		err := rotator.IsRotationAttemptValid(Event{Step: &step})
+		assert.ErrorIs(t, err, erroer.ErrEventFieldMissing)
+	})
+}
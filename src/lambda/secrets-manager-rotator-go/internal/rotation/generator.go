@@ -0,0 +1,53 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"go.uber.org/zap"
+)
+
+// AWSGenerator generates passwords through the Secrets Manager GetRandomPassword API.
+type AWSGenerator struct {
+	Client client.SecretsManager
+}
+
+func (a *AWSGenerator) Generate(ctx context.Context, policy generator.Policy) (string, error) {
+	policy = policy.WithDefaults()
+	if policy.Format != generator.FormatPassword {
+		return "", fmt.Errorf("only passwords can be generated through the AWS API, "+
+			"use the local generator for %s values", policy.Format)
+	}
+
+	return a.Client.GenerateRandomPassword(ctx, int64(policy.Length), policy.ExcludeCharacters)
+}
+
+// NewValueGenerator returns the generator for the given source: either the Secrets Manager
+// API (aws), or the local cryptographic generator (local).
+func NewValueGenerator(source string, client client.SecretsManager) (generator.Generator, error) {
+	switch source {
+	case config.GeneratorSourceAWS:
+		return &AWSGenerator{Client: client}, nil
+	case config.GeneratorSourceLocal:
+		return generator.NewGenerator(), nil
+	}
+
+	return nil, erroer.NewConfigurationError(fmt.Sprintf(
+		"generator source %s is not supported, supported sources are: %s, %s", source,
+		config.GeneratorSourceAWS, config.GeneratorSourceLocal), nil)
+}
+
+// generateValue returns a new random value, suitable to be used as a secret value.
+func generateValue(ctx context.Context, logger *zap.Logger, gen generator.Generator,
+	policy generator.Policy) (string, error) {
+	newSecretValue, err := gen.Generate(ctx, policy)
+	if err != nil {
+		logger.Error("Error generating random secret value", zap.Error(err))
+		return "", erroer.NewRotationError("Error generating random secret value", err)
+	}
+
+	return newSecretValue, nil
+}
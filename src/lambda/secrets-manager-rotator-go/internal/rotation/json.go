@@ -0,0 +1,42 @@
+package rotation
+
+import (
+	"encoding/json"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"strings"
+)
+
+// parseJSONObject returns the fields of the given secret value, if it's a JSON object. Any
+// other value (including JSON strings, numbers, etc.) is treated as a raw secret value.
+func parseJSONObject(secretValue string) (map[string]interface{}, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(secretValue), "{") {
+		return nil, false
+	}
+
+	var value map[string]interface{}
+	if err := json.Unmarshal([]byte(secretValue), &value); err != nil {
+		return nil, false
+	}
+
+	return value, true
+}
+
+// withJSONFields returns the given JSON secret value, with the given fields replaced. The rest
+// of the fields (including unknown ones) are kept as they are.
+func withJSONFields(secretValue string, fields map[string]interface{}) (string, error) {
+	var value map[string]interface{}
+	if err := json.Unmarshal([]byte(secretValue), &value); err != nil {
+		return "", erroer.NewSecretError("secret value is not a valid JSON", err)
+	}
+
+	for key, field := range fields {
+		value[key] = field
+	}
+
+	newValue, err := json.Marshal(value)
+	if err != nil {
+		return "", erroer.NewRotationError("unable to build the new secret value", err)
+	}
+
+	return string(newValue), nil
+}
@@ -0,0 +1,44 @@
+package rotation
+
+import (
+	"context"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/adapter"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/notifier"
+	"go.uber.org/zap"
+)
+
+// NewNotifier builds the notifier of the rotation outcomes, with a sink for each one that's
+// configured. If none is, the returned notifier does nothing.
+func NewNotifier(ctx context.Context, cfg config.Notifications, logger *zap.Logger) (notifier.Notifier,
+	error) {
+	notifiers := notifier.MultiNotifier{}
+
+	if cfg.SNSTopicARN != "" || cfg.EventBusName != "" {
+		awsCfg, err := adapter.NewAWS(ctx, "", GetAWSOptions()...)
+		if err != nil {
+			return nil, erroer.NewConfigurationError("can't instantiate the AWS client of the notifiers", err)
+		}
+
+		if cfg.SNSTopicARN != "" {
+			notifiers = append(notifiers, notifier.NewSNSNotifier(awsCfg, cfg.SNSTopicARN))
+		}
+
+		if cfg.EventBusName != "" {
+			notifiers = append(notifiers, notifier.NewEventBridgeNotifier(awsCfg, cfg.EventBusName))
+		}
+	}
+
+	if cfg.WebhookURL != "" {
+		webhook, err := notifier.NewWebhookNotifier(cfg.WebhookURL, cfg.WebhookHeaders, nil)
+		if err != nil {
+			return nil, erroer.NewConfigurationError("invalid webhook notifier", err)
+		}
+
+		notifiers = append(notifiers, webhook)
+	}
+
+	logger.Info("Rotation notifier initialised", zap.Int("sinks", len(notifiers)))
+	return notifiers, nil
+}
@@ -0,0 +1,126 @@
+package rotation
+
+// Operations a dry-run step skips.
+const (
+	OperationPutSecretValue           = "PutSecretValue"
+	OperationUpdateSecretVersionStage = "UpdateSecretVersionStage"
+	OperationSetSecret                = "SetSecret"
+	OperationFinishSecret             = "FinishSecret"
+)
+
+// Checks run by the testSecret step, and by a dry-run createSecret step.
+const (
+	CheckPendingValue     = "pending-value"
+	CheckGenerationPolicy = "generation-policy"
+	CheckTargetSystem     = "target-system"
+	CheckReplicas         = "replicas"
+)
+
+// Plan is what a dry-run rotation would have done: the writes it skipped, the staging labels they
+// would have moved, and the checks it ran. Since the skipped writes can't be read back, a dry-run
+// of a step runs the steps before it too (see RotatorClient.PlanRotation). It never holds secret
+// values.
+type Plan struct {
+	SecretARN  string         `json:"secret_arn"`
+	Step       string         `json:"step"`
+	Token      string         `json:"token"`
+	Strategy   string         `json:"strategy"`
+	Steps      []string       `json:"steps"`
+	Writes     []PlannedWrite `json:"writes"`
+	LabelMoves []LabelMove    `json:"label_moves"`
+	Checks     []Check        `json:"checks"`
+}
+
+type PlannedWrite struct {
+	Step      string `json:"step"`
+	Operation string `json:"operation"`
+	VersionId string `json:"version_id,omitempty"`
+	Details   string `json:"details"`
+}
+
+// LabelMove is a staging label moved to a version. FromVersion is empty if no version held it.
+type LabelMove struct {
+	Step        string `json:"step"`
+	Label       string `json:"label"`
+	FromVersion string `json:"from_version,omitempty"`
+	ToVersion   string `json:"to_version"`
+}
+
+// Check is the outcome of a check. Skipped checks couldn't run because they depend on a skipped
+// write (e.g.: testing the AWSPENDING value in a target system it was never set in).
+type Check struct {
+	Step    string `json:"step"`
+	Name    string `json:"name"`
+	Passed  bool   `json:"passed"`
+	Skipped bool   `json:"skipped,omitempty"`
+	Details string `json:"details,omitempty"`
+}
+
+// Passed reports whether every check of the plan that ran passed.
+func (p *Plan) Passed() bool {
+	for _, check := range p.Checks {
+		if !check.Passed && !check.Skipped {
+			return false
+		}
+	}
+
+	return true
+}
+
+// currentStep is the step whose writes and checks are being recorded.
+func (p *Plan) currentStep() string {
+	if len(p.Steps) == 0 {
+		return ""
+	}
+
+	return p.Steps[len(p.Steps)-1]
+}
+
+// The methods below record the plan of a dry-run. They do nothing on a nil plan, so the steps
+// can call them unconditionally.
+
+func (p *Plan) start(step string) {
+	if p == nil {
+		return
+	}
+
+	p.Steps = append(p.Steps, step)
+}
+
+func (p *Plan) check(name string, err error) {
+	if p == nil {
+		return
+	}
+
+	check := Check{Step: p.currentStep(), Name: name, Passed: err == nil}
+	if err != nil {
+		check.Details = err.Error()
+	}
+
+	p.Checks = append(p.Checks, check)
+}
+
+func (p *Plan) skip(name, reason string) {
+	if p == nil {
+		return
+	}
+
+	p.Checks = append(p.Checks, Check{Step: p.currentStep(), Name: name, Skipped: true, Details: reason})
+}
+
+func (p *Plan) write(operation, versionId, details string) {
+	if p == nil {
+		return
+	}
+
+	p.Writes = append(p.Writes, PlannedWrite{Step: p.currentStep(), Operation: operation, VersionId: versionId, Details: details})
+}
+
+func (p *Plan) moveLabel(label, fromVersion, toVersion string) {
+	if p == nil {
+		return
+	}
+
+	p.LabelMoves = append(p.LabelMoves, LabelMove{Step: p.currentStep(), Label: label, FromVersion: fromVersion,
+		ToVersion: toVersion})
+}
@@ -0,0 +1,143 @@
+package rotation
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+)
+
+// constantGenerator always generates the same value, whatever the policy.
+type constantGenerator string
+
+func (g constantGenerator) Generate(ctx context.Context, policy generator.Policy) (string, error) {
+	return string(g), nil
+}
+
+func newPlanBackend(t *testing.T, startRotation bool) *client.InMemorySecretsManager {
+	backend := client.NewInMemorySecretsManager(zap.NewNop())
+	_, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:             testSecretArn,
+		Name:            "test",
+		Value:           `{"username":"app","password":"old"}`,
+		RotationEnabled: true,
+	})
+	assert.NoError(t, err)
+
+	if startRotation {
+		_, err = backend.StartRotation(testSecretArn, testToken)
+		assert.NoError(t, err)
+	}
+
+	return backend
+}
+
+func TestPlanRotation(t *testing.T) {
+	ctx := context.Background()
+	steps := GetSteps()
+	labels := GetStagingLabels()
+	event := Event{Arn: aws.String(testSecretArn), Token: aws.String(testToken), Step: aws.String(steps.Finish),
+		DryRun: true}
+
+	newRotator := func(backend client.SecretsManager, gen generator.Generator) *RotatorClient {
+		return &RotatorClient{
+			Logger:    zap.NewNop(),
+			Client:    backend,
+			JSONKeys:  config.DefaultJSONKeys,
+			Generator: gen,
+			Policy:    generator.DefaultPolicy(),
+			DryRun:    true,
+		}
+	}
+
+	t.Run("WholeRotation", func(t *testing.T) {
+		backend := newPlanBackend(t, true)
+		before, err := backend.GetSecret(ctx, testSecretArn)
+		assert.NoError(t, err)
+		currentVersion := findVersionWithStage(before.VersionIdsToStages, labels.Current)
+
+		rotator := newRotator(backend, generator.NewGenerator())
+		secret, err := rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+		assert.NoError(t, err)
+
+		plan, err := rotator.PlanRotation(ctx, event, secret, steps.Finish, GetSecretTypes().Static)
+		assert.NoError(t, err)
+		assert.True(t, plan.Passed())
+		assert.Equal(t, AllowedSteps, plan.Steps)
+		assert.Equal(t, testToken, plan.Token)
+
+		var operations []string
+		for _, write := range plan.Writes {
+			operations = append(operations, write.Operation)
+		}
+
+		assert.Equal(t, []string{OperationPutSecretValue, OperationSetSecret, OperationFinishSecret,
+			OperationUpdateSecretVersionStage}, operations)
+		assert.Equal(t, []LabelMove{
+			{Step: steps.Finish, Label: labels.Current, FromVersion: currentVersion, ToVersion: testToken},
+			{Step: steps.Finish, Label: labels.Previous, ToVersion: currentVersion},
+		}, plan.LabelMoves, "AWSPENDING already holds the token, so it doesn't move")
+
+		checks := map[string]Check{}
+		for _, check := range plan.Checks {
+			checks[check.Step+"/"+check.Name] = check
+		}
+
+		assert.True(t, checks[steps.Create+"/"+CheckGenerationPolicy].Passed)
+		assert.True(t, checks[steps.Test+"/"+CheckPendingValue].Passed)
+		assert.True(t, checks[steps.Test+"/"+CheckGenerationPolicy].Passed)
+		assert.True(t, checks[steps.Test+"/"+CheckTargetSystem].Skipped)
+		assert.True(t, checks[steps.Test+"/"+CheckReplicas].Skipped)
+
+		after, err := backend.GetSecret(ctx, testSecretArn)
+		assert.NoError(t, err)
+		assert.Equal(t, before.VersionIdsToStages, after.VersionIdsToStages, "a dry-run must not move any label")
+
+		_, err = backend.GetSecretValueByStageLabel(ctx, testSecretArn, testToken, labels.Pending)
+		assert.Error(t, err, "a dry-run must not store the AWSPENDING value")
+	})
+
+	t.Run("RotationNotStarted", func(t *testing.T) {
+		backend := newPlanBackend(t, false)
+
+		rotator := newRotator(backend, generator.NewGenerator())
+		rotator.DryRun = false
+		_, err := rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+		assert.Error(t, err)
+
+		rotator.DryRun = true
+		secret, err := rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+		assert.NoError(t, err)
+
+		plan, err := rotator.PlanRotation(ctx, event, secret, steps.Create, GetSecretTypes().Static)
+		assert.NoError(t, err)
+		assert.Equal(t, []string{steps.Create}, plan.Steps)
+		assert.Equal(t, []LabelMove{{Step: steps.Create, Label: labels.Pending, ToVersion: testToken}},
+			plan.LabelMoves)
+	})
+
+	t.Run("FailedCheck", func(t *testing.T) {
+		backend := newPlanBackend(t, true)
+
+		rotator := newRotator(backend, constantGenerator("short"))
+		secret, err := rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+		assert.NoError(t, err)
+
+		plan, err := rotator.PlanRotation(ctx, event, secret, steps.Finish, GetSecretTypes().Static)
+		var rotationError *erroer.RotationError
+		assert.ErrorAs(t, err, &rotationError)
+
+		if assert.NotNil(t, plan) && assert.Len(t, plan.Checks, 1) {
+			assert.False(t, plan.Passed())
+			assert.Equal(t, CheckGenerationPolicy, plan.Checks[0].Name)
+			assert.NotEmpty(t, plan.Checks[0].Details)
+		}
+
+		assert.Empty(t, plan.Writes)
+	})
+}
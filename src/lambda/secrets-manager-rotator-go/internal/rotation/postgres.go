@@ -0,0 +1,152 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/database"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"go.uber.org/zap"
+)
+
+// PostgresStrategy rotates the password of a single PostgreSQL user. The secret value holds
+// the database credentials as JSON (host, port, username, password and dbname).
+type PostgresStrategy struct {
+	Logger    *zap.Logger
+	Client    client.SecretsManager
+	Generator generator.Generator
+	Policy    generator.Policy
+	Driver    database.Driver
+	// SecretARN is the ARN of the secret, to log in with its AWSPREVIOUS credentials when the
+	// AWSCURRENT ones don't work.
+	SecretARN string
+}
+
+func (p *PostgresStrategy) CreateSecret(ctx context.Context, current string) (string, error) {
+	if _, err := database.ParseCredentials(current); err != nil {
+		p.Logger.Error("AWSCURRENT secret value is not a valid postgres credential", zap.Error(err))
+		return "", erroer.NewSecretError("AWSCURRENT secret value is not a valid postgres credential", err)
+	}
+
+	newPassword, err := generateValue(ctx, p.Logger, p.Generator, p.Policy)
+	if err != nil {
+		return "", err
+	}
+
+	return withJSONFields(current, map[string]interface{}{"password": newPassword})
+}
+
+func (p *PostgresStrategy) SetSecret(ctx context.Context, current, pending string) error {
+	currentCreds, err := database.ParseCredentials(current)
+	if err != nil {
+		p.Logger.Error("AWSCURRENT secret value is not a valid postgres credential", zap.Error(err))
+		return erroer.NewSecretError("AWSCURRENT secret value is not a valid postgres credential", err)
+	}
+
+	pendingCreds, err := database.ParseCredentials(pending)
+	if err != nil {
+		p.Logger.Error("AWSPENDING secret value is not a valid postgres credential", zap.Error(err))
+		return erroer.NewSecretError("AWSPENDING secret value is not a valid postgres credential", err)
+	}
+
+	// If the pending credentials already work, the password was set on a previous attempt.
+	if err := p.Driver.Ping(ctx, pendingCreds); err == nil {
+		p.Logger.Info(fmt.Sprintf("AWSPENDING password is already set for postgres user %s",
+			pendingCreds.Username))
+		return nil
+	}
+
+	loginCreds, err := p.loginCredentials(ctx, currentCreds)
+	if err != nil {
+		return err
+	}
+
+	if err := p.Driver.SetPassword(ctx, loginCreds, pendingCreds.Username, pendingCreds.Password); err != nil {
+		p.Logger.Error(fmt.Sprintf("Error setting the AWSPENDING password for postgres user %s",
+			pendingCreds.Username), zap.Error(err))
+		return erroer.NewRotationError(fmt.Sprintf(
+			"error setting the AWSPENDING password for postgres user %s", pendingCreds.Username), err)
+	}
+
+	p.Logger.Info(fmt.Sprintf("AWSPENDING password set for postgres user %s", pendingCreds.Username))
+	return nil
+}
+
+// loginCredentials returns the credentials to set the AWSPENDING password with: the AWSCURRENT
+// ones or, if they don't work (e.g.: the password was changed outside of the rotation), the
+// AWSPREVIOUS ones.
+func (p *PostgresStrategy) loginCredentials(ctx context.Context, currentCreds database.Credentials) (
+	database.Credentials, error) {
+	currentErr := p.Driver.Ping(ctx, currentCreds)
+	if currentErr == nil {
+		return currentCreds, nil
+	}
+
+	if p.Client != nil && p.SecretARN != "" {
+		previous, err := p.Client.GetSecretValueByStageLabel(ctx, p.SecretARN, "", GetStagingLabels().Previous)
+		if err == nil {
+			previousCreds, err := database.ParseCredentials(aws.ToString(previous.SecretString))
+			if err == nil && p.Driver.Ping(ctx, previousCreds) == nil {
+				p.Logger.Warn(fmt.Sprintf("Unable to log in as postgres user %s with the AWSCURRENT password, "+
+					"the AWSPREVIOUS one is used", currentCreds.Username))
+				return previousCreds, nil
+			}
+		}
+	}
+
+	p.Logger.Error(fmt.Sprintf("Unable to log in as postgres user %s with the AWSCURRENT or AWSPREVIOUS "+
+		"password", currentCreds.Username), zap.Error(currentErr))
+	return database.Credentials{}, erroer.NewRotationError(fmt.Sprintf(
+		"unable to log in as postgres user %s with the AWSCURRENT or AWSPREVIOUS password",
+		currentCreds.Username), currentErr)
+}
+
+func (p *PostgresStrategy) TestSecret(ctx context.Context, pending string) error {
+	pendingCreds, err := database.ParseCredentials(pending)
+	if err != nil {
+		p.Logger.Error("AWSPENDING secret value is not a valid postgres credential", zap.Error(err))
+		return erroer.NewSecretError("AWSPENDING secret value is not a valid postgres credential", err)
+	}
+
+	if err := p.Driver.Ping(ctx, pendingCreds); err != nil {
+		p.Logger.Error(fmt.Sprintf("Unable to log in as postgres user %s with the AWSPENDING password",
+			pendingCreds.Username), zap.Error(err))
+		return erroer.NewRotationError(fmt.Sprintf(
+			"unable to log in as postgres user %s with the AWSPENDING password",
+			pendingCreds.Username), err)
+	}
+
+	return nil
+}
+
+func (p *PostgresStrategy) FinishSecret(ctx context.Context, current, pending string) error {
+	return nil
+}
+
+func (p *PostgresStrategy) GeneratedValues(pending string) ([]string, error) {
+	pendingCreds, err := database.ParseCredentials(pending)
+	if err != nil {
+		return nil, erroer.NewSecretError("AWSPENDING secret value is not a valid postgres credential", err)
+	}
+
+	return []string{pendingCreds.Password}, nil
+}
+
+func NewPostgresStrategy(opts StrategyOptions) (RotationStrategy, error) {
+	if err := rejectSecretJSONKeys(opts, GetSecretTypes().Db); err != nil {
+		return nil, err
+	}
+
+	opts = opts.withDefaults()
+
+	return &PostgresStrategy{
+		Logger:    opts.Logger,
+		Client:    opts.Client,
+		Generator: opts.Generator,
+		Policy:    opts.Policy,
+		Driver:    database.NewPostgresDriver(),
+		SecretARN: opts.SecretARN,
+	}, nil
+}
@@ -0,0 +1,142 @@
+package rotation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"go.uber.org/zap"
+	"time"
+)
+
+const DefaultReplicaPollInterval = 2 * time.Second
+
+// ReplicaClientFactory builds the Secrets Manager client of a replica region.
+type ReplicaClientFactory func(ctx context.Context, region string) (client.SecretsManager, error)
+
+// ReplicaOptions configures how long the testSecret step waits for the AWSPENDING version to be
+// visible in every replica region. If Clients is nil, the replicas aren't checked.
+type ReplicaOptions struct {
+	Clients      ReplicaClientFactory
+	Timeout      time.Duration
+	PollInterval time.Duration
+}
+
+// checkReplicationStatus fails if any replica of the secret is in a failed state, since the
+// new value would never reach that region.
+func checkReplicationStatus(secret *secretsmanager.DescribeSecretOutput) error {
+	for _, replica := range secret.ReplicationStatus {
+		if replica.Status == types.StatusTypeFailed {
+			return fmt.Errorf("replica in region %s is in a failed state: %s",
+				aws.ToString(replica.Region), aws.ToString(replica.StatusMessage))
+		}
+	}
+
+	return nil
+}
+
+// waitForReplicas waits, up to the replica timeout, until the AWSPENDING version is visible in
+// every replica region of the secret.
+func (s *StepsClient) waitForReplicas(ctx context.Context) error {
+	if len(s.SecretData.ReplicationStatus) == 0 {
+		return nil
+	}
+
+	if s.Replicas.Clients == nil {
+		s.Logger.Warn("The secret has replicas, but there are no replica clients to check them")
+		return nil
+	}
+
+	timeout := s.Replicas.Timeout
+	if timeout <= 0 {
+		timeout = config.DefaultReplicaTimeout
+	}
+
+	interval := s.Replicas.PollInterval
+	if interval <= 0 {
+		interval = DefaultReplicaPollInterval
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	for _, replica := range s.SecretData.ReplicationStatus {
+		region := aws.ToString(replica.Region)
+		if err := s.waitForReplica(waitCtx, region, interval); err != nil {
+			// Only the expiry of the replica timeout is a timeout, not an API call that timed out
+			// on its own.
+			if ctx.Err() == nil && errors.Is(waitCtx.Err(), context.DeadlineExceeded) {
+				s.Logger.Error(fmt.Sprintf("AWSPENDING secret version is not visible in replica region %s",
+					region), zap.Error(err))
+				return erroer.NewRotationError(fmt.Sprintf(
+					"AWSPENDING secret version is not visible in replica region %s after %s", region,
+					timeout), err)
+			}
+
+			var secretError *erroer.SecretError
+			if errors.As(err, &secretError) {
+				s.Logger.Error(fmt.Sprintf("Unable to read the AWSPENDING secret version in replica region %s",
+					region), zap.Error(err))
+				return err
+			}
+
+			s.Logger.Error(fmt.Sprintf("Unable to check the AWSPENDING secret version in replica region %s",
+				region), zap.Error(err))
+			return erroer.NewRotationError(fmt.Sprintf(
+				"unable to check the AWSPENDING secret version in replica region %s", region), err)
+		}
+
+		s.Logger.Info(fmt.Sprintf("AWSPENDING secret version is visible in replica region %s", region))
+	}
+
+	return nil
+}
+
+func (s *StepsClient) waitForReplica(ctx context.Context, region string, interval time.Duration) error {
+	replicaClient, err := s.Replicas.Clients(ctx, region)
+	if err != nil {
+		return err
+	}
+
+	secretId, err := replicaArn(*s.SecretData.ARN, region)
+	if err != nil {
+		return err
+	}
+
+	token := *s.SecretEvent.Token
+	for {
+		_, err := replicaClient.GetSecretValue(ctx, secretId, token, s.StagingLabels.Pending)
+		if err == nil {
+			return nil
+		}
+
+		var notFound *types.ResourceNotFoundException
+		if !errors.As(err, &notFound) {
+			return erroer.NewSecretError(fmt.Sprintf(
+				"unable to read the AWSPENDING secret version in replica region %s", region), err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// replicaArn returns the ARN of the replica of the secret in the given region.
+func replicaArn(secretArn, region string) (string, error) {
+	parsed, err := arn.Parse(secretArn)
+	if err != nil {
+		return "", fmt.Errorf("invalid secret arn %s: %w", secretArn, err)
+	}
+
+	parsed.Region = region
+	return parsed.String(), nil
+}
@@ -0,0 +1,134 @@
+package rotation
+
+import (
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+	"time"
+)
+
+const testReplicaArn = "arn:aws:secretsmanager:eu-west-1:123456789012:secret:test-AbCdEf"
+
+func TestIsSecretValidToRotateFailedReplica(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	backend := client.NewInMemorySecretsManager(logger)
+
+	_, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:             testSecretArn,
+		Name:            "test",
+		Value:           "value",
+		RotationEnabled: true,
+		Replicas: []types.ReplicationStatusType{{
+			Region:        aws.String("eu-west-1"),
+			Status:        types.StatusTypeFailed,
+			StatusMessage: aws.String("access denied to the kms key"),
+		}},
+	})
+	assert.NoError(t, err)
+
+	_, err = backend.StartRotation(testSecretArn, testToken)
+	assert.NoError(t, err)
+
+	rotator := &RotatorClient{Logger: logger, Client: backend}
+	_, err = rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+
+	var validationError *erroer.RotatorValidationError
+	assert.ErrorAs(t, err, &validationError)
+}
+
+// timingOutClient fails every read, as if the API call timed out.
+type timingOutClient struct {
+	client.SecretsManager
+}
+
+func (t *timingOutClient) GetSecretValue(ctx context.Context, arn, token,
+	stage string) (*secretsmanager.GetSecretValueOutput, error) {
+	return nil, context.DeadlineExceeded
+}
+
+func TestWaitForReplicas(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	replica := client.NewInMemorySecretsManager(logger)
+
+	_, err := replica.CreateSecret(client.InMemorySecretInput{
+		ARN:   testReplicaArn,
+		Name:  "test",
+		Value: "value",
+	})
+	assert.NoError(t, err)
+
+	var requestedRegions []string
+	steps := &StepsClient{
+		Logger:        logger,
+		SecretEvent:   Event{Token: aws.String(testToken)},
+		StagingLabels: GetStagingLabels(),
+		SecretData: &secretsmanager.DescribeSecretOutput{
+			ARN: aws.String(testSecretArn),
+			ReplicationStatus: []types.ReplicationStatusType{{
+				Region: aws.String("eu-west-1"),
+				Status: types.StatusTypeInSync,
+			}},
+		},
+		Replicas: ReplicaOptions{
+			Clients: func(ctx context.Context, region string) (client.SecretsManager, error) {
+				requestedRegions = append(requestedRegions, region)
+				return replica, nil
+			},
+			Timeout:      50 * time.Millisecond,
+			PollInterval: 5 * time.Millisecond,
+		},
+	}
+
+	t.Run("NotPropagated", func(t *testing.T) {
+		err := steps.waitForReplicas(ctx)
+
+		var rotationError *erroer.RotationError
+		assert.ErrorAs(t, err, &rotationError)
+		assert.ErrorContains(t, err, "after 50ms")
+	})
+
+	t.Run("ReplicaUnreachable", func(t *testing.T) {
+		unreachable := *steps
+		unreachable.Replicas.Clients = func(ctx context.Context, region string) (client.SecretsManager, error) {
+			return nil, errors.New("no credentials for eu-west-1")
+		}
+
+		err := unreachable.waitForReplicas(ctx)
+
+		var rotationError *erroer.RotationError
+		assert.ErrorAs(t, err, &rotationError)
+		assert.ErrorContains(t, err, "no credentials for eu-west-1")
+		assert.NotContains(t, err.Error(), "after 50ms", "only a timeout is reported as one")
+	})
+
+	t.Run("CallDeadlineExceeded", func(t *testing.T) {
+		timingOut := *steps
+		timingOut.Replicas.Clients = func(ctx context.Context, region string) (client.SecretsManager, error) {
+			return &timingOutClient{SecretsManager: replica}, nil
+		}
+
+		err := timingOut.waitForReplicas(ctx)
+
+		var secretError *erroer.SecretError
+		assert.ErrorAs(t, err, &secretError)
+		assert.ErrorContains(t, err, context.DeadlineExceeded.Error())
+		assert.NotContains(t, err.Error(), "after 50ms", "only the replica timeout is reported as one")
+	})
+
+	t.Run("Propagated", func(t *testing.T) {
+		_, err := replica.PutSecretValue(ctx, testReplicaArn, testToken, "new-value", "AWSPENDING")
+		assert.NoError(t, err)
+
+		assert.NoError(t, steps.waitForReplicas(ctx))
+		assert.Contains(t, requestedRegions, "eu-west-1")
+	})
+}
@@ -0,0 +1,56 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/arn"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// ResolveRoleARN returns the role to assume to rotate the given secret, or an empty string if
+// the lambda's own credentials have to be used. The account roles (keyed by the account id
+// of the secret ARN) are checked first, since they don't need any API call. Otherwise, the
+// RoleTagKey tag of the secret is used, read with the lambda's own credentials (which requires
+// a resource policy on the secret, if it lives in another account). If the tags can't be read,
+// the role is unknown, so a configuration error is returned instead of falling back to the
+// lambda's own credentials. The secret read to get its tags is returned too (nil if it wasn't
+// read), so the rotator doesn't describe it again.
+func ResolveRoleARN(ctx context.Context, logger *zap.Logger, smClient client.SecretsManager,
+	secretId string, accountRoles map[string]string) (string, *secretsmanager.DescribeSecretOutput, error) {
+	if secretId == "" {
+		return "", nil, nil
+	}
+
+	if parsed, err := arn.Parse(secretId); err == nil {
+		if role, ok := accountRoles[parsed.AccountID]; ok {
+			logger.Info(fmt.Sprintf("Secret %s belongs to account %s, role %s will be assumed",
+				secretId, parsed.AccountID, role))
+			return role, nil, nil
+		}
+	}
+
+	secret, err := smClient.GetSecret(ctx, secretId)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Unable to read the tags of secret %s to resolve the role to assume",
+			secretId), zap.Error(err))
+		return "", nil, erroer.NewConfigurationError(fmt.Sprintf(
+			"unable to read the tags of secret %s to resolve the role to assume", secretId), err)
+	}
+
+	for _, tag := range secret.Tags {
+		if aws.ToString(tag.Key) == RoleTagKey {
+			if role := strings.TrimSpace(aws.ToString(tag.Value)); role != "" {
+				logger.Info(fmt.Sprintf("Secret %s is tagged with role %s, it will be assumed", secretId,
+					role))
+				return role, secret, nil
+			}
+		}
+	}
+
+	return "", secret, nil
+}
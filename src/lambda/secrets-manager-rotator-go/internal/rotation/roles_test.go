@@ -0,0 +1,92 @@
+package rotation
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestResolveRoleARN(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	backend := client.NewInMemorySecretsManager(logger)
+
+	taggedArn, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:   "arn:aws:secretsmanager:us-east-1:111111111111:secret:tagged-AbCdEf",
+		Name:  "tagged",
+		Value: "value",
+		Tags:  map[string]string{RoleTagKey: "arn:aws:iam::111111111111:role/tagged-rotator"},
+	})
+	assert.NoError(t, err)
+
+	untaggedArn, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:   "arn:aws:secretsmanager:us-east-1:111111111111:secret:untagged-AbCdEf",
+		Name:  "untagged",
+		Value: "value",
+	})
+	assert.NoError(t, err)
+
+	accountRoles := map[string]string{"222222222222": "arn:aws:iam::222222222222:role/rotator"}
+
+	t.Run("AccountRole", func(t *testing.T) {
+		role, described, err := ResolveRoleARN(ctx, logger, backend,
+			"arn:aws:secretsmanager:us-east-1:222222222222:secret:other-AbCdEf", accountRoles)
+		assert.NoError(t, err)
+		assert.Equal(t, "arn:aws:iam::222222222222:role/rotator", role)
+		assert.Nil(t, described, "the secret shouldn't be read if its account has a role")
+	})
+
+	t.Run("Tag", func(t *testing.T) {
+		role, described, err := ResolveRoleARN(ctx, logger, backend, taggedArn, accountRoles)
+		assert.NoError(t, err)
+		assert.Equal(t, "arn:aws:iam::111111111111:role/tagged-rotator", role)
+		assert.Equal(t, taggedArn, aws.ToString(described.ARN))
+	})
+
+	t.Run("OwnCredentials", func(t *testing.T) {
+		role, described, err := ResolveRoleARN(ctx, logger, backend, untaggedArn, accountRoles)
+		assert.NoError(t, err)
+		assert.Empty(t, role)
+		assert.Equal(t, untaggedArn, aws.ToString(described.ARN))
+	})
+
+	t.Run("UnreadableTags", func(t *testing.T) {
+		_, _, err := ResolveRoleARN(ctx, logger, backend, "not-found", accountRoles)
+
+		var configurationError *erroer.RotatorConfigurationError
+		assert.ErrorAs(t, err, &configurationError)
+	})
+}
+
+func TestIsSecretValidToRotateReusesResolvedSecret(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	backend := client.NewInMemorySecretsManager(logger)
+
+	_, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:             testSecretArn,
+		Name:            "test",
+		Value:           "value",
+		RotationEnabled: true,
+	})
+	assert.NoError(t, err)
+
+	_, err = backend.StartRotation(testSecretArn, testToken)
+	assert.NoError(t, err)
+
+	_, described, err := ResolveRoleARN(ctx, logger, backend, testSecretArn, nil)
+	assert.NoError(t, err)
+
+	rotator := &RotatorClient{Logger: logger, Client: backend, described: described}
+	secret, err := rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+	assert.NoError(t, err)
+	assert.Same(t, described, secret, "the secret read to resolve the role should be reused")
+
+	secret, err = rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+	assert.NoError(t, err)
+	assert.NotSame(t, described, secret, "the secret should be described again afterwards")
+}
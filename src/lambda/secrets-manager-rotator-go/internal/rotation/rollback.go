@@ -0,0 +1,202 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/audit"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/notifier"
+	"go.uber.org/zap"
+	"strings"
+	"time"
+)
+
+// StepRollback is the step of the audit records of the rollbacks.
+const StepRollback = "rollback"
+
+type RollbackOptions struct {
+	// RestoreTarget runs the SetSecret hook of the strategy, to set the AWSPREVIOUS value back in
+	// the target system (e.g.: a database) before AWSCURRENT is moved.
+	RestoreTarget bool
+	// OnlyIfTestFails tests the AWSCURRENT value in the target system first, and only rolls back
+	// if the test fails.
+	OnlyIfTestFails bool
+	// Reason is recorded in the audit record.
+	Reason string
+	// Audit records the rollback, with the value fingerprints salted with Salt. If it's nil, the
+	// rollback is only logged.
+	Audit audit.Sink
+	Salt  string
+}
+
+// RollbackResult is the outcome of a rollback. FromVersion was AWSCURRENT, and ToVersion held
+// AWSPREVIOUS and is AWSCURRENT now, unless the rollback was skipped.
+type RollbackResult struct {
+	SecretARN      string `json:"secret_arn"`
+	Strategy       string `json:"strategy"`
+	FromVersion    string `json:"from_version"`
+	ToVersion      string `json:"to_version"`
+	RolledBack     bool   `json:"rolled_back"`
+	TargetRestored bool   `json:"target_restored"`
+	// TestError is why the AWSCURRENT value failed its test, if it was tested.
+	TestError string `json:"test_error,omitempty"`
+}
+
+// Rollback moves AWSCURRENT back to the version that holds AWSPREVIOUS (Secrets Manager then
+// moves AWSPREVIOUS to the version that was AWSCURRENT, so rolling back twice undoes it).
+// Every rollback that's attempted is logged and audited, whether it succeeds or not.
+func (r *RotatorClient) Rollback(ctx context.Context, secretId string, opts RollbackOptions) (*RollbackResult,
+	error) {
+	started := time.Now()
+	result := &RollbackResult{SecretARN: secretId}
+
+	err := r.rollback(ctx, secretId, opts, result)
+	if err == nil && !result.RolledBack {
+		return result, nil
+	}
+
+	if auditErr := r.auditRollback(ctx, opts, result, started, err); auditErr != nil {
+		r.Logger.Error("Unable to write the audit record of the rollback", zap.Error(auditErr))
+		if err == nil {
+			err = erroer.NewRotationError("unable to write the audit record of the rollback", auditErr)
+		}
+	}
+
+	return result, err
+}
+
+func (r *RotatorClient) rollback(ctx context.Context, secretId string, opts RollbackOptions,
+	result *RollbackResult) error {
+	labels := GetStagingLabels()
+
+	secret, err := r.describeSecret(ctx, secretId)
+	if err != nil {
+		r.Logger.Error(fmt.Sprintf("Error getting secret with arn: %s", secretId), zap.Error(err))
+		return erroer.NewValidationError(fmt.Sprintf("error getting secret with arn: %s", secretId), err)
+	}
+
+	arn := aws.ToString(secret.ARN)
+	result.SecretARN = arn
+
+	if !config.IsNameAllowed(aws.ToString(secret.Name), r.AllowedPrefixes) {
+		r.Logger.Error(fmt.Sprintf("Secret %s is not allowed to be rolled back by this lambda", arn))
+		return erroer.NewValidationError(fmt.Sprintf(
+			"secret %s is not allowed to be rolled back by this lambda, its name must start with: %s", arn,
+			strings.Join(r.AllowedPrefixes, ", ")), nil)
+	}
+
+	result.FromVersion = findVersionWithStage(secret.VersionIdsToStages, labels.Current)
+	result.ToVersion = findVersionWithStage(secret.VersionIdsToStages, labels.Previous)
+	if result.FromVersion == "" || result.ToVersion == "" {
+		r.Logger.Error(fmt.Sprintf("Secret %s has no %s or no %s version to roll back to", arn,
+			labels.Current, labels.Previous))
+		return erroer.NewSecretError(fmt.Sprintf("secret %s has no %s or no %s version to roll back to",
+			arn, labels.Current, labels.Previous), nil)
+	}
+
+	secretType, err := r.ResolveSecretType(ctx, secret)
+	if err != nil {
+		return err
+	}
+
+	result.Strategy = secretType
+	strategy, _, err := r.newStrategy(secret, secretType)
+	if err != nil {
+		return err
+	}
+
+	current, err := r.Client.GetSecretValue(ctx, arn, result.FromVersion, labels.Current)
+	if err != nil {
+		r.Logger.Error("Error getting the AWSCURRENT secret version", zap.Error(err))
+		return erroer.NewSecretError("error getting the AWSCURRENT secret version", err)
+	}
+
+	previous, err := r.Client.GetSecretValue(ctx, arn, result.ToVersion, labels.Previous)
+	if err != nil {
+		r.Logger.Error("Error getting the AWSPREVIOUS secret version", zap.Error(err))
+		return erroer.NewSecretError("error getting the AWSPREVIOUS secret version", err)
+	}
+
+	if opts.OnlyIfTestFails {
+		testErr := strategy.TestSecret(ctx, aws.ToString(current.SecretString))
+		if testErr == nil {
+			r.Logger.Info(fmt.Sprintf("AWSCURRENT version %s of secret %s passed its test, it's not rolled back",
+				result.FromVersion, arn))
+			return nil
+		}
+
+		result.TestError = testErr.Error()
+		r.Logger.Warn(fmt.Sprintf("AWSCURRENT version %s of secret %s failed its test, rolling it back",
+			result.FromVersion, arn), zap.Error(testErr))
+	}
+
+	result.RolledBack = true
+
+	// The target system is restored first, so AWSCURRENT never holds a value it doesn't accept.
+	if opts.RestoreTarget {
+		if err := strategy.SetSecret(ctx, aws.ToString(current.SecretString),
+			aws.ToString(previous.SecretString)); err != nil {
+			r.Logger.Error(fmt.Sprintf("Error restoring the AWSPREVIOUS value of secret %s in the target system",
+				arn), zap.Error(err))
+			return err
+		}
+
+		result.TargetRestored = true
+	}
+
+	r.Logger.Info(fmt.Sprintf("Rolling back secret %s", arn), zap.String("version", result.ToVersion),
+		zap.String("previousVersion", result.FromVersion), zap.String("reason", opts.Reason))
+
+	if _, err := r.Client.UpdateSecretVersion(ctx, arn, result.ToVersion, labels.Current,
+		result.FromVersion); err != nil {
+		r.Logger.Error(fmt.Sprintf("Error setting version %s as %s in secret %s", result.ToVersion,
+			labels.Current, arn), zap.Error(err))
+		return erroer.NewRotationError(fmt.Sprintf("error setting version %s as %s in secret %s",
+			result.ToVersion, labels.Current, arn), err)
+	}
+
+	r.Logger.Info(fmt.Sprintf("Secret %s rolled back to version %s", arn, result.ToVersion))
+	return nil
+}
+
+// auditRollback writes the audit record of the rollback. The version rolled back to is recorded
+// as the pending version, since it's the one that becomes AWSCURRENT.
+func (r *RotatorClient) auditRollback(ctx context.Context, opts RollbackOptions, result *RollbackResult,
+	started time.Time, err error) error {
+	if opts.Audit == nil {
+		return nil
+	}
+
+	outcome := notifier.NewEvent(result.SecretARN, StepRollback, result.ToVersion, time.Since(started), err)
+
+	record := audit.Record{
+		SecretArn:        outcome.SecretArn,
+		Timestamp:        outcome.Timestamp,
+		Step:             outcome.Step,
+		Outcome:          string(outcome.Outcome),
+		ErrorClass:       outcome.ErrorClass,
+		PendingVersionID: result.ToVersion,
+		CurrentVersionID: result.FromVersion,
+		Reason:           opts.Reason,
+	}
+
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		record.RequestID = lc.AwsRequestID
+		record.FunctionArn = lc.InvokedFunctionArn
+	}
+
+	if err == nil {
+		restored, valueErr := r.Client.GetSecretValue(ctx, result.SecretARN, result.ToVersion,
+			GetStagingLabels().Current)
+		if valueErr != nil {
+			r.Logger.Warn("Unable to read the restored AWSCURRENT value to fingerprint it", zap.Error(valueErr))
+		} else {
+			record.Fingerprint = audit.Fingerprint(opts.Salt, aws.ToString(restored.SecretString))
+		}
+	}
+
+	return opts.Audit.Write(ctx, record)
+}
@@ -0,0 +1,174 @@
+package rotation
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/audit"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"path/filepath"
+	"testing"
+)
+
+const targetStrategyName = "target-test"
+
+// targetStrategy models a target system that accepts a single value: the last one set in it.
+type targetStrategy struct {
+	RotationStrategy
+	accepted string
+}
+
+func (s *targetStrategy) SetSecret(ctx context.Context, current, pending string) error {
+	s.accepted = pending
+	return nil
+}
+
+func (s *targetStrategy) TestSecret(ctx context.Context, pending string) error {
+	if pending != s.accepted {
+		return erroer.NewRotationError("unable to log in", nil)
+	}
+
+	return nil
+}
+
+// newRolloutBackend returns a secret whose value was rotated from "good" to "bad", and the target
+// system of its strategy, which only accepts the value set in it.
+func newRolloutBackend(t *testing.T, accepted string) (*client.InMemorySecretsManager, *targetStrategy) {
+	ctx := context.Background()
+	target := &targetStrategy{accepted: accepted}
+	RegisterStrategy(targetStrategyName, func(opts StrategyOptions) (RotationStrategy, error) {
+		return target, nil
+	})
+
+	backend := client.NewInMemorySecretsManager(zap.NewNop())
+	_, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:             testSecretArn,
+		Name:            "test",
+		Value:           "good",
+		RotationEnabled: true,
+		Tags:            map[string]string{StrategyTagKey: targetStrategyName},
+	})
+	assert.NoError(t, err)
+
+	secret, err := backend.GetSecret(ctx, testSecretArn)
+	assert.NoError(t, err)
+	goodVersion := findVersionWithStage(secret.VersionIdsToStages, GetStagingLabels().Current)
+
+	_, err = backend.StartRotation(testSecretArn, testToken)
+	assert.NoError(t, err)
+	_, err = backend.PutSecretValue(ctx, testSecretArn, testToken, "bad", GetStagingLabels().Pending)
+	assert.NoError(t, err)
+	_, err = backend.UpdateSecretVersion(ctx, testSecretArn, testToken, GetStagingLabels().Current, goodVersion)
+	assert.NoError(t, err)
+
+	return backend, target
+}
+
+func TestRollback(t *testing.T) {
+	ctx := context.Background()
+	labels := GetStagingLabels()
+
+	newRotator := func(backend client.SecretsManager) *RotatorClient {
+		return &RotatorClient{Logger: zap.NewNop(), Client: backend}
+	}
+
+	t.Run("OnDemand", func(t *testing.T) {
+		backend, target := newRolloutBackend(t, "bad")
+		sink := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+		result, err := newRotator(backend).Rollback(ctx, testSecretArn, RollbackOptions{
+			RestoreTarget: true,
+			Reason:        "bad value promoted",
+			Audit:         sink,
+			Salt:          "salt",
+		})
+		assert.NoError(t, err)
+		assert.True(t, result.RolledBack)
+		assert.True(t, result.TargetRestored)
+		assert.Equal(t, testToken, result.FromVersion)
+		assert.Equal(t, targetStrategyName, result.Strategy)
+		assert.Equal(t, "good", target.accepted)
+
+		current, err := backend.GetSecretValue(ctx, testSecretArn, "", labels.Current)
+		assert.NoError(t, err)
+		assert.Equal(t, "good", aws.ToString(current.SecretString))
+		assert.Equal(t, result.ToVersion, aws.ToString(current.VersionId))
+
+		previous, err := backend.GetSecretValue(ctx, testSecretArn, "", labels.Previous)
+		assert.NoError(t, err)
+		assert.Equal(t, testToken, aws.ToString(previous.VersionId))
+
+		records, err := sink.Query(ctx, testSecretArn)
+		assert.NoError(t, err)
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, StepRollback, records[0].Step)
+			assert.Equal(t, "succeeded", records[0].Outcome)
+			assert.Equal(t, "bad value promoted", records[0].Reason)
+			assert.Equal(t, testToken, records[0].CurrentVersionID)
+			assert.Equal(t, result.ToVersion, records[0].PendingVersionID)
+			assert.Equal(t, audit.Fingerprint("salt", "good"), records[0].Fingerprint)
+		}
+	})
+
+	t.Run("TestPasses", func(t *testing.T) {
+		backend, _ := newRolloutBackend(t, "bad")
+		sink := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+		result, err := newRotator(backend).Rollback(ctx, testSecretArn, RollbackOptions{
+			OnlyIfTestFails: true,
+			Audit:           sink,
+		})
+		assert.NoError(t, err)
+		assert.False(t, result.RolledBack)
+
+		current, err := backend.GetSecretValue(ctx, testSecretArn, "", labels.Current)
+		assert.NoError(t, err)
+		assert.Equal(t, testToken, aws.ToString(current.VersionId))
+
+		records, err := sink.Query(ctx, testSecretArn)
+		assert.NoError(t, err)
+		assert.Empty(t, records, "only attempted rollbacks are audited")
+	})
+
+	t.Run("TestFails", func(t *testing.T) {
+		backend, _ := newRolloutBackend(t, "good")
+
+		result, err := newRotator(backend).Rollback(ctx, testSecretArn, RollbackOptions{OnlyIfTestFails: true})
+		assert.NoError(t, err)
+		assert.True(t, result.RolledBack)
+		assert.False(t, result.TargetRestored)
+		assert.NotEmpty(t, result.TestError)
+
+		current, err := backend.GetSecretValue(ctx, testSecretArn, "", labels.Current)
+		assert.NoError(t, err)
+		assert.Equal(t, "good", aws.ToString(current.SecretString))
+	})
+
+	t.Run("NoPreviousVersion", func(t *testing.T) {
+		backend := newPlanBackend(t, false)
+		sink := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.jsonl"))
+
+		_, err := newRotator(backend).Rollback(ctx, testSecretArn, RollbackOptions{Audit: sink})
+		var secretError *erroer.SecretError
+		assert.ErrorAs(t, err, &secretError)
+
+		records, err := sink.Query(ctx, testSecretArn)
+		assert.NoError(t, err)
+		if assert.Len(t, records, 1) {
+			assert.Equal(t, "failed", records[0].Outcome)
+			assert.Equal(t, erroer.ClassSecret, records[0].ErrorClass)
+		}
+	})
+
+	t.Run("SecretNotAllowed", func(t *testing.T) {
+		backend, _ := newRolloutBackend(t, "bad")
+		rotator := newRotator(backend)
+		rotator.AllowedPrefixes = []string{"prod/"}
+
+		_, err := rotator.Rollback(ctx, testSecretArn, RollbackOptions{})
+		var validationError *erroer.RotatorValidationError
+		assert.ErrorAs(t, err, &validationError)
+	})
+}
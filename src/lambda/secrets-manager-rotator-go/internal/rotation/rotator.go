@@ -1,32 +1,59 @@
 package rotation
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/excoriate/aws-secrets-rotation-lambda/internal/adapter"
 	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
 	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/tracing"
 	"go.uber.org/zap"
+	"strings"
+	"time"
 )
 
 type Rotator interface {
 	IsRotationAttemptValid(event Event) error
-	IsSecretValidToRotate(secretArn, token string) (*secretsmanager.DescribeSecretOutput, error)
-	Rotate(event Event, secret *secretsmanager.DescribeSecretOutput, step string,
+	IsSecretValidToRotate(ctx context.Context, secretArn, token string) (*secretsmanager.
+		DescribeSecretOutput, error)
+	ResolveSecretType(ctx context.Context, secret *secretsmanager.DescribeSecretOutput) (string, error)
+	Rotate(ctx context.Context, event Event, secret *secretsmanager.DescribeSecretOutput, step string,
 		secretType string) error
+	PlanRotation(ctx context.Context, event Event, secret *secretsmanager.DescribeSecretOutput, step string,
+		secretType string) (*Plan, error)
+	Rollback(ctx context.Context, secretId string, opts RollbackOptions) (*RollbackResult, error)
 }
 
 type RotatorClient struct {
 	Logger         *zap.Logger
 	Client         client.SecretsManager
 	SecretToRotate Event
+	JSONKeys       []string
+	Generator      generator.Generator
+	// GeneratorSource is the source of Generator (see config.Generator), to check that it can
+	// generate the values of the secrets.
+	GeneratorSource string
+	Policy          generator.Policy
+	Replicas        ReplicaOptions
+	// AllowedPrefixes restricts the secrets that can be rotated to the ones whose name starts
+	// with any of them. If it's empty, every secret can be rotated.
+	AllowedPrefixes []string
+	// DryRun accepts rotation tokens without a secret version, since a dry-run createSecret never
+	// stores it (see PlanRotation).
+	DryRun bool
+	// described is the secret read to resolve the role to assume (see ResolveRoleARN), reused
+	// the first time the secret is described.
+	described *secretsmanager.DescribeSecretOutput
 }
 
-func (r *RotatorClient) Rotate(event Event, secret *secretsmanager.DescribeSecretOutput, step string,
+func (r *RotatorClient) Rotate(ctx context.Context, event Event, secret *secretsmanager.DescribeSecretOutput, step string,
 	secretType string) error {
 
-	steps := GetSteps()
-
 	secretId := *secret.ARN
 	secretName := *secret.Name
 	secretToken := *event.Token
@@ -34,67 +61,173 @@ func (r *RotatorClient) Rotate(event Event, secret *secretsmanager.DescribeSecre
 	r.Logger.Info(fmt.Sprintf("Initializing rotation for secret: %s, "+
 		"with id: %s on step: %s with token: "+secretName, secretId, step, secretToken))
 
-	s := NewStepExecutionerClient(r.Logger, r.Client, event, secret)
+	s, err := r.newStepsClient(event, secret, secretType)
+	if err != nil {
+		return err
+	}
+
+	return s.Run(ctx, step)
+}
 
-	switch step {
-	case steps.Create:
-		return s.CreateSecretStep()
-	case steps.Set:
-		return s.SetSecretStep()
-	case steps.Test:
-		return s.TestSecretStep()
-	case steps.Finish:
-		return s.FinishSecretStep()
+// PlanRotation dry-runs the rotation up to the given step: it runs every read and check, but
+// none of the writes, and returns what they would have been. The steps before the given one are
+// run too, since their writes (e.g.: the AWSPENDING version) were skipped. The plan is returned
+// even if a step fails, with the check that failed.
+func (r *RotatorClient) PlanRotation(ctx context.Context, event Event, secret *secretsmanager.DescribeSecretOutput,
+	step string, secretType string) (*Plan, error) {
+	secretId := *secret.ARN
+
+	r.Logger.Info(fmt.Sprintf("Planning rotation for secret: %s on step: %s with token: %s", secretId, step,
+		*event.Token))
+
+	s, err := r.newStepsClient(event, secret, secretType)
+	if err != nil {
+		return nil, err
 	}
 
-	return nil
+	s.DryRun = true
+	s.Plan = &Plan{
+		SecretARN: secretId,
+		Step:      step,
+		Token:     *event.Token,
+		Strategy:  secretType,
+	}
+
+	for _, planned := range AllowedSteps {
+		if err := s.Run(ctx, planned); err != nil {
+			return s.Plan, err
+		}
+
+		if planned == step {
+			break
+		}
+	}
+
+	return s.Plan, nil
 }
 
-func (r *RotatorClient) IsRotationAttemptValid(event Event) error {
-	if event == (Event{}) {
-		r.Logger.Error("Event is empty")
-		return erroer.NewValidationError("event is empty", nil)
+// newStepsClient builds the steps of the rotation of the secret, with the settings of its tags.
+func (r *RotatorClient) newStepsClient(event Event, secret *secretsmanager.DescribeSecretOutput,
+	secretType string) (*StepsClient, error) {
+	strategy, policy, err := r.newStrategy(secret, secretType)
+	if err != nil {
+		return nil, err
 	}
 
-	secretArn := *event.Arn
+	s := NewStepExecutionerClient(r.Logger, r.Client, event, secret, strategy, policy)
+	s.Replicas = r.Replicas
+	s.StrategyName = secretType
+
+	return s, nil
+}
+
+// newStrategy builds the strategy of the secret type, with the settings of the secret tags, and
+// returns it with the generation policy of the secret.
+func (r *RotatorClient) newStrategy(secret *secretsmanager.DescribeSecretOutput, secretType string) (
+	RotationStrategy, generator.Policy, error) {
+	secretId := *secret.ARN
 
-	if secretArn == "" {
-		r.Logger.Error("SecretArn is empty")
-		return erroer.NewValidationError("secretArn is empty", nil)
+	secretConfig, err := ParseSecretConfig(secret)
+	if err != nil {
+		r.Logger.Error(fmt.Sprintf("Invalid rotation settings in the tags of secret %s", secretId),
+			zap.Error(err))
+		return nil, generator.Policy{}, erroer.NewConfigurationError(fmt.Sprintf(
+			"invalid rotation settings in the tags of secret %s", secretId), err)
 	}
 
-	token := *event.Token
+	policy := secretConfig.Policy(r.Policy)
+	strategy, err := NewStrategy(secretType, StrategyOptions{
+		Logger:         r.Logger,
+		Client:         r.Client,
+		JSONKeys:       secretConfig.Keys(r.JSONKeys),
+		SecretJSONKeys: secretConfig.JSONKeys,
+		SecretARN:      secretId,
+		Generator:      r.Generator,
+		Policy:         policy,
+	})
 
-	if token == "" {
-		r.Logger.Error("ClientRequestToken is empty")
-		return erroer.NewValidationError("clientRequestToken is empty", nil)
+	if err != nil {
+		r.Logger.Error(fmt.Sprintf("Unable to build the rotation strategy for secret type %s",
+			secretType), zap.Error(err))
+		return nil, generator.Policy{}, err
 	}
 
-	step := *event.Step
-	if step == "" {
-		r.Logger.Error("Step is empty")
-		return erroer.NewValidationError("step is empty", nil)
+	return strategy, policy, nil
+}
+
+// ResolveSecretType returns the secret type (the name of its rotation strategy) of the given
+// secret. It's read from the StrategyTagKey tag (see SecretConfig), or from the StrategyPayloadKey field if the
+// AWSCURRENT value is JSON. If neither is set, the secret is considered static.
+func (r *RotatorClient) ResolveSecretType(ctx context.Context, secret *secretsmanager.DescribeSecretOutput) (string,
+	error) {
+	secretId := *secret.ARN
+	secretConfig, err := ParseSecretConfig(secret)
+	if err != nil {
+		r.Logger.Error(fmt.Sprintf("Invalid rotation settings in the tags of secret %s", secretId),
+			zap.Error(err))
+		return "", erroer.NewConfigurationError(fmt.Sprintf(
+			"invalid rotation settings in the tags of secret %s", secretId), err)
 	}
 
-	// If the step isn't found, fail
-	isFound := false
-	for _, allowedStep := range AllowedSteps {
-		if step == allowedStep {
-			isFound = true
+	secretType := secretConfig.Strategy
+
+	if secretType == "" {
+		current, err := r.Client.GetSecretValueByStageLabel(ctx, secretId, "",
+			GetStagingLabels().Current)
+		if err != nil {
+			r.Logger.Error(fmt.Sprintf("Error getting the AWSCURRENT version of secret %s", secretId),
+				zap.Error(err))
+			return "", erroer.NewSecretError(fmt.Sprintf(
+				"error getting the AWSCURRENT version of secret %s", secretId), err)
 		}
+
+		var payload map[string]interface{}
+		if err := json.Unmarshal([]byte(aws.ToString(current.SecretString)), &payload); err == nil {
+			if value, ok := payload[StrategyPayloadKey].(string); ok {
+				secretType = strings.TrimSpace(value)
+			}
+		}
+	}
+
+	if secretType == "" {
+		secretType = GetSecretTypes().Static
+	}
+
+	if !IsStrategyRegistered(secretType) {
+		r.Logger.Error(fmt.Sprintf("Secret type %s of secret %s is not supported", secretType,
+			secretId))
+		return "", erroer.NewConfigurationError(fmt.Sprintf(
+			"secret type %s of secret %s is not supported, supported types are: %s", secretType,
+			secretId, strings.Join(RegisteredStrategies(), ", ")), nil)
 	}
 
-	if !isFound {
-		r.Logger.Error(fmt.Sprintf("Step is not valid: %s", step))
-		return erroer.NewValidationError(fmt.Sprintf("step is not valid: %s", step), nil)
+	r.Logger.Info(fmt.Sprintf("Secret %s will be rotated as secret type %s", secretId, secretType))
+	return secretType, nil
+}
+
+func (r *RotatorClient) IsRotationAttemptValid(event Event) error {
+	if err := ValidateEvent(event); err != nil {
+		r.Logger.Error("Rotation event is not valid", zap.Error(err))
+		return err
 	}
 
 	return nil
 }
 
-func (r *RotatorClient) IsSecretValidToRotate(secretId, token string) (*secretsmanager.
-DescribeSecretOutput, error) {
-	secret, err := r.Client.GetSecret(secretId)
+func (r *RotatorClient) IsSecretValidToRotate(ctx context.Context, secretId, token string) (*secretsmanager.
+	DescribeSecretOutput, error) {
+	ctx, span := tracing.Start(ctx, "IsSecretValidToRotate", tracing.AttributeSecretArn.String(secretId),
+		tracing.AttributeToken.String(token))
+
+	secret, err := r.isSecretValidToRotate(ctx, secretId, token)
+	tracing.End(span, err)
+
+	return secret, err
+}
+
+func (r *RotatorClient) isSecretValidToRotate(ctx context.Context, secretId, token string) (*secretsmanager.
+	DescribeSecretOutput, error) {
+	secret, err := r.describeSecret(ctx, secretId)
 
 	if err != nil {
 		r.Logger.Error(fmt.Sprintf("Error getting secret with arn: %s", secretId), zap.Error(err))
@@ -102,6 +235,13 @@ DescribeSecretOutput, error) {
 			secretId), err)
 	}
 
+	if !config.IsNameAllowed(aws.ToString(secret.Name), r.AllowedPrefixes) {
+		r.Logger.Error(fmt.Sprintf("Secret %s is not allowed to be rotated by this lambda", secretId))
+		return nil, erroer.NewValidationError(fmt.Sprintf(
+			"secret %s is not allowed to be rotated by this lambda, its name must start with: %s", secretId,
+			strings.Join(r.AllowedPrefixes, ", ")), nil)
+	}
+
 	if secret.RotationEnabled != nil {
 		rotationIsEnabled := *secret.RotationEnabled
 		if rotationIsEnabled {
@@ -117,8 +257,32 @@ DescribeSecretOutput, error) {
 			secretId), nil)
 	}
 
-	// Check labels
-	if _, ok := secret.VersionIdsToStages[token]; !ok {
+	if err := checkReplicationStatus(secret); err != nil {
+		r.Logger.Error(fmt.Sprintf("Secret %s can not be rotated while a replica is failing", secretId),
+			zap.Error(err))
+		return nil, erroer.NewValidationError(fmt.Sprintf(
+			"secret %s can not be rotated while a replica is failing", secretId), err)
+	}
+
+	secretConfig, err := ParseSecretConfig(secret)
+	if err == nil {
+		err = secretConfig.Validate(r.Policy, r.GeneratorSource)
+	}
+
+	if err != nil {
+		r.Logger.Error(fmt.Sprintf("Invalid rotation settings in the tags of secret %s", secretId),
+			zap.Error(err))
+		return nil, erroer.NewValidationError(fmt.Sprintf(
+			"invalid rotation settings in the tags of secret %s", secretId), err)
+	}
+
+	// Check labels. A dry-run may be planning a rotation that was never started, so its token
+	// has no version yet.
+	_, hasVersion := secret.VersionIdsToStages[token]
+	if !hasVersion && r.DryRun {
+		r.Logger.Info(fmt.Sprintf("Dry-run: secret version %s does not exist yet in secret %s", token,
+			secretId))
+	} else if !hasVersion {
 		r.Logger.Error(fmt.Sprintf("Secret version %s has no stage for rotation of secret %s.",
 			token, secretId))
 		return nil, erroer.NewSecretError(fmt.Sprintf("secret version %s has no stage for rotation of secret"+
@@ -126,25 +290,23 @@ DescribeSecretOutput, error) {
 			token, secretId), nil)
 	}
 
+	// A step re-invoked once the rotation finished (e.g.: a retried finishSecret) has nothing
+	// left to do, so it's valid, and the caller skips it (see IsVersionCurrent).
 	stagingLabels := GetStagingLabels()
-	for _, value := range secret.VersionIdsToStages[token] {
-		// If the secret is already the 'AWS_CURRENT' version, fail
-		if value == stagingLabels.Current {
-			r.Logger.Error(fmt.Sprintf("Secret version %s already set as %s for secret %s.", token,
-				stagingLabels.Current, secretId))
-			return nil, erroer.NewSecretError(fmt.Sprintf(
-				"secret version %s already set as %s for secret"+" %s.", token,
-				stagingLabels.Current, secretId), nil)
-		}
+	stages := secret.VersionIdsToStages[token]
+	if HasStage(stages, stagingLabels.Current) {
+		r.Logger.Info(fmt.Sprintf("Secret version %s already set as %s for secret %s, there is nothing"+
+			" left to rotate", token, stagingLabels.Current, secretId))
+		return secret, nil
+	}
 
-		// If the secret isn't set with the 'AWSPENDING' label, fail.
-		if value != stagingLabels.Pending {
-			r.Logger.Error(fmt.Sprintf("Secret version %s not set as %s for secret %s.", token,
-				stagingLabels.Pending, secretId))
-			return nil, erroer.NewSecretError(fmt.Sprintf(
-				"secret version %s not set as %s for secret"+" %s.", token,
-				stagingLabels.Pending, secretId), nil)
-		}
+	// If the secret isn't set with the 'AWSPENDING' label, fail.
+	if hasVersion && !HasStage(stages, stagingLabels.Pending) {
+		r.Logger.Error(fmt.Sprintf("Secret version %s not set as %s for secret %s.", token,
+			stagingLabels.Pending, secretId))
+		return nil, erroer.NewSecretError(fmt.Sprintf(
+			"secret version %s not set as %s for secret"+" %s.", token,
+			stagingLabels.Pending, secretId), nil)
 	}
 
 	// Checking if the secret version with the AWSCURRENT stage label exists is a validation step
@@ -158,7 +320,7 @@ DescribeSecretOutput, error) {
 	// knowing that there's a working version of the secret that the application or service is
 	// already using. This check also helps to maintain the integrity of the secret rotation
 	//process and avoid unexpected issues related to missing or improperly configured secrets.
-	currentSecretVersion, currentVersionErr := r.Client.GetSecretValueByStageLabel(secretId, "",
+	currentSecretVersion, currentVersionErr := r.Client.GetSecretValueByStageLabel(ctx, secretId, "",
 		stagingLabels.Current)
 	if currentVersionErr != nil {
 		r.Logger.Error(fmt.Sprintf("This secret %s can not be rotated because there is no version"+
@@ -169,13 +331,41 @@ DescribeSecretOutput, error) {
 				" AWSCURRENT stage label", secretId), currentVersionErr)
 	}
 
-	r.Logger.Info(fmt.Sprintf("Successfully found a version with AWSCURRENT stage label in secret %s, with token (versionId) %s", secretId, currentSecretVersion.VersionId))
+	r.Logger.Info(fmt.Sprintf("Successfully found a version with AWSCURRENT stage label in secret %s, with token (versionId) %s", secretId, aws.ToString(currentSecretVersion.VersionId)))
 	return secret, nil
 }
 
-func NewRotator(event Event, logger *zap.Logger) (*RotatorClient, error) {
+// describeSecret describes the secret, reusing the description read to resolve its role the
+// first time, since it's already up to date.
+func (r *RotatorClient) describeSecret(ctx context.Context, secretId string) (*secretsmanager.
+	DescribeSecretOutput, error) {
+	if described := r.described; described != nil && (aws.ToString(described.ARN) == secretId ||
+		aws.ToString(described.Name) == secretId) {
+		r.described = nil
+		return described, nil
+	}
+
+	return r.Client.GetSecret(ctx, secretId)
+}
+
+// IsVersionCurrent reports whether the given version of the secret holds AWSCURRENT, i.e.: its
+// rotation already finished.
+func IsVersionCurrent(secret *secretsmanager.DescribeSecretOutput, versionId string) bool {
+	return HasStage(secret.VersionIdsToStages[versionId], GetStagingLabels().Current)
+}
+
+// NewRotator builds a rotator, with the AWS configuration overrides set in the environment.
+func NewRotator(ctx context.Context, cfg config.Config, event Event, logger *zap.Logger) (*RotatorClient,
+	error) {
+	return NewRotatorWithOptions(ctx, cfg, event, logger, GetAWSOptions()...)
+}
+
+// NewRotatorWithOptions builds a rotator with explicit AWS configuration overrides (e.g.: to
+// point it to a local emulator in integration tests).
+func NewRotatorWithOptions(ctx context.Context, cfg config.Config, event Event, logger *zap.Logger,
+	opts ...adapter.Option) (*RotatorClient, error) {
 	// Get adapter client
-	awsCfg, err := adapter.NewAWS("")
+	awsCfg, err := adapter.NewAWS(ctx, "", opts...)
 
 	if err != nil {
 		logger.Error("Failed to initialise Rotator Client. Can't instantiate AWS client", zap.Error(err))
@@ -183,14 +373,75 @@ func NewRotator(event Event, logger *zap.Logger) (*RotatorClient, error) {
 	}
 
 	// Get Secrets Manager client
-	smClient := client.NewSecretsManager(awsCfg, logger)
+	apiTimeout := time.Duration(cfg.Timeouts.API)
+	smClient := client.NewSecretsManager(awsCfg, logger, apiTimeout, cfg.DescribeConcurrency)
+
+	// Secrets of other accounts are rotated assuming a role there.
+	roleARN, described, err := ResolveRoleARN(ctx, logger, smClient, aws.ToString(event.Arn), cfg.Roles.Accounts)
+	if err != nil {
+		return nil, err
+	}
+
+	if roleARN != "" {
+		opts = append(opts, adapter.WithAssumeRole(roleARN, cfg.Roles.ExternalID))
+		awsCfg, err = adapter.NewAWS(ctx, "", opts...)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to initialise Rotator Client. Can't assume role %s", roleARN),
+				zap.Error(err))
+			return nil, erroer.NewConfigurationError(fmt.Sprintf("can't assume role %s", roleARN), err)
+		}
+
+		smClient = client.NewSecretsManager(awsCfg, logger, apiTimeout, cfg.DescribeConcurrency)
+	}
+
+	rotator, err := NewRotatorWithClient(cfg, event, logger, smClient)
+	if err != nil {
+		return nil, err
+	}
+
+	rotator.described = described
+
+	// The replicas are read with the same configuration, in their own region.
+	rotator.Replicas.Clients = func(ctx context.Context, region string) (client.SecretsManager, error) {
+		replicaCfg, err := adapter.NewAWS(ctx, region, opts...)
+		if err != nil {
+			return nil, err
+		}
+
+		return client.NewSecretsManager(replicaCfg, logger, apiTimeout, cfg.DescribeConcurrency), nil
+	}
+
+	return rotator, nil
+}
+
+// NewRotatorWithClient builds a rotator on top of the given Secrets Manager client (e.g.: the
+// in-memory one, to run rotations offline).
+func NewRotatorWithClient(cfg config.Config, event Event, logger *zap.Logger,
+	smClient client.SecretsManager) (*RotatorClient, error) {
+	valueGenerator, err := NewValueGenerator(cfg.Generator.Source, smClient)
+	if err != nil {
+		logger.Error("Failed to initialise Rotator Client. Can't instantiate the value generator", zap.Error(err))
+		return nil, err
+	}
+
+	policy := cfg.Generator.Policy()
+	if err := policy.Validate(); err != nil {
+		logger.Error("Failed to initialise Rotator Client. Invalid generation policy", zap.Error(err))
+		return nil, erroer.NewConfigurationError("invalid generation policy", err)
+	}
 
 	logger.Info("Rotator client initialised")
 
 	return &RotatorClient{
-		Logger:         logger,
-		Client:         smClient,
-		SecretToRotate: event,
+		Logger:          logger,
+		Client:          smClient,
+		SecretToRotate:  event,
+		JSONKeys:        cfg.JSONKeys,
+		Generator:       valueGenerator,
+		GeneratorSource: cfg.Generator.Source,
+		Policy:          policy,
+		Replicas:        ReplicaOptions{Timeout: time.Duration(cfg.Timeouts.Replica)},
+		AllowedPrefixes: cfg.AllowedPrefixes,
+		DryRun:          cfg.DryRun,
 	}, nil
-
 }
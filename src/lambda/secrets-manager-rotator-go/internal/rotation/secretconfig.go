@@ -0,0 +1,105 @@
+package rotation
+
+import (
+	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"strconv"
+	"strings"
+)
+
+// SecretConfig holds the rotation settings of a single secret, read from its tags. Unset
+// settings fall back to the lambda configuration, so one lambda can rotate every secret.
+type SecretConfig struct {
+	// Strategy is the secret type, from the StrategyTagKey tag.
+	Strategy string
+	// Length is the length of the generated values, from the LengthTagKey tag. See
+	// generator.Policy for what it means for each format.
+	Length int
+	// ExcludeCharacters are the characters left out of the generated passwords, from the
+	// ExcludeCharsTagKey tag, on top of the ones excluded by the lambda configuration. It's nil
+	// when the tag isn't set. Tag values only allow letters, digits, spaces and _ . : / = + - @.
+	ExcludeCharacters *string
+	// JSONKeys are the keys to rotate in a JSON secret value, from the JSONKeyTagKey tag (keys
+	// separated by spaces, since tag values can't hold commas).
+	JSONKeys []string
+}
+
+// ParseSecretConfig reads the rotation settings from the tags of the given secret.
+func ParseSecretConfig(secret *secretsmanager.DescribeSecretOutput) (SecretConfig, error) {
+	var config SecretConfig
+	for _, tag := range secret.Tags {
+		value := aws.ToString(tag.Value)
+
+		switch aws.ToString(tag.Key) {
+		case StrategyTagKey:
+			config.Strategy = strings.TrimSpace(value)
+			if config.Strategy != "" && !IsStrategyRegistered(config.Strategy) {
+				return SecretConfig{}, fmt.Errorf("tag %s: secret type %s is not supported, supported "+
+					"types are: %s", StrategyTagKey, config.Strategy, strings.Join(RegisteredStrategies(), ", "))
+			}
+		case LengthTagKey:
+			length, err := strconv.Atoi(strings.TrimSpace(value))
+			if err != nil || length <= 0 {
+				return SecretConfig{}, fmt.Errorf("tag %s: length must be a number greater than zero, "+
+					"got %q", LengthTagKey, value)
+			}
+
+			config.Length = length
+		case ExcludeCharsTagKey:
+			config.ExcludeCharacters = aws.String(value)
+		case JSONKeyTagKey:
+			config.JSONKeys = strings.Fields(value)
+			if len(config.JSONKeys) == 0 {
+				return SecretConfig{}, fmt.Errorf("tag %s: at least one key must be set", JSONKeyTagKey)
+			}
+		}
+	}
+
+	return config, nil
+}
+
+// Policy returns the given generation policy, with the settings of the secret applied.
+func (c SecretConfig) Policy(base generator.Policy) generator.Policy {
+	if base.Format == "" {
+		base = generator.DefaultPolicy()
+	}
+
+	if c.Length > 0 {
+		base.Length = c.Length
+	}
+
+	if c.ExcludeCharacters != nil {
+		for _, char := range *c.ExcludeCharacters {
+			if !strings.ContainsRune(base.ExcludeCharacters, char) {
+				base.ExcludeCharacters += string(char)
+			}
+		}
+	}
+
+	return base.WithDefaults()
+}
+
+// Keys returns the JSON keys to rotate: the ones of the secret or, if it doesn't set any, the
+// given ones.
+func (c SecretConfig) Keys(base []string) []string {
+	if len(c.JSONKeys) > 0 {
+		return c.JSONKeys
+	}
+
+	return base
+}
+
+// Validate checks that values can be generated for the secret by the given generator source, once
+// its settings are applied to the given generation policy.
+func (c SecretConfig) Validate(base generator.Policy, source string) error {
+	policy := c.Policy(base)
+	if err := policy.Validate(); err != nil {
+		return erroer.NewConfigurationError("invalid generation policy", err)
+	}
+
+	return config.ValidateGeneratorSource(source, policy)
+}
@@ -0,0 +1,194 @@
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"strings"
+	"testing"
+)
+
+func taggedSecret(tags map[string]string) *secretsmanager.DescribeSecretOutput {
+	secret := &secretsmanager.DescribeSecretOutput{ARN: aws.String(testSecretArn), Name: aws.String("test")}
+	for key, value := range tags {
+		secret.Tags = append(secret.Tags, types.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+
+	return secret
+}
+
+func TestParseSecretConfig(t *testing.T) {
+	config, err := ParseSecretConfig(taggedSecret(nil))
+	assert.NoError(t, err)
+	assert.Equal(t, SecretConfig{}, config)
+
+	config, err = ParseSecretConfig(taggedSecret(map[string]string{
+		StrategyTagKey:     "postgres",
+		LengthTagKey:       " 40 ",
+		ExcludeCharsTagKey: "/@",
+		JSONKeyTagKey:      "password api_key",
+		"team":             "payments",
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, SecretConfig{
+		Strategy:          "postgres",
+		Length:            40,
+		ExcludeCharacters: aws.String("/@"),
+		JSONKeys:          []string{"password", "api_key"},
+	}, config)
+
+	for name, tags := range map[string]map[string]string{
+		"UnknownStrategy": {StrategyTagKey: "mysql"},
+		"InvalidLength":   {LengthTagKey: "long"},
+		"ZeroLength":      {LengthTagKey: "0"},
+		"EmptyJSONKey":    {JSONKeyTagKey: " "},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := ParseSecretConfig(taggedSecret(tags))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestSecretConfigPolicy(t *testing.T) {
+	assert.Equal(t, generator.DefaultPolicy(), SecretConfig{}.Policy(generator.Policy{}))
+
+	policy := SecretConfig{Length: 12, ExcludeCharacters: aws.String("")}.Policy(generator.DefaultPolicy())
+	assert.Equal(t, 12, policy.Length)
+	assert.Equal(t, generator.DefaultExcludeCharacters, policy.ExcludeCharacters)
+
+	policy = SecretConfig{ExcludeCharacters: aws.String("/@xyz")}.Policy(generator.DefaultPolicy())
+	assert.Equal(t, generator.DefaultExcludeCharacters+"xyz", policy.ExcludeCharacters,
+		"the tag adds to the excluded characters, it doesn't replace them")
+
+	assert.Equal(t, []string{"password"}, SecretConfig{}.Keys([]string{"password"}))
+	assert.Equal(t, []string{"token"}, SecretConfig{JSONKeys: []string{"token"}}.Keys([]string{"password"}))
+
+	assert.Error(t, SecretConfig{Length: 2}.Validate(generator.DefaultPolicy(), config.GeneratorSourceLocal),
+		"a password needs room for every required class")
+
+	hex := generator.Policy{Format: generator.FormatHex}
+	assert.NoError(t, SecretConfig{Length: 16}.Validate(hex, config.GeneratorSourceLocal))
+
+	var configurationError *erroer.RotatorConfigurationError
+	assert.ErrorAs(t, SecretConfig{Length: 16}.Validate(hex, config.GeneratorSourceAWS), &configurationError,
+		"the AWS API only generates passwords")
+}
+
+func TestIsSecretValidToRotateInvalidTags(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	backend := client.NewInMemorySecretsManager(logger)
+
+	_, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:             testSecretArn,
+		Name:            "test",
+		Value:           "value",
+		RotationEnabled: true,
+		Tags:            map[string]string{LengthTagKey: "-1"},
+	})
+	assert.NoError(t, err)
+
+	_, err = backend.StartRotation(testSecretArn, testToken)
+	assert.NoError(t, err)
+
+	rotator := &RotatorClient{Logger: logger, Client: backend}
+	_, err = rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+
+	var validationError *erroer.RotatorValidationError
+	assert.ErrorAs(t, err, &validationError)
+}
+
+func TestIsSecretValidToRotateUnsupportedFormat(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	backend := client.NewInMemorySecretsManager(logger)
+
+	_, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:             testSecretArn,
+		Name:            "test",
+		Value:           "value",
+		RotationEnabled: true,
+		Tags:            map[string]string{LengthTagKey: "16"},
+	})
+	assert.NoError(t, err)
+
+	_, err = backend.StartRotation(testSecretArn, testToken)
+	assert.NoError(t, err)
+
+	rotator := &RotatorClient{
+		Logger:          logger,
+		Client:          backend,
+		GeneratorSource: config.GeneratorSourceAWS,
+		Policy:          generator.Policy{Format: generator.FormatBase64},
+	}
+	_, err = rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+
+	var configurationError *erroer.RotatorConfigurationError
+	assert.ErrorAs(t, err, &configurationError)
+}
+
+func TestRotateWithSecretConfig(t *testing.T) {
+	ctx := context.Background()
+	logger := zap.NewNop()
+	backend := client.NewInMemorySecretsManager(logger)
+
+	_, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:             testSecretArn,
+		Name:            "test",
+		Value:           `{"username":"app","password":"keep","token":"old"}`,
+		RotationEnabled: true,
+		Tags: map[string]string{
+			LengthTagKey:       "12",
+			ExcludeCharsTagKey: "abcdefABCDEF",
+			JSONKeyTagKey:      "token",
+		},
+	})
+	assert.NoError(t, err)
+
+	_, err = backend.StartRotation(testSecretArn, testToken)
+	assert.NoError(t, err)
+
+	rotator := &RotatorClient{
+		Logger:    logger,
+		Client:    backend,
+		JSONKeys:  config.DefaultJSONKeys,
+		Generator: generator.NewGenerator(),
+		Policy:    generator.DefaultPolicy(),
+	}
+
+	secret, err := rotator.IsSecretValidToRotate(ctx, testSecretArn, testToken)
+	assert.NoError(t, err)
+
+	secretConfig, err := ParseSecretConfig(secret)
+	assert.NoError(t, err)
+
+	policy := secretConfig.Policy(rotator.Policy)
+	for _, char := range generator.DefaultExcludeCharacters + "abcdefABCDEF" {
+		assert.Contains(t, policy.ExcludeCharacters, string(char), "the tagged secret still excludes the defaults")
+	}
+
+	secretType, err := rotator.ResolveSecretType(ctx, secret)
+	assert.NoError(t, err)
+
+	event := Event{Arn: aws.String(testSecretArn), Token: aws.String(testToken),
+		Step: aws.String(GetSteps().Create)}
+	assert.NoError(t, rotator.Rotate(ctx, event, secret, GetSteps().Create, secretType))
+
+	pending, err := backend.GetSecretValueByStageLabel(ctx, testSecretArn, testToken, GetStagingLabels().Pending)
+	assert.NoError(t, err)
+
+	var value map[string]string
+	assert.NoError(t, json.Unmarshal([]byte(aws.ToString(pending.SecretString)), &value))
+	assert.Equal(t, "keep", value["password"], "only the tagged key is rotated")
+	assert.Len(t, value["token"], 12)
+	assert.False(t, strings.ContainsAny(value["token"], generator.DefaultExcludeCharacters+"abcdefABCDEF"))
+}
@@ -0,0 +1,98 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"go.uber.org/zap"
+	"strings"
+)
+
+// StaticStrategy rotates secrets that aren't bound to any target system, so there's nothing
+// to set nor test. If the secret value is a JSON object, only the configured keys are
+// regenerated, otherwise the whole value is replaced by a random password.
+type StaticStrategy struct {
+	Logger    *zap.Logger
+	Generator generator.Generator
+	Policy    generator.Policy
+	JSONKeys  []string
+}
+
+func (s *StaticStrategy) CreateSecret(ctx context.Context, current string) (string, error) {
+	currentFields, isJSON := parseJSONObject(current)
+	if !isJSON {
+		return generateValue(ctx, s.Logger, s.Generator, s.Policy)
+	}
+
+	newFields := map[string]interface{}{}
+	for _, key := range s.JSONKeys {
+		if _, ok := currentFields[key]; !ok {
+			continue
+		}
+
+		newValue, err := generateValue(ctx, s.Logger, s.Generator, s.Policy)
+		if err != nil {
+			return "", err
+		}
+
+		newFields[key] = newValue
+	}
+
+	if len(newFields) == 0 {
+		s.Logger.Error(fmt.Sprintf("JSON secret value has none of the keys to rotate: %s",
+			strings.Join(s.JSONKeys, ", ")))
+		return "", erroer.NewSecretError(fmt.Sprintf(
+			"JSON secret value has none of the keys to rotate: %s", strings.Join(s.JSONKeys, ", ")), nil)
+	}
+
+	s.Logger.Info(fmt.Sprintf("Rotating %d key(s) of the JSON secret value", len(newFields)))
+	return withJSONFields(current, newFields)
+}
+
+func (s *StaticStrategy) SetSecret(ctx context.Context, current, pending string) error {
+	return nil
+}
+
+func (s *StaticStrategy) TestSecret(ctx context.Context, pending string) error {
+	return nil
+}
+
+func (s *StaticStrategy) FinishSecret(ctx context.Context, current, pending string) error {
+	return nil
+}
+
+func (s *StaticStrategy) GeneratedValues(pending string) ([]string, error) {
+	pendingFields, isJSON := parseJSONObject(pending)
+	if !isJSON {
+		return []string{pending}, nil
+	}
+
+	var values []string
+	for _, key := range s.JSONKeys {
+		field, ok := pendingFields[key]
+		if !ok {
+			continue
+		}
+
+		value, ok := field.(string)
+		if !ok {
+			return nil, erroer.NewSecretError(fmt.Sprintf("JSON secret value key %s is not a string", key), nil)
+		}
+
+		values = append(values, value)
+	}
+
+	return values, nil
+}
+
+func NewStaticStrategy(opts StrategyOptions) (RotationStrategy, error) {
+	opts = opts.withDefaults()
+
+	return &StaticStrategy{
+		Logger:    opts.Logger,
+		Generator: opts.Generator,
+		Policy:    opts.Policy,
+		JSONKeys:  opts.JSONKeys,
+	}, nil
+}
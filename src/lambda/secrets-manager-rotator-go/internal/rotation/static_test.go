@@ -0,0 +1,53 @@
+package rotation
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+)
+
+func TestStaticStrategyCreateSecret(t *testing.T) {
+	ctx := context.Background()
+
+	newStrategy := func(keys ...string) RotationStrategy {
+		s, err := NewStaticStrategy(StrategyOptions{
+			Logger:   zap.NewNop(),
+			Client:   &fakePasswordClient{password: "new"},
+			JSONKeys: keys,
+		})
+		assert.NoError(t, err)
+		return s
+	}
+
+	t.Run("RawValue", func(t *testing.T) {
+		pending, err := newStrategy().CreateSecret(ctx, "old")
+		assert.NoError(t, err)
+		assert.Equal(t, "new", pending)
+	})
+
+	t.Run("JSONValueKeepsOtherFields", func(t *testing.T) {
+		current := `{"username":"app","password":"old","api_key":"old-key","port":5432}`
+		pending, err := newStrategy("password", "api_key").CreateSecret(ctx, current)
+		assert.NoError(t, err)
+
+		var value map[string]interface{}
+		assert.NoError(t, json.Unmarshal([]byte(pending), &value))
+		assert.Equal(t, "new", value["password"])
+		assert.Equal(t, "new", value["api_key"])
+		assert.Equal(t, "app", value["username"])
+		assert.Equal(t, float64(5432), value["port"])
+	})
+
+	t.Run("JSONValueDefaultsToPasswordKey", func(t *testing.T) {
+		pending, err := newStrategy().CreateSecret(ctx, `{"username":"app","password":"old"}`)
+		assert.NoError(t, err)
+		assert.JSONEq(t, `{"username":"app","password":"new"}`, pending)
+	})
+
+	t.Run("JSONValueWithoutKeys", func(t *testing.T) {
+		_, err := newStrategy("api_key").CreateSecret(ctx, `{"username":"app","password":"old"}`)
+		assert.Error(t, err)
+	})
+}
@@ -1,20 +1,26 @@
 package rotation
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
 	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
 	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
 	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/metrics"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/tracing"
 	"go.uber.org/zap"
+	"time"
 )
 
 type StepExecutioner interface {
-	CreateSecretStep() error
-	SetSecretStep() error
-	TestSecretStep() error
-	FinishSecretStep() error
+	CreateSecretStep(ctx context.Context) error
+	SetSecretStep(ctx context.Context) error
+	TestSecretStep(ctx context.Context) error
+	FinishSecretStep(ctx context.Context) error
 }
 
 type StepsClient struct {
@@ -25,9 +31,59 @@ type StepsClient struct {
 	SecretEvent   Event
 	SecretData    *secretsmanager.DescribeSecretOutput
 	StagingLabels StagingLabels
+	// Strategy holds the behaviour that depends on the type of secret being rotated, and
+	// StrategyName is its secret type, used as a dimension of the metrics.
+	Strategy     RotationStrategy
+	StrategyName string
+	// Policy is the generation policy that the new secret values must satisfy.
+	Policy generator.Policy
+	// Replicas are used to check that the AWSPENDING version reached every replica region.
+	Replicas ReplicaOptions
+	// DryRun runs every read and check of the steps, but skips their writes (in Secrets Manager
+	// and in the target system), recording them in Plan instead.
+	DryRun bool
+	Plan   *Plan
+	// plannedPending is the AWSPENDING value created by a dry-run createSecret step. It was never
+	// stored, so the next steps read it from here.
+	plannedPending *string
 }
 
-func (s *StepsClient) CreateSecretStep() error {
+// Run executes the given rotation step in its own span, and records its duration.
+func (s *StepsClient) Run(ctx context.Context, step string) (err error) {
+	steps := GetSteps()
+	started := time.Now()
+
+	ctx, span := tracing.Start(ctx, step, tracing.AttributeStep.String(step),
+		tracing.AttributeStrategy.String(s.StrategyName))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	s.Plan.start(step)
+
+	switch step {
+	case steps.Create:
+		err = s.CreateSecretStep(ctx)
+	case steps.Set:
+		err = s.SetSecretStep(ctx)
+	case steps.Test:
+		err = s.TestSecretStep(ctx)
+	case steps.Finish:
+		err = s.FinishSecretStep(ctx)
+	default:
+		return nil
+	}
+
+	metrics.Record(ctx, metrics.StepDuration, float64(time.Since(started).Milliseconds()),
+		metrics.UnitMilliseconds, map[string]string{
+			metrics.DimensionStep:     step,
+			metrics.DimensionStrategy: s.StrategyName,
+		})
+
+	return err
+}
+
+func (s *StepsClient) CreateSecretStep(ctx context.Context) error {
 	secretId := *s.SecretData.ARN
 	token := *s.SecretEvent.Token
 	stagePending := s.StagingLabels.Pending
@@ -45,69 +101,225 @@ func (s *StepsClient) CreateSecretStep() error {
 	//
 	// This approach ensures that a new secret version is created only when needed,
 	//avoiding unnecessary secret version creations and maintaining the integrity of the rotation process.
-	_, err := s.Client.GetSecretValueByStageLabel(secretId, token, stagePending)
+	_, err := s.Client.GetSecretValueByStageLabel(ctx, secretId, token, stagePending)
+	if err == nil {
+		s.Logger.Info("Secret version already created with AWSPENDING stage label", zap.String("token", token))
+		return nil
+	}
+
+	var resourceNotFoundError *types.ResourceNotFoundException
+	if !errors.As(err, &resourceNotFoundError) {
+		s.Logger.Error("Error getting the AWSPENDING secret version", zap.Error(err))
+		return erroer.NewRotationError("Error getting the AWSPENDING secret version", err)
+	}
+
+	// If the secret isn't found, that's fine, Let's create a new secret version then.
+	current, err := s.Client.GetSecretValueByStageLabel(ctx, secretId, "", s.StagingLabels.Current)
 	if err != nil {
-		var resourceNotFoundError *types.ResourceNotFoundException
-		// If the secret isn't found, that's fine, Let's create a new secret version then.
-		excChars := "/@'\"\\"
-		if errors.As(err, &resourceNotFoundError) {
-			newSecretValue, err := s.Client.GenerateRandomPassword(excChars)
-			if err != nil {
-				s.Logger.Error("Error generating random password", zap.Error(err))
-				return erroer.NewRotationError("Error generating random password", err)
-			}
-
-			// Create a new secret version, with the new rotated value.
-			_, err = s.Client.PutSecretValue(secretId, token, newSecretValue, stagePending)
-			if err != nil {
-				s.Logger.Error("Error creating new secret version", zap.Error(err))
-				return erroer.NewRotationError("Error creating new secret version", err)
-			}
+		s.Logger.Error("Error getting the AWSCURRENT secret version", zap.Error(err))
+		return erroer.NewRotationError("Error getting the AWSCURRENT secret version", err)
+	}
+
+	newSecretValue, err := s.Strategy.CreateSecret(ctx, aws.ToString(current.SecretString))
+	if err != nil {
+		return err
+	}
+
+	if s.DryRun {
+		return s.planCreateSecret(newSecretValue)
+	}
+
+	// Create a new secret version, with the new rotated value.
+	_, err = s.Client.PutSecretValue(ctx, secretId, token, newSecretValue, stagePending)
+	if err != nil {
+		s.Logger.Error("Error creating new secret version", zap.Error(err))
+		return erroer.NewRotationError("Error creating new secret version", err)
+	}
+
+	return nil
+}
+
+// planCreateSecret records the AWSPENDING version that a dry-run createSecret step would have
+// stored. The generation policy is checked right away, since the value is never stored.
+func (s *StepsClient) planCreateSecret(newSecretValue string) error {
+	token := *s.SecretEvent.Token
+	stagePending := s.StagingLabels.Pending
+
+	err := s.checkGenerationPolicy(newSecretValue)
+	s.Plan.check(CheckGenerationPolicy, err)
+	if err != nil {
+		return err
+	}
+
+	s.plannedPending = &newSecretValue
+	s.Plan.write(OperationPutSecretValue, token, fmt.Sprintf("store the new %s value as version %s",
+		s.StrategyName, token))
 
+	fromVersion := findVersionWithStage(s.SecretData.VersionIdsToStages, stagePending)
+	if fromVersion != token {
+		s.Plan.moveLabel(stagePending, fromVersion, token)
+	}
+
+	s.Logger.Info("Dry-run: skipped storing the AWSPENDING secret version", zap.String("token", token))
+	return nil
+}
+
+func (s *StepsClient) SetSecretStep(ctx context.Context) error {
+	current, pending, err := s.getCurrentAndPendingValues(ctx)
+	if err != nil {
+		return err
+	}
+
+	if s.DryRun {
+		s.Plan.write(OperationSetSecret, *s.SecretEvent.Token, fmt.Sprintf(
+			"set the AWSPENDING value in the target system of the %s strategy", s.StrategyName))
+		s.Logger.Info("Dry-run: skipped setting the AWSPENDING secret value in the target system")
+		return nil
+	}
+
+	return s.Strategy.SetSecret(ctx, current, pending)
+}
+
+// TestSecretStep validates the AWSPENDING version before it's allowed to become AWSCURRENT.
+// Any failure stops the rotation, so a broken value never reaches the finishSecret step.
+func (s *StepsClient) TestSecretStep(ctx context.Context) error {
+	current, pending, err := s.getCurrentAndPendingValues(ctx)
+	if err != nil {
+		return err
+	}
+
+	// A dry-run never sets the AWSPENDING value in the target system, and may not have stored it
+	// either, so the checks that depend on them are skipped.
+	var skipTargetSystem, skipReplicas string
+	if s.DryRun {
+		skipTargetSystem = "the dry-run did not set the AWSPENDING value in the target system"
+	}
+
+	if s.plannedPending != nil {
+		skipReplicas = "the dry-run did not store the AWSPENDING version"
+	}
+
+	checks := []struct {
+		name string
+		run  func(ctx context.Context) error
+		skip string
+	}{
+		{name: CheckPendingValue, run: func(context.Context) error { return s.checkPendingValue(current, pending) }},
+		{name: CheckGenerationPolicy, run: func(context.Context) error { return s.checkGenerationPolicy(pending) }},
+		{name: CheckTargetSystem, run: func(ctx context.Context) error { return s.Strategy.TestSecret(ctx, pending) },
+			skip: skipTargetSystem},
+		{name: CheckReplicas, run: s.waitForReplicas, skip: skipReplicas},
+	}
+
+	for _, check := range checks {
+		if check.skip != "" {
+			s.Plan.skip(check.name, check.skip)
+			continue
+		}
+
+		err := check.run(ctx)
+		s.Plan.check(check.name, err)
+		if err != nil {
+			return err
 		}
 	}
 
+	s.Logger.Info("AWSPENDING secret value passed all the tests", zap.String("token", *s.SecretEvent.Token))
 	return nil
 }
 
-func (s *StepsClient) SetSecretStep() error {
+// checkPendingValue checks that the AWSPENDING value changed, and that it kept the shape of the
+// AWSCURRENT one.
+func (s *StepsClient) checkPendingValue(current, pending string) error {
+	if pending == current {
+		s.Logger.Error("AWSPENDING secret value is the same as the AWSCURRENT one")
+		return erroer.NewRotationError("AWSPENDING secret value is the same as the AWSCURRENT one", nil)
+	}
+
+	if _, isJSON := parseJSONObject(current); isJSON {
+		if _, isPendingJSON := parseJSONObject(pending); !isPendingJSON {
+			s.Logger.Error("AWSCURRENT secret value is a JSON object, but the AWSPENDING one isn't")
+			return erroer.NewRotationError(
+				"AWSCURRENT secret value is a JSON object, but the AWSPENDING one isn't", nil)
+		}
+	}
+
 	return nil
 }
 
-func (s *StepsClient) TestSecretStep() error {
+// checkGenerationPolicy checks that the generated parts of the AWSPENDING value satisfy the
+// generation policy.
+func (s *StepsClient) checkGenerationPolicy(pending string) error {
+	generatedValues, err := s.Strategy.GeneratedValues(pending)
+	if err != nil {
+		s.Logger.Error("Unable to read the generated values of the AWSPENDING secret value", zap.Error(err))
+		return erroer.NewRotationError("unable to read the generated values of the AWSPENDING secret value", err)
+	}
+
+	for _, value := range generatedValues {
+		if err := s.Policy.Check(value); err != nil {
+			s.Logger.Error("AWSPENDING secret value does not satisfy the generation policy", zap.Error(err))
+			return erroer.NewRotationError("AWSPENDING secret value does not satisfy the generation policy", err)
+		}
+	}
+
 	return nil
 }
 
-func (s *StepsClient) FinishSecretStep() error {
+// FinishSecretStep moves AWSCURRENT to the AWSPENDING version (token). It finds the version
+// that actually holds AWSCURRENT (Go maps aren't ordered, so it can't be the first version
+// found), and it's a no-op if the token is already AWSCURRENT, so it can be safely retried.
+func (s *StepsClient) FinishSecretStep(ctx context.Context) error {
 	arn := *s.SecretData.ARN
 	token := *s.SecretEvent.Token
 	s.Logger.Info("Finishing secret rotation", zap.String("ARN", arn))
 
-	secret, err := s.Client.GetSecret(arn)
+	secret, err := s.Client.GetSecret(ctx, arn)
 	if err != nil {
 		s.Logger.Error(fmt.Sprintf("Error describing secret with arn %s", arn), zap.Error(err))
 		return erroer.NewRotationError(fmt.Sprintf("Error describing secret with arn %s", arn), err)
 	}
 
-	var currentVersion string
-	// Check versions
-	for version, _ := range secret.VersionIdsToStages {
-		if secret.VersionIdsToStages[version] != nil {
-			if version == token {
-				// The correct version is already marked as current, no need to do anything.
-				s.Logger.Info("The correct version %s is already marked as current, no need to do anything.", zap.String("version", version))
-				return nil
-			}
+	if _, ok := secret.VersionIdsToStages[token]; !ok && s.plannedPending == nil {
+		s.Logger.Error(fmt.Sprintf("Secret version %s does not exist in secret %s", token, arn))
+		return erroer.NewRotationError(fmt.Sprintf("secret version %s does not exist in secret %s",
+			token, arn), nil)
+	}
 
-			s.Logger.Info("Setting version %s as current", zap.String("version", version))
-			currentVersion = version
-			break
-		}
+	currentVersion := findVersionWithStage(secret.VersionIdsToStages, s.StagingLabels.Current)
+	if currentVersion == token {
+		// The correct version is already marked as current, no need to do anything.
+		s.Logger.Info("The correct version is already marked as current, no need to do anything.",
+			zap.String("version", token))
+		return nil
+	}
+
+	if currentVersion == "" {
+		s.Logger.Error(fmt.Sprintf("There is no version with the %s stage label in secret %s",
+			s.StagingLabels.Current, arn))
+		return erroer.NewRotationError(fmt.Sprintf("there is no version with the %s stage label in"+
+			" secret %s", s.StagingLabels.Current, arn), nil)
+	}
+
+	current, pending, err := s.getCurrentAndPendingValues(ctx)
+	if err != nil {
+		return err
+	}
+
+	if s.DryRun {
+		s.planFinishSecret(secret.VersionIdsToStages, currentVersion)
+		return nil
+	}
+
+	if err := s.Strategy.FinishSecret(ctx, current, pending); err != nil {
+		return err
 	}
 
 	// Finalize by staging the secret version current
 	currentStage := s.StagingLabels.Current
-	updatedSecret, finErr := s.Client.UpdateSecretVersion(arn, token, currentStage, currentVersion)
+	s.Logger.Info("Setting version as current", zap.String("version", token),
+		zap.String("previousVersion", currentVersion))
+	_, finErr := s.Client.UpdateSecretVersion(ctx, arn, token, currentStage, currentVersion)
 
 	if finErr != nil {
 		s.Logger.Error(fmt.Sprintf("Error finalizing secret rotation with arn %s, "+
@@ -119,17 +331,126 @@ func (s *StepsClient) FinishSecretStep() error {
 			currentStage, currentVersion), finErr)
 	}
 
-	s.Logger.Info("Secret rotation finished successfully for secret with ARN %s, and token %s", zap.String("ARN", *updatedSecret.ARN), zap.String("token", token))
+	if err := s.ensurePreviousVersion(ctx, arn, token, currentVersion); err != nil {
+		return err
+	}
+
+	s.Logger.Info("Secret rotation finished successfully", zap.String("ARN", arn),
+		zap.String("token", token))
+	return nil
+}
+
+// planFinishSecret records the staging labels that a dry-run finishSecret step would have moved:
+// AWSCURRENT to the token, and AWSPREVIOUS to the version that was AWSCURRENT.
+func (s *StepsClient) planFinishSecret(versions map[string][]string, currentVersion string) {
+	token := *s.SecretEvent.Token
+
+	s.Plan.write(OperationFinishSecret, token, fmt.Sprintf("finish the rotation in the target system of the %s"+
+		" strategy", s.StrategyName))
+	s.Plan.write(OperationUpdateSecretVersionStage, token, fmt.Sprintf("move %s from version %s to version %s",
+		s.StagingLabels.Current, currentVersion, token))
+	s.Plan.moveLabel(s.StagingLabels.Current, currentVersion, token)
+	s.Plan.moveLabel(s.StagingLabels.Previous, findVersionWithStage(versions, s.StagingLabels.Previous),
+		currentVersion)
+
+	s.Logger.Info("Dry-run: skipped setting the AWSPENDING version as current", zap.String("version", token),
+		zap.String("previousVersion", currentVersion))
+}
+
+// ensurePreviousVersion checks that the token holds AWSCURRENT, and that AWSPREVIOUS ended up
+// in the version that was AWSCURRENT before. Secrets Manager moves AWSPREVIOUS on its own when
+// AWSCURRENT is moved, but if it didn't, it's moved here.
+func (s *StepsClient) ensurePreviousVersion(ctx context.Context, arn, token, oldVersion string) error {
+	secret, err := s.Client.GetSecret(ctx, arn)
+	if err != nil {
+		s.Logger.Error(fmt.Sprintf("Error describing secret with arn %s", arn), zap.Error(err))
+		return erroer.NewRotationError(fmt.Sprintf("Error describing secret with arn %s", arn), err)
+	}
+
+	if !HasStage(secret.VersionIdsToStages[token], s.StagingLabels.Current) {
+		s.Logger.Error(fmt.Sprintf("Secret version %s was not set as %s in secret %s", token,
+			s.StagingLabels.Current, arn))
+		return erroer.NewRotationError(fmt.Sprintf("secret version %s was not set as %s in secret %s",
+			token, s.StagingLabels.Current, arn), nil)
+	}
+
+	if HasStage(secret.VersionIdsToStages[oldVersion], s.StagingLabels.Previous) {
+		return nil
+	}
+
+	previousVersion := findVersionWithStage(secret.VersionIdsToStages, s.StagingLabels.Previous)
+	s.Logger.Info("Moving the previous stage label to the old current version",
+		zap.String("version", oldVersion), zap.String("previousVersion", previousVersion))
+
+	if _, err := s.Client.UpdateSecretVersion(ctx, arn, oldVersion, s.StagingLabels.Previous,
+		previousVersion); err != nil {
+		s.Logger.Error(fmt.Sprintf("Error setting version %s as %s in secret %s", oldVersion,
+			s.StagingLabels.Previous, arn), zap.Error(err))
+		return erroer.NewRotationError(fmt.Sprintf("error setting version %s as %s in secret %s",
+			oldVersion, s.StagingLabels.Previous, arn), err)
+	}
+
 	return nil
 }
 
+// getCurrentAndPendingValues returns the secret values of the AWSCURRENT version,
+// and the AWSPENDING version created for this rotation (token), or planned by a dry-run.
+func (s *StepsClient) getCurrentAndPendingValues(ctx context.Context) (string, string, error) {
+	secretId := *s.SecretData.ARN
+	token := *s.SecretEvent.Token
+
+	current, err := s.Client.GetSecretValueByStageLabel(ctx, secretId, "", s.StagingLabels.Current)
+	if err != nil {
+		s.Logger.Error("Error getting the AWSCURRENT secret version", zap.Error(err))
+		return "", "", erroer.NewRotationError("Error getting the AWSCURRENT secret version", err)
+	}
+
+	if s.plannedPending != nil {
+		return aws.ToString(current.SecretString), *s.plannedPending, nil
+	}
+
+	pending, err := s.Client.GetSecretValueByStageLabel(ctx, secretId, token, s.StagingLabels.Pending)
+	if err != nil {
+		s.Logger.Error("Error getting the AWSPENDING secret version", zap.Error(err))
+		return "", "", erroer.NewRotationError("Error getting the AWSPENDING secret version", err)
+	}
+
+	return aws.ToString(current.SecretString), aws.ToString(pending.SecretString), nil
+}
+
+// findVersionWithStage returns the version that holds the given stage label, or an empty
+// string if there's none.
+func findVersionWithStage(versions map[string][]string, stage string) string {
+	for version, stages := range versions {
+		if HasStage(stages, stage) {
+			return version
+		}
+	}
+
+	return ""
+}
+
+// HasStage reports whether the stage label is one of the given stages of a secret version.
+func HasStage(stages []string, stage string) bool {
+	for _, s := range stages {
+		if s == stage {
+			return true
+		}
+	}
+
+	return false
+}
+
 func NewStepExecutionerClient(logger *zap.Logger, client client.SecretsManager,
-	secretEvent Event, secretData *secretsmanager.DescribeSecretOutput) *StepsClient {
+	secretEvent Event, secretData *secretsmanager.DescribeSecretOutput,
+	strategy RotationStrategy, policy generator.Policy) *StepsClient {
 	return &StepsClient{
 		Logger:        logger,
 		Client:        client,
 		SecretEvent:   secretEvent,
 		SecretData:    secretData,
 		StagingLabels: GetStagingLabels(),
+		Strategy:      strategy,
+		Policy:        policy,
 	}
 }
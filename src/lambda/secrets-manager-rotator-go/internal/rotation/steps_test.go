@@ -0,0 +1,242 @@
+package rotation
+
+import (
+	"context"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager/types"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"testing"
+)
+
+const (
+	testSecretArn = "arn:aws:secretsmanager:us-east-1:123456789012:secret:test-AbCdEf"
+	testToken     = "2d493794-4bf3-4aba-bae4-d372c431f75a"
+)
+
+// stagedValuesClient returns a fixed value for the AWSCURRENT and AWSPENDING versions.
+type stagedValuesClient struct {
+	client.SecretsManager
+	values map[string]string
+}
+
+func (f *stagedValuesClient) GetSecretValueByStageLabel(ctx context.Context, arn, token,
+	stageLabel string) (*secretsmanager.GetSecretValueOutput, error) {
+	value, ok := f.values[stageLabel]
+	if !ok {
+		return nil, &types.ResourceNotFoundException{}
+	}
+
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:          aws.String(arn),
+		SecretString: aws.String(value),
+	}, nil
+}
+
+// labelsClient models the versions of a secret, and how Secrets Manager moves their stage
+// labels.
+type labelsClient struct {
+	client.SecretsManager
+	versions map[string][]string
+	values   map[string]string
+	// manualPrevious disables the automatic move of AWSPREVIOUS when AWSCURRENT is moved.
+	manualPrevious bool
+	updateCalls    int
+}
+
+func (f *labelsClient) GetSecret(ctx context.Context, arn string) (*secretsmanager.DescribeSecretOutput, error) {
+	versions := map[string][]string{}
+	for version, stages := range f.versions {
+		versions[version] = append([]string(nil), stages...)
+	}
+
+	return &secretsmanager.DescribeSecretOutput{
+		ARN:                aws.String(arn),
+		VersionIdsToStages: versions,
+	}, nil
+}
+
+func (f *labelsClient) GetSecretValueByStageLabel(ctx context.Context, arn, token,
+	stageLabel string) (*secretsmanager.GetSecretValueOutput, error) {
+	version := token
+	if version == "" {
+		version = findVersionWithStage(f.versions, stageLabel)
+	}
+
+	if !HasStage(f.versions[version], stageLabel) {
+		return nil, &types.ResourceNotFoundException{}
+	}
+
+	return &secretsmanager.GetSecretValueOutput{
+		ARN:          aws.String(arn),
+		VersionId:    aws.String(version),
+		SecretString: aws.String(f.values[version]),
+	}, nil
+}
+
+func (f *labelsClient) UpdateSecretVersion(ctx context.Context, arn, token, stage,
+	currentVersion string) (*secretsmanager.UpdateSecretVersionStageOutput, error) {
+	f.updateCalls++
+
+	holder := findVersionWithStage(f.versions, stage)
+	if holder != "" && holder != token && holder != currentVersion {
+		return nil, &types.InvalidParameterException{Message: aws.String("stage is attached to another version")}
+	}
+
+	if holder != "" {
+		f.versions[holder] = withoutStage(f.versions[holder], stage)
+	}
+
+	f.versions[token] = append(withoutStage(f.versions[token], stage), stage)
+
+	if stage == "AWSCURRENT" && holder != "" && holder != token && !f.manualPrevious {
+		if previous := findVersionWithStage(f.versions, "AWSPREVIOUS"); previous != "" {
+			f.versions[previous] = withoutStage(f.versions[previous], "AWSPREVIOUS")
+		}
+
+		f.versions[holder] = append(f.versions[holder], "AWSPREVIOUS")
+	}
+
+	return &secretsmanager.UpdateSecretVersionStageOutput{ARN: aws.String(arn)}, nil
+}
+
+func withoutStage(stages []string, stage string) []string {
+	var result []string
+	for _, s := range stages {
+		if s != stage {
+			result = append(result, s)
+		}
+	}
+
+	return result
+}
+
+type failingTestStrategy struct {
+	RotationStrategy
+}
+
+func (f *failingTestStrategy) TestSecret(ctx context.Context, pending string) error {
+	return erroer.NewRotationError("unable to log in", nil)
+}
+
+func TestTestSecretStep(t *testing.T) {
+	ctx := context.Background()
+
+	valid, err := generator.NewGenerator().Generate(ctx, generator.DefaultPolicy())
+	assert.NoError(t, err)
+
+	newSteps := func(current, pending string, strategy RotationStrategy) *StepsClient {
+		if strategy == nil {
+			strategy, _ = NewStaticStrategy(StrategyOptions{Logger: zap.NewNop()})
+		}
+
+		return NewStepExecutionerClient(zap.NewNop(), &stagedValuesClient{
+			values: map[string]string{"AWSCURRENT": current, "AWSPENDING": pending},
+		}, Event{Token: aws.String(testToken), Arn: aws.String(testSecretArn)},
+			&secretsmanager.DescribeSecretOutput{ARN: aws.String(testSecretArn)},
+			strategy, generator.DefaultPolicy())
+	}
+
+	var rotationError *erroer.RotationError
+
+	t.Run("ValidValue", func(t *testing.T) {
+		assert.NoError(t, newSteps("old", valid, nil).TestSecretStep(ctx))
+		assert.NoError(t, newSteps(`{"user":"app","password":"old"}`,
+			`{"user":"app","password":"`+valid+`"}`, nil).TestSecretStep(ctx))
+	})
+
+	t.Run("SameAsCurrent", func(t *testing.T) {
+		err := newSteps(valid, valid, nil).TestSecretStep(ctx)
+		assert.ErrorAs(t, err, &rotationError)
+	})
+
+	t.Run("PolicyNotSatisfied", func(t *testing.T) {
+		err := newSteps("old", "new", nil).TestSecretStep(ctx)
+		assert.ErrorAs(t, err, &rotationError)
+	})
+
+	t.Run("JSONNotKept", func(t *testing.T) {
+		err := newSteps(`{"password":"old"}`, valid, nil).TestSecretStep(ctx)
+		assert.ErrorAs(t, err, &rotationError)
+	})
+
+	t.Run("StrategyTestFails", func(t *testing.T) {
+		strategy, _ := NewStaticStrategy(StrategyOptions{Logger: zap.NewNop()})
+		err := newSteps("old", valid, &failingTestStrategy{strategy}).TestSecretStep(ctx)
+		assert.ErrorAs(t, err, &rotationError)
+	})
+
+	t.Run("MissingPendingVersion", func(t *testing.T) {
+		steps := newSteps("old", valid, nil)
+		delete(steps.Client.(*stagedValuesClient).values, "AWSPENDING")
+		assert.ErrorAs(t, steps.TestSecretStep(ctx), &rotationError)
+	})
+}
+
+func TestFinishSecretStep(t *testing.T) {
+	ctx := context.Background()
+
+	newSteps := func(c *labelsClient) *StepsClient {
+		strategy, _ := NewStaticStrategy(StrategyOptions{Logger: zap.NewNop()})
+		return NewStepExecutionerClient(zap.NewNop(), c,
+			Event{Token: aws.String(testToken), Arn: aws.String(testSecretArn)},
+			&secretsmanager.DescribeSecretOutput{ARN: aws.String(testSecretArn)},
+			strategy, generator.DefaultPolicy())
+	}
+
+	newClient := func() *labelsClient {
+		return &labelsClient{
+			versions: map[string][]string{
+				"v0":      {"AWSPREVIOUS"},
+				"v1":      {"AWSCURRENT"},
+				"v2":      {},
+				testToken: {"AWSPENDING"},
+			},
+			values: map[string]string{"v0": "zero", "v1": "one", "v2": "two", testToken: "new"},
+		}
+	}
+
+	t.Run("MovesCurrentAndPrevious", func(t *testing.T) {
+		// Repeated, since the versions map is iterated in random order.
+		for i := 0; i < 20; i++ {
+			c := newClient()
+			assert.NoError(t, newSteps(c).FinishSecretStep(ctx))
+			assert.ElementsMatch(t, []string{"AWSPENDING", "AWSCURRENT"}, c.versions[testToken])
+			assert.Equal(t, []string{"AWSPREVIOUS"}, c.versions["v1"])
+			assert.Empty(t, c.versions["v0"])
+		}
+	})
+
+	t.Run("MovesPreviousWhenSecretsManagerDoesNot", func(t *testing.T) {
+		c := newClient()
+		c.manualPrevious = true
+		assert.NoError(t, newSteps(c).FinishSecretStep(ctx))
+		assert.Equal(t, []string{"AWSPREVIOUS"}, c.versions["v1"])
+		assert.Empty(t, c.versions["v0"])
+		assert.Equal(t, 2, c.updateCalls)
+	})
+
+	t.Run("IsIdempotent", func(t *testing.T) {
+		c := newClient()
+		steps := newSteps(c)
+		assert.NoError(t, steps.FinishSecretStep(ctx))
+		calls := c.updateCalls
+
+		assert.NoError(t, steps.FinishSecretStep(ctx))
+		assert.Equal(t, calls, c.updateCalls, "a retried finish step should not move any label")
+		assert.Equal(t, "v1", findVersionWithStage(c.versions, "AWSPREVIOUS"))
+	})
+
+	t.Run("UnknownToken", func(t *testing.T) {
+		c := newClient()
+		delete(c.versions, testToken)
+
+		var rotationError *erroer.RotationError
+		assert.ErrorAs(t, newSteps(c).FinishSecretStep(ctx), &rotationError)
+		assert.Equal(t, 0, c.updateCalls)
+	})
+}
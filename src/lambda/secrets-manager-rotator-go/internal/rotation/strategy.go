@@ -0,0 +1,132 @@
+package rotation
+
+import (
+	"context"
+	"fmt"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/generator"
+	"go.uber.org/zap"
+	"sort"
+	"sync"
+)
+
+// RotationStrategy holds the secret-type specific behaviour of a rotation. The StepsClient
+// deals with the Secrets Manager versions and staging labels, and calls these hooks on each
+// step.
+type RotationStrategy interface {
+	// CreateSecret returns the value that'll be stored as the AWSPENDING version.
+	CreateSecret(ctx context.Context, current string) (string, error)
+	// SetSecret applies the AWSPENDING value in the target system (e.g.: a database).
+	SetSecret(ctx context.Context, current, pending string) error
+	// TestSecret checks that the AWSPENDING value works in the target system.
+	TestSecret(ctx context.Context, pending string) error
+	// FinishSecret runs right before AWSCURRENT is moved to the AWSPENDING version.
+	FinishSecret(ctx context.Context, current, pending string) error
+	// GeneratedValues returns the parts of the AWSPENDING value that were generated, so they can
+	// be checked against the generation policy.
+	GeneratedValues(pending string) ([]string, error)
+}
+
+type StrategyOptions struct {
+	Logger *zap.Logger
+	Client client.SecretsManager
+	// JSONKeys are the keys to rotate when the secret value is a JSON object.
+	JSONKeys []string
+	// SecretJSONKeys are the keys set in the JSONKeyTagKey tag of the secret, if any. The
+	// strategies that always rotate the password of a database credential reject them.
+	SecretJSONKeys []string
+	// SecretARN is the ARN of the rotated secret, to read its other versions (e.g.: AWSPREVIOUS).
+	SecretARN string
+	// Generator generates the new secret values, following Policy.
+	Generator generator.Generator
+	Policy    generator.Policy
+}
+
+// withDefaults returns a copy of the options, with the unset fields set to their defaults.
+func (o StrategyOptions) withDefaults() StrategyOptions {
+	if len(o.JSONKeys) == 0 {
+		o.JSONKeys = config.DefaultJSONKeys
+	}
+
+	if o.Generator == nil {
+		o.Generator = &AWSGenerator{Client: o.Client}
+	}
+
+	if o.Policy.Format == "" {
+		o.Policy = generator.DefaultPolicy()
+	}
+
+	return o
+}
+
+// rejectSecretJSONKeys returns a configuration error if the secret sets the JSON keys to rotate,
+// since the given strategy ignores them.
+func rejectSecretJSONKeys(opts StrategyOptions, strategy string) error {
+	if len(opts.SecretJSONKeys) == 0 {
+		return nil
+	}
+
+	return erroer.NewConfigurationError(fmt.Sprintf("tag %s is not supported by the %s strategy, it "+
+		"always rotates the password field", JSONKeyTagKey, strategy), nil)
+}
+
+type StrategyFactory func(opts StrategyOptions) (RotationStrategy, error)
+
+var (
+	strategiesMu sync.RWMutex
+	strategies   = map[string]StrategyFactory{}
+)
+
+// RegisterStrategy makes a strategy available by name. Registering the same name twice
+// replaces the previous factory.
+func RegisterStrategy(name string, factory StrategyFactory) {
+	strategiesMu.Lock()
+	defer strategiesMu.Unlock()
+
+	strategies[name] = factory
+}
+
+// IsStrategyRegistered returns true if there's a strategy registered with the given name.
+func IsStrategyRegistered(name string) bool {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+
+	_, ok := strategies[name]
+	return ok
+}
+
+// RegisteredStrategies returns the (sorted) names of all the registered strategies.
+func RegisteredStrategies() []string {
+	strategiesMu.RLock()
+	defer strategiesMu.RUnlock()
+
+	var names []string
+	for name := range strategies {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
+// NewStrategy builds the strategy registered with the given name.
+func NewStrategy(name string, opts StrategyOptions) (RotationStrategy, error) {
+	strategiesMu.RLock()
+	factory, ok := strategies[name]
+	strategiesMu.RUnlock()
+
+	if !ok {
+		return nil, erroer.NewConfigurationError(fmt.Sprintf(
+			"there is no rotation strategy registered for secret type %s", name), nil)
+	}
+
+	return factory(opts)
+}
+
+func init() {
+	RegisterStrategy(GetSecretTypes().Static, NewStaticStrategy)
+	RegisterStrategy(GetSecretTypes().Db, NewPostgresStrategy)
+	RegisterStrategy(GetSecretTypes().DbMultiUser, NewAlternatingUsersStrategy)
+}
@@ -4,6 +4,9 @@ type Event struct {
 	Token *string `json:"ClientRequestToken"`
 	Arn   *string `json:"SecretId"`
 	Step  *string `json:"Step"`
+	// DryRun returns the plan of the step instead of running it (see Plan). It's never set by
+	// Secrets Manager, only by manual invocations.
+	DryRun bool `json:"DryRun,omitempty"`
 }
 
 type Input struct {
@@ -26,6 +29,7 @@ type DiscoveredSecrets struct {
 }
 
 type SecretType struct {
-	Db     string // TODO: To implement later.
-	Static string
+	Db          string
+	DbMultiUser string
+	Static      string
 }
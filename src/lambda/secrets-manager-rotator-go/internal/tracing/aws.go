@@ -0,0 +1,34 @@
+package tracing
+
+import (
+	"context"
+	awsmiddleware "github.com/aws/aws-sdk-go-v2/aws/middleware"
+	"github.com/aws/smithy-go/middleware"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+)
+
+// TraceAPICalls is an APIOptions function of the AWS clients that wraps each operation
+// (including its retries) in a span, child of the span of the request context.
+func TraceAPICalls(stack *middleware.Stack) error {
+	return stack.Initialize.Add(middleware.InitializeMiddlewareFunc("TraceAPICalls",
+		func(ctx context.Context, in middleware.InitializeInput, next middleware.InitializeHandler) (
+			middleware.InitializeOutput, middleware.Metadata, error) {
+			service := awsmiddleware.GetServiceID(ctx)
+			operation := awsmiddleware.GetOperationName(ctx)
+
+			ctx, span := Start(ctx, service+"."+operation,
+				semconv.RPCSystemKey.String("aws-api"),
+				semconv.RPCService(service),
+				semconv.RPCMethod(operation),
+			)
+
+			out, metadata, err := next.HandleInitialize(ctx, in)
+
+			if requestID, ok := awsmiddleware.GetRequestIDMetadata(metadata); ok {
+				span.SetAttributes(semconv.AWSRequestID(requestID))
+			}
+
+			End(span, err)
+			return out, metadata, err
+		}), middleware.After)
+}
@@ -0,0 +1,100 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+	"io"
+)
+
+// TracerName is the instrumentation name of the spans of the rotator.
+const TracerName = "github.com/excoriate/aws-secrets-rotation-lambda"
+
+// ServiceName is the service.name resource attribute of the exported spans.
+const ServiceName = "secrets-manager-rotator"
+
+// Attributes of the rotation spans.
+const (
+	AttributeSecretArn = attribute.Key("rotation.secret_arn")
+	AttributeStep      = attribute.Key("rotation.step")
+	AttributeToken     = attribute.Key("rotation.token")
+	AttributeStrategy  = attribute.Key("rotation.strategy")
+)
+
+type Exporter string
+
+const (
+	// ExporterNone disables the tracing, spans aren't recorded.
+	ExporterNone Exporter = ""
+	// ExporterOTLP exports the spans through OTLP over HTTP. The collector is configured with the
+	// standard OTEL_EXPORTER_OTLP_* environment variables.
+	ExporterOTLP Exporter = "otlp"
+	// ExporterStdout writes the spans as JSON, for local use.
+	ExporterStdout Exporter = "stdout"
+)
+
+// Start starts a span, child of the span of the context (if any).
+func Start(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	return otel.Tracer(TracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// End ends the span, recording err (if any) as its status.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
+
+// NewTracerProvider builds the tracer provider of the given exporter, and sets it as the global
+// one. It returns nil (and the global no-op provider is kept) for ExporterNone.
+func NewTracerProvider(ctx context.Context, exporter Exporter, stdout io.Writer) (*sdktrace.TracerProvider,
+	error) {
+	var spanExporter sdktrace.SpanExporter
+	var err error
+
+	switch exporter {
+	case ExporterNone:
+		return nil, nil
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	case ExporterStdout:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	default:
+		return nil, fmt.Errorf("unknown trace exporter %q, it must be %q or %q", exporter, ExporterOTLP,
+			ExporterStdout)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("unable to create the %s trace exporter: %w", exporter, err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceName(ServiceName))),
+	)
+
+	otel.SetTracerProvider(provider)
+	return provider, nil
+}
+
+// Flush exports the spans that are still buffered by the global tracer provider. The Lambda
+// environment is frozen between invocations, so it must be called before each one returns.
+func Flush(ctx context.Context) error {
+	if provider, ok := otel.GetTracerProvider().(*sdktrace.TracerProvider); ok {
+		return provider.ForceFlush(ctx)
+	}
+
+	return nil
+}
@@ -0,0 +1,121 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func useSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	original := otel.GetTracerProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(original)
+	})
+
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	return recorder
+}
+
+func TestStartAndEnd(t *testing.T) {
+	recorder := useSpanRecorder(t)
+
+	ctx, parent := Start(context.Background(), "parent", AttributeStep.String("createSecret"))
+	_, child := Start(ctx, "child")
+	End(child, errors.New("boom"))
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "child", spans[0].Name())
+		assert.Equal(t, codes.Error, spans[0].Status().Code)
+		assert.Equal(t, "boom", spans[0].Status().Description)
+		assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+
+		assert.Equal(t, "parent", spans[1].Name())
+		assert.Equal(t, codes.Unset, spans[1].Status().Code)
+		assert.Contains(t, spans[1].Attributes(), AttributeStep.String("createSecret"))
+	}
+}
+
+func TestNewTracerProvider(t *testing.T) {
+	original := otel.GetTracerProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(original)
+	})
+
+	provider, err := NewTracerProvider(context.Background(), ExporterNone, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, provider)
+
+	_, err = NewTracerProvider(context.Background(), "zipkin", nil)
+	assert.Error(t, err)
+
+	var out bytes.Buffer
+	provider, err = NewTracerProvider(context.Background(), ExporterStdout, &out)
+	assert.NoError(t, err)
+	assert.NotNil(t, provider)
+
+	_, span := Start(context.Background(), "handleRequest")
+	End(span, nil)
+
+	assert.NoError(t, Flush(context.Background()))
+	assert.Contains(t, out.String(), `"Name":"handleRequest"`)
+	assert.Contains(t, out.String(), ServiceName)
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestTraceAPICalls(t *testing.T) {
+	recorder := useSpanRecorder(t)
+
+	httpClient := &http.Client{Transport: roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header: http.Header{
+				"Content-Type":     []string{"application/x-amz-json-1.1"},
+				"X-Amzn-Requestid": []string{"request-1"},
+			},
+			Body:    io.NopCloser(strings.NewReader(`{"ARN":"arn","Name":"name"}`)),
+			Request: req,
+		}, nil
+	})}
+
+	api := secretsmanager.NewFromConfig(aws.Config{
+		Region:      "us-east-1",
+		Credentials: credentials.NewStaticCredentialsProvider("test", "test", ""),
+		HTTPClient:  httpClient,
+	}, func(o *secretsmanager.Options) {
+		o.APIOptions = append(o.APIOptions, TraceAPICalls)
+	})
+
+	ctx, parent := Start(context.Background(), "createSecret")
+	_, err := api.DescribeSecret(ctx, &secretsmanager.DescribeSecretInput{SecretId: aws.String("name")})
+	assert.NoError(t, err)
+	End(parent, nil)
+
+	spans := recorder.Ended()
+	if assert.Len(t, spans, 2) {
+		assert.Equal(t, "Secrets Manager.DescribeSecret", spans[0].Name())
+		assert.Equal(t, spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+		assert.Contains(t, spans[0].Attributes(), attribute.String("rpc.method", "DescribeSecret"))
+		assert.Contains(t, spans[0].Attributes(), attribute.String("aws.request_id", "request-1"))
+	}
+}
@@ -5,23 +5,55 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/metrics"
 	"github.com/excoriate/aws-secrets-rotation-lambda/internal/rotation"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/tracing"
 	"go.uber.org/zap"
 	"os"
 )
 
-// GetLogger returns a new zap logger
+// GetLogger returns a new zap logger, at the log level of the runtime configuration (info until
+// it's loaded)
 func GetLogger() *zap.Logger {
-	logger, _ := zap.NewProduction()
+	cfg := zap.NewProductionConfig()
+	if coldStartConfig != nil && coldStartConfig.err == nil {
+		cfg.Level = zap.NewAtomicLevelAt(coldStartConfig.cfg.LogLevel)
+	}
+
+	logger, _ := cfg.Build()
 	return logger
 }
 
-// ListSecretsInAccount lists all secrets in the account
-func ListSecretsInAccount(rotator *rotation.RotatorClient) ([]rotation.DiscoveredSecrets,
-	error) {
+// loadedConfig is the outcome of loading the runtime configuration.
+type loadedConfig struct {
+	cfg config.Config
+	err error
+}
+
+// coldStartConfig is the runtime configuration, loaded once per cold start by main. If it's nil
+// (e.g.: in tests), it's loaded on each invocation instead.
+var coldStartConfig *loadedConfig
+
+// runtimeConfig returns the runtime configuration. An invalid configuration fails every
+// invocation with a configuration error, instead of crashing the cold start.
+func runtimeConfig(ctx context.Context, logger *zap.Logger) (config.Config, error) {
+	if coldStartConfig != nil {
+		return coldStartConfig.cfg, coldStartConfig.err
+	}
+
+	return config.Load(ctx, logger, rotation.GetAWSOptions()...)
+}
+
+// ListSecretsInAccount lists the secrets in the account selected by the filter
+func ListSecretsInAccount(ctx context.Context, rotator *rotation.RotatorClient,
+	filter client.ListFilter) ([]rotation.DiscoveredSecrets, error) {
 
 	rotator.Logger.Info("Discovering secrets in account...")
-	secrets, err := rotator.Client.ListAll()
+	secrets, err := rotator.Client.ListAll(ctx, filter)
 
 	if err != nil {
 		rotator.Logger.Error("failed to list secrets", zap.Error(err))
@@ -69,12 +101,55 @@ func ListSecretsInAccount(rotator *rotation.RotatorClient) ([]rotation.Discovere
 	return discoveredSecrets, nil
 }
 
-func handleRequest(ctx context.Context, event rotation.Event) (string, error) {
+// newRotator builds the rotator used by handleRequest. It's a variable, so tests can replace
+// it with a rotator that doesn't talk to AWS.
+var newRotator = rotation.NewRotator
+
+// handleRequest runs the step of the rotation event. If it's a dry-run (set by the event or by the
+// runtime configuration), it returns the plan of the step instead, and its outcome isn't reported.
+func handleRequest(ctx context.Context, event rotation.Event) (result interface{}, err error) {
 	logger := GetLogger()
-	defer logger.Sync()
 
-	if event == (rotation.Event{}) {
-		logger.Fatal("No event received")
+	ctx, span := tracing.Start(ctx, "handleRequest",
+		tracing.AttributeSecretArn.String(aws.ToString(event.Arn)),
+		tracing.AttributeStep.String(aws.ToString(event.Step)),
+		tracing.AttributeToken.String(aws.ToString(event.Token)))
+
+	// report audits and notifies the outcome of the step, once it's initialised.
+	var report *outcomeReporter
+
+	// A panic (e.g.: a malformed event) is reported as a function error, instead of crashing
+	// the process. The outcome is reported, and the logger is flushed in any case.
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Error("Secret rotation panicked", zap.Any("panic", r), zap.Stack("stack"))
+			result = nil
+			err = erroer.NewRotationError(fmt.Sprintf("secret rotation panicked: %v", r), nil)
+		}
+
+		if report != nil {
+			err = report.finish(ctx, err)
+			if err != nil {
+				result = nil
+			}
+		}
+
+		tracing.End(span, err)
+		if flushErr := tracing.Flush(ctx); flushErr != nil {
+			logger.Warn("Unable to export the spans of the invocation", zap.Error(flushErr))
+		}
+
+		_ = logger.Sync()
+	}()
+
+	// The event is only validated here, whether it was decoded by handleInvocation or not.
+	_, validSpan := tracing.Start(ctx, "IsRotationAttemptValid")
+	validErr := rotation.ValidateEvent(event)
+	tracing.End(validSpan, validErr)
+
+	if validErr != nil {
+		logger.Error("Rotation attempt is not valid", zap.Error(validErr))
+		return nil, validErr
 	}
 
 	// Logging the event
@@ -82,22 +157,43 @@ func handleRequest(ctx context.Context, event rotation.Event) (string, error) {
 	logger.Info("Event received for a secret rotation attempt: ", zap.String("event",
 		string(eventJson)))
 
-	// Feature flag, enable/disable it setting the environment variable TF_VAR_rotation_lambda_enabled
-	isEnabled := os.Getenv("TF_VAR_rotation_lambda_enabled")
-	if isEnabled == "false" {
-		logger.Fatal("Rotation lambda is disabled")
+	cfg, err := runtimeConfig(ctx, logger)
+	if err != nil {
+		logger.Error("Rotation lambda configuration is not valid", zap.Error(err))
+		return nil, err
+	}
+
+	ctx = metrics.WithRecorder(ctx, newMetricsRecorder(cfg.Metrics.Namespace))
+
+	// Feature flag, enable/disable it through the enabled setting of the runtime configuration
+	// (e.g.: the environment variable TF_VAR_rotation_lambda_enabled)
+	if !cfg.Enabled {
+		logger.Error("Rotation lambda is disabled")
+		return nil, erroer.NewConfigurationError("rotation lambda is disabled", nil)
+	}
+
+	// A dry-run doesn't change anything, so there's no outcome to audit or notify.
+	dryRun := cfg.DryRun || event.DryRun
+	if dryRun {
+		logger.Info("Dry-run: the step will be planned, but not run")
+	} else {
+		report, err = newOutcomeReporter(ctx, cfg, logger, event)
+		if err != nil {
+			return nil, err
+		}
 	}
 
 	// Create the rotator client.
-	c, err := rotation.NewRotator(event, logger)
+	c, err := newRotator(ctx, cfg, event, logger)
 
 	if err != nil {
-		logger.Fatal("AWS Secrets manager rotator lambda cannot be initialised", zap.Error(err))
+		logger.Error("AWS Secrets manager rotator lambda cannot be initialised", zap.Error(err))
+		return nil, fmt.Errorf("AWS Secrets manager rotator lambda cannot be initialised: %w", err)
 	}
 
-	// Run pre-checks for rotating this secret
-	if err := c.IsRotationAttemptValid(event); err != nil {
-		logger.Fatal("Rotation attempt is not valid", zap.Error(err))
+	c.DryRun = dryRun
+	if report != nil {
+		report.rotator = c
 	}
 
 	secretId := *event.Arn
@@ -107,20 +203,74 @@ func handleRequest(ctx context.Context, event rotation.Event) (string, error) {
 	logger.Info(fmt.Sprintf("Rotation attempt is valid for step %s", rotationStep))
 	logger.Info(fmt.Sprintf("Rotation attempt is valid for token %s", token))
 
-	targetSecret, valErr := c.IsSecretValidToRotate(secretId, token)
+	targetSecret, valErr := c.IsSecretValidToRotate(ctx, secretId, token)
 	if valErr != nil {
-		logger.Fatal("Secret is not valid to rotate", zap.Error(valErr))
+		logger.Error("Secret is not valid to rotate", zap.Error(valErr))
+		return nil, fmt.Errorf("secret is not valid to rotate: %w", valErr)
+	}
+
+	if report != nil {
+		report.secret = targetSecret
+	}
+
+	secretType, typeErr := c.ResolveSecretType(ctx, targetSecret)
+	if typeErr != nil {
+		logger.Error("Secret type can not be resolved", zap.Error(typeErr))
+		return nil, fmt.Errorf("secret type can not be resolved: %w", typeErr)
+	}
+
+	if report != nil {
+		report.strategy = secretType
+	}
+
+	span.SetAttributes(tracing.AttributeStrategy.String(secretType))
+
+	// Like the AWS rotation templates, a step re-invoked after the rotation finished succeeds
+	// without doing anything.
+	if rotation.IsVersionCurrent(targetSecret, token) {
+		logger.Info(fmt.Sprintf("Secret version %s is already AWSCURRENT, there is nothing to rotate", token))
+		return "Secret rotation already completed", nil
+	}
+
+	if dryRun {
+		plan, err := c.PlanRotation(ctx, event, targetSecret, rotationStep, secretType)
+		if plan != nil {
+			planJson, _ := json.Marshal(plan)
+			logger.Info("Dry-run plan of the secret rotation", zap.String("plan", string(planJson)))
+		}
+
+		if err != nil {
+			logger.Error("Secret rotation dry-run failed", zap.Error(err))
+			return nil, fmt.Errorf("secret rotation dry-run failed: %w", err)
+		}
+
+		return plan, nil
 	}
 
 	// Perform rotation.
-	// TODO: Perform an opinionated approach to identify the secret type
-	if err := c.Rotate(event, targetSecret, rotationStep, "static"); err != nil {
-		logger.Fatal("Secret rotation failed", zap.Error(err))
+	if err := c.Rotate(ctx, event, targetSecret, rotationStep, secretType); err != nil {
+		logger.Error("Secret rotation failed", zap.Error(err))
+		return nil, fmt.Errorf("secret rotation failed: %w", err)
 	}
 
 	return "Secret rotation completed", nil
 }
 
 func main() {
-	lambda.Start(handleRequest)
+	logger := GetLogger()
+	cfg, err := config.Load(context.Background(), logger, rotation.GetAWSOptions()...)
+	if err != nil {
+		logger.Error("Runtime configuration cannot be loaded, every invocation will fail", zap.Error(err))
+	}
+
+	coldStartConfig = &loadedConfig{cfg: cfg, err: err}
+
+	// The tracer provider lives as long as the execution environment, and it's flushed at the end
+	// of each invocation.
+	if _, err := tracing.NewTracerProvider(context.Background(), cfg.Tracing.Exporter,
+		os.Stdout); err != nil {
+		GetLogger().Error("Tracing cannot be initialised, spans won't be exported", zap.Error(err))
+	}
+
+	lambda.Start(handleInvocation)
 }
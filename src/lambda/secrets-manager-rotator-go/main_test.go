@@ -3,24 +3,41 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/audit"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/client"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/metrics"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/notifier"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/posture"
 	sm "github.com/excoriate/aws-secrets-rotation-lambda/internal/rotation"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/tracing"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.uber.org/zap"
 	"os"
+	"path/filepath"
 	"testing"
 	"time"
 )
 
 //var mockCreateSecretEvent = "../../../mock/events/secretsmanager-event-1.json"
 
-//var mockCreateSecretEvent = "../../../mock/events/secret-to-rotate.json"
+// var mockCreateSecretEvent = "../../../mock/events/secret-to-rotate.json"
 var mockCreateSecretEvent = "../../../mock/events/secret-to-rotate-valid.json"
 
 func TestMainTest(t *testing.T) {
 	d := time.Now().Add(50 * time.Millisecond)
 	_ = os.Setenv("AWS_LAMBDA_FUNCTION_NAME", "rotator-lambda-go")
 
-	ctx, _ := context.WithDeadline(context.Background(), d)
+	ctx, cancel := context.WithDeadline(context.Background(), d)
+	defer cancel()
 	ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{
 		AwsRequestID:       "495b12a8-xmpl-4eca-8168-160484189f99",
 		InvokedFunctionArn: "arn:adapter:lambda:us-east-2:123456789012:function:blank-go",
@@ -40,6 +57,8 @@ func TestMainTest(t *testing.T) {
 		var event sm.Event
 		_ = json.Unmarshal(inputJson, &event)
 
+		useInMemoryBackend(t, *event.Arn, *event.Token, `{"password":"initial-password"}`)
+
 		result, err := handleRequest(ctx, event)
 
 		assert.NoError(t, err, "should not error")
@@ -47,6 +66,620 @@ func TestMainTest(t *testing.T) {
 	})
 }
 
+func TestHandleRequestErrors(t *testing.T) {
+	ctx := context.Background()
+	validEvent := sm.Event{
+		Token: aws.String("2d493794-4bf3-4aba-bae4-d372c431f75a"),
+		Arn:   aws.String("arn:aws:secretsmanager:us-east-1:123456789012:secret:test-AbCdEf"),
+		Step:  aws.String("createSecret"),
+	}
+
+	defer func(original func(context.Context, config.Config, sm.Event, *zap.Logger) (*sm.RotatorClient, error)) {
+		newRotator = original
+	}(newRotator)
+
+	t.Run("EmptyEvent", func(t *testing.T) {
+		_, err := handleRequest(ctx, sm.Event{})
+
+		var validationError *erroer.RotatorValidationError
+		assert.ErrorAs(t, err, &validationError)
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		t.Setenv("TF_VAR_rotation_lambda_enabled", "false")
+		_, err := handleRequest(ctx, validEvent)
+
+		var configurationError *erroer.RotatorConfigurationError
+		assert.ErrorAs(t, err, &configurationError)
+	})
+
+	t.Run("InvalidConfiguration", func(t *testing.T) {
+		t.Setenv("TF_VAR_rotation_generator", "vault")
+		_, err := handleRequest(ctx, validEvent)
+
+		var configurationError *erroer.RotatorConfigurationError
+		assert.ErrorAs(t, err, &configurationError)
+	})
+
+	t.Run("ColdStartConfiguration", func(t *testing.T) {
+		coldStartConfig = &loadedConfig{cfg: config.Default()}
+		defer func() {
+			coldStartConfig = nil
+		}()
+
+		coldStartConfig.cfg.Enabled = false
+		_, err := handleRequest(ctx, validEvent)
+
+		var configurationError *erroer.RotatorConfigurationError
+		assert.ErrorAs(t, err, &configurationError, "the configuration isn't loaded again")
+	})
+
+	t.Run("SecretNotAllowed", func(t *testing.T) {
+		t.Setenv("TF_VAR_rotation_allowed_prefixes", "prod/")
+		useInMemoryBackend(t, *validEvent.Arn, *validEvent.Token, "initial-password")
+
+		_, err := handleRequest(ctx, validEvent)
+
+		var validationError *erroer.RotatorValidationError
+		assert.ErrorAs(t, err, &validationError)
+		assert.ErrorContains(t, err, "is not allowed to be rotated")
+	})
+
+	t.Run("RotatorCannotBeInitialised", func(t *testing.T) {
+		newRotator = func(ctx context.Context, cfg config.Config, event sm.Event,
+			logger *zap.Logger) (*sm.RotatorClient, error) {
+			return nil, erroer.NewConfigurationError("no credentials", nil)
+		}
+
+		_, err := handleRequest(ctx, validEvent)
+
+		var configurationError *erroer.RotatorConfigurationError
+		assert.ErrorAs(t, err, &configurationError)
+	})
+
+	t.Run("MalformedEvent", func(t *testing.T) {
+		result, err := handleRequest(ctx, sm.Event{Arn: validEvent.Arn})
+
+		var validationError *erroer.RotatorValidationError
+		assert.ErrorAs(t, err, &validationError)
+		assert.ErrorIs(t, err, erroer.ErrEventFieldMissing)
+		assert.Empty(t, result)
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		// A rotator without a Secrets Manager client panics as soon as it's used.
+		newRotator = func(ctx context.Context, cfg config.Config, event sm.Event,
+			logger *zap.Logger) (*sm.RotatorClient, error) {
+			return &sm.RotatorClient{Logger: logger}, nil
+		}
+
+		result, err := handleRequest(ctx, validEvent)
+
+		var rotationError *erroer.RotationError
+		assert.ErrorAs(t, err, &rotationError)
+		assert.Empty(t, result)
+	})
+}
+
+func TestHandleAdminActionErrors(t *testing.T) {
+	ctx := context.Background()
+
+	defer func(original func(context.Context, config.Config, sm.Event, *zap.Logger) (*sm.RotatorClient, error)) {
+		newRotator = original
+	}(newRotator)
+
+	t.Run("InvalidActionIsRejectedFirst", func(t *testing.T) {
+		built := false
+		newRotator = func(ctx context.Context, cfg config.Config, event sm.Event,
+			logger *zap.Logger) (*sm.RotatorClient, error) {
+			built = true
+			return &sm.RotatorClient{Logger: logger}, nil
+		}
+
+		_, err := handleAdminAction(ctx, sm.AdminAction{Action: sm.ActionRollback})
+		assert.ErrorIs(t, err, erroer.ErrEventFieldMissing)
+		assert.False(t, built, "the rotator must not be built for an invalid action")
+	})
+
+	t.Run("Panic", func(t *testing.T) {
+		// A rotator without a Secrets Manager client panics as soon as it's used.
+		newRotator = func(ctx context.Context, cfg config.Config, event sm.Event,
+			logger *zap.Logger) (*sm.RotatorClient, error) {
+			return &sm.RotatorClient{Logger: logger}, nil
+		}
+
+		var result interface{}
+		var err error
+		assert.NotPanics(t, func() {
+			result, err = handleAdminAction(ctx, sm.AdminAction{Action: sm.ActionListSecrets})
+		})
+
+		var rotationError *erroer.RotationError
+		assert.ErrorAs(t, err, &rotationError)
+		assert.Empty(t, result)
+	})
+}
+
+type recordingNotifier struct {
+	events []notifier.Event
+}
+
+func (r *recordingNotifier) Notify(ctx context.Context, event notifier.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func useRecordingNotifier(t *testing.T) *recordingNotifier {
+	recorder := &recordingNotifier{}
+	original := newNotifier
+	t.Cleanup(func() {
+		newNotifier = original
+	})
+
+	newNotifier = func(ctx context.Context, cfg config.Notifications, logger *zap.Logger) (notifier.Notifier,
+		error) {
+		return recorder, nil
+	}
+
+	return recorder
+}
+
+func useInMemoryMetrics(t *testing.T) *metrics.InMemoryRecorder {
+	recorder := &metrics.InMemoryRecorder{}
+	original := newMetricsRecorder
+	t.Cleanup(func() {
+		newMetricsRecorder = original
+	})
+
+	newMetricsRecorder = func(namespace string) metrics.Recorder {
+		return recorder
+	}
+
+	return recorder
+}
+
+func TestHandleRequestFullRotation(t *testing.T) {
+	ctx := context.Background()
+	secretArn := "arn:aws:secretsmanager:us-east-1:123456789012:secret:full-rotation-AbCdEf"
+	token := "6c5a3d1e-8d2b-4f1a-9c3e-2b7f0e4a1d9c"
+	t.Setenv("TF_VAR_rotation_generator", "local")
+
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("TF_VAR_rotation_audit_file", auditFile)
+	t.Setenv("TF_VAR_rotation_audit_salt", "salt")
+	ctx = lambdacontext.NewContext(ctx, &lambdacontext.LambdaContext{
+		AwsRequestID: "495b12a8-xmpl-4eca-8168-160484189f99",
+	})
+
+	backend := useInMemoryBackend(t, secretArn, token, `{"username":"app","password":"initial-password"}`)
+	recorder := useRecordingNotifier(t)
+
+	for _, step := range []string{"createSecret", "setSecret", "testSecret", "finishSecret"} {
+		_, err := handleRequest(ctx, sm.Event{
+			Arn:   aws.String(secretArn),
+			Token: aws.String(token),
+			Step:  aws.String(step),
+		})
+
+		assert.NoErrorf(t, err, "step %s should not error", step)
+	}
+
+	current, err := backend.GetSecretValue(ctx, secretArn, "", "AWSCURRENT")
+	assert.NoError(t, err)
+	assert.Equal(t, token, aws.ToString(current.VersionId))
+	assert.Contains(t, aws.ToString(current.SecretString), `"username":"app"`)
+	assert.NotContains(t, aws.ToString(current.SecretString), "initial-password")
+
+	previous, err := backend.GetSecretValue(ctx, secretArn, "", "AWSPREVIOUS")
+	assert.NoError(t, err)
+	assert.Contains(t, aws.ToString(previous.SecretString), "initial-password")
+
+	// Removing AWSPENDING is done by Secrets Manager once the rotation completes, not by the lambda.
+	pending, err := backend.GetSecretValue(ctx, secretArn, "", "AWSPENDING")
+	assert.NoError(t, err)
+	assert.Equal(t, token, aws.ToString(pending.VersionId))
+
+	records, err := audit.NewFileSink(auditFile).Query(ctx, secretArn)
+	assert.NoError(t, err)
+
+	if assert.Len(t, records, 4) {
+		for _, record := range records {
+			assert.Equal(t, "succeeded", record.Outcome)
+			assert.Equal(t, token, record.PendingVersionID)
+			assert.Equal(t, "495b12a8-xmpl-4eca-8168-160484189f99", record.RequestID)
+			assert.Equal(t, audit.Fingerprint("salt", aws.ToString(current.SecretString)), record.Fingerprint)
+		}
+
+		assert.Equal(t, aws.ToString(previous.VersionId), records[0].CurrentVersionID)
+	}
+
+	var notifiedSteps []string
+	for _, event := range recorder.events {
+		assert.Equal(t, notifier.OutcomeSucceeded, event.Outcome)
+		notifiedSteps = append(notifiedSteps, event.Step)
+	}
+
+	assert.Equal(t, []string{"createSecret", "setSecret", "testSecret", "finishSecret",
+		notifier.StepRotation}, notifiedSteps)
+}
+
+func TestHandleRequestRetriedFinishSecret(t *testing.T) {
+	ctx := context.Background()
+	secretArn := "arn:aws:secretsmanager:us-east-1:123456789012:secret:retried-rotation-AbCdEf"
+	token := "0f9e8d7c-6b5a-4c3d-8e2f-1a0b9c8d7e6f"
+	t.Setenv("TF_VAR_rotation_generator", "local")
+
+	backend := useInMemoryBackend(t, secretArn, token, "initial-password")
+	useRecordingNotifier(t)
+
+	for _, step := range []string{"createSecret", "setSecret", "testSecret", "finishSecret"} {
+		_, err := handleRequest(ctx, sm.Event{
+			Arn:   aws.String(secretArn),
+			Token: aws.String(token),
+			Step:  aws.String(step),
+		})
+
+		assert.NoErrorf(t, err, "step %s should not error", step)
+	}
+
+	before, err := backend.GetSecret(ctx, secretArn)
+	assert.NoError(t, err)
+
+	// Secrets Manager retries finishSecret if it doesn't get its outcome (e.g.: a timeout).
+	result, err := handleRequest(ctx, sm.Event{
+		Arn:   aws.String(secretArn),
+		Token: aws.String(token),
+		Step:  aws.String("finishSecret"),
+	})
+	assert.NoError(t, err, "a retried finishSecret must be a no-op")
+	assert.NotNil(t, result)
+
+	after, err := backend.GetSecret(ctx, secretArn)
+	assert.NoError(t, err)
+	assert.Equal(t, before.VersionIdsToStages, after.VersionIdsToStages)
+
+	current, err := backend.GetSecretValue(ctx, secretArn, "", "AWSCURRENT")
+	assert.NoError(t, err)
+	assert.Equal(t, token, aws.ToString(current.VersionId))
+}
+
+func TestHandleRequestNotifiesFailures(t *testing.T) {
+	ctx := context.Background()
+	secretArn := "arn:aws:secretsmanager:us-east-1:123456789012:secret:failed-rotation-AbCdEf"
+	token := "0b6e3f0a-2c1d-4e5f-8a9b-7c6d5e4f3a2b"
+
+	backend := useInMemoryBackend(t, secretArn, token, "initial-password")
+	recorder := useRecordingNotifier(t)
+	metricsRecorder := useInMemoryMetrics(t)
+	backend.InjectError("PutSecretValue", errors.New("throttled"))
+
+	_, err := handleRequest(ctx, sm.Event{
+		Arn:   aws.String(secretArn),
+		Token: aws.String(token),
+		Step:  aws.String("createSecret"),
+	})
+	assert.Error(t, err)
+
+	if assert.Len(t, recorder.events, 2) {
+		assert.Equal(t, "createSecret", recorder.events[0].Step)
+		assert.Equal(t, notifier.StepRotation, recorder.events[1].Step)
+		for _, event := range recorder.events {
+			assert.Equal(t, notifier.OutcomeFailed, event.Outcome)
+			assert.Equal(t, erroer.ClassRotation, event.ErrorClass)
+			assert.Equal(t, secretArn, event.SecretArn)
+		}
+	}
+
+	assert.Empty(t, metricsRecorder.Find(metrics.StepSucceeded))
+	if failed := metricsRecorder.Find(metrics.StepFailed); assert.Len(t, failed, 1) {
+		assert.Equal(t, map[string]string{
+			metrics.DimensionStep:       "createSecret",
+			metrics.DimensionStrategy:   "static",
+			metrics.DimensionErrorClass: erroer.ClassRotation,
+		}, failed[0].Dimensions)
+	}
+}
+
+func TestHandleRequestRecordsMetrics(t *testing.T) {
+	ctx := context.Background()
+	secretArn := "arn:aws:secretsmanager:us-east-1:123456789012:secret:metrics-rotation-AbCdEf"
+	token := "3f2a1b0c-9d8e-4f7a-8b6c-5d4e3f2a1b0c"
+	t.Setenv("TF_VAR_rotation_generator", "local")
+
+	useInMemoryBackend(t, secretArn, token, "initial-password")
+	useRecordingNotifier(t)
+	recorder := useInMemoryMetrics(t)
+
+	_, err := handleRequest(ctx, sm.Event{
+		Arn:   aws.String(secretArn),
+		Token: aws.String(token),
+		Step:  aws.String("createSecret"),
+	})
+	assert.NoError(t, err)
+
+	dimensions := map[string]string{
+		metrics.DimensionStep:     "createSecret",
+		metrics.DimensionStrategy: "static",
+	}
+
+	if durations := recorder.Find(metrics.StepDuration); assert.Len(t, durations, 1) {
+		assert.Equal(t, metrics.UnitMilliseconds, durations[0].Unit)
+		assert.Equal(t, dimensions, durations[0].Dimensions)
+	}
+
+	if succeeded := recorder.Find(metrics.StepSucceeded); assert.Len(t, succeeded, 1) {
+		assert.Equal(t, float64(1), succeeded[0].Value)
+		assert.Equal(t, dimensions, succeeded[0].Dimensions)
+	}
+
+	assert.Empty(t, recorder.Find(metrics.StepFailed))
+	if sinceRotation := recorder.Find(metrics.TimeSinceLastRotation); assert.Len(t, sinceRotation, 1) {
+		assert.Equal(t, metrics.UnitSeconds, sinceRotation[0].Unit)
+		assert.GreaterOrEqual(t, sinceRotation[0].Value, float64(0))
+	}
+}
+
+func TestHandleRequestDryRun(t *testing.T) {
+	ctx := context.Background()
+	secretArn := "arn:aws:secretsmanager:us-east-1:123456789012:secret:dry-run-rotation-AbCdEf"
+	token := "7e6d5c4b-3a2f-4e1d-9c8b-7a6f5e4d3c2b"
+	t.Setenv("TF_VAR_rotation_generator", "local")
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("TF_VAR_rotation_audit_file", auditFile)
+	t.Setenv("TF_VAR_rotation_audit_salt", "salt")
+
+	backend := useInMemoryBackend(t, secretArn, token, "initial-password")
+	recorder := useRecordingNotifier(t)
+	metricsRecorder := useInMemoryMetrics(t)
+
+	before, err := backend.GetSecret(ctx, secretArn)
+	assert.NoError(t, err)
+
+	assertPlanned := func(t *testing.T, result interface{}, err error) {
+		assert.NoError(t, err)
+		if plan, ok := result.(*sm.Plan); assert.True(t, ok) {
+			assert.True(t, plan.Passed())
+			assert.Equal(t, secretArn, plan.SecretARN)
+			assert.Equal(t, "static", plan.Strategy)
+			assert.Equal(t, sm.AllowedSteps, plan.Steps)
+		}
+
+		after, err := backend.GetSecret(ctx, secretArn)
+		assert.NoError(t, err)
+		assert.Equal(t, before.VersionIdsToStages, after.VersionIdsToStages)
+
+		current, err := backend.GetSecretValue(ctx, secretArn, "", "AWSCURRENT")
+		assert.NoError(t, err)
+		assert.Equal(t, "initial-password", aws.ToString(current.SecretString))
+	}
+
+	t.Run("EventField", func(t *testing.T) {
+		result, err := handleRequest(ctx, sm.Event{
+			Arn:    aws.String(secretArn),
+			Token:  aws.String(token),
+			Step:   aws.String("finishSecret"),
+			DryRun: true,
+		})
+		assertPlanned(t, result, err)
+	})
+
+	t.Run("Configuration", func(t *testing.T) {
+		t.Setenv("TF_VAR_rotation_dry_run", "true")
+
+		result, err := handleRequest(ctx, sm.Event{
+			Arn:   aws.String(secretArn),
+			Token: aws.String(token),
+			Step:  aws.String("finishSecret"),
+		})
+		assertPlanned(t, result, err)
+	})
+
+	assert.NoFileExists(t, auditFile, "a dry-run must not be audited")
+	assert.Empty(t, recorder.events, "a dry-run must not be notified")
+	assert.Empty(t, metricsRecorder.Find(metrics.StepSucceeded))
+	assert.Empty(t, metricsRecorder.Find(metrics.StepFailed))
+}
+
+func TestHandleRequestTracesTheRotation(t *testing.T) {
+	ctx := context.Background()
+	secretArn := "arn:aws:secretsmanager:us-east-1:123456789012:secret:traced-rotation-AbCdEf"
+	token := "9a8b7c6d-5e4f-4a3b-8c2d-1e0f9a8b7c6d"
+	t.Setenv("TF_VAR_rotation_generator", "local")
+
+	useInMemoryBackend(t, secretArn, token, "initial-password")
+	useRecordingNotifier(t)
+	useInMemoryMetrics(t)
+
+	recorder := tracetest.NewSpanRecorder()
+	original := otel.GetTracerProvider()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(original)
+	})
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	_, err := handleRequest(ctx, sm.Event{
+		Arn:   aws.String(secretArn),
+		Token: aws.String(token),
+		Step:  aws.String("createSecret"),
+	})
+	assert.NoError(t, err)
+
+	spans := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range recorder.Ended() {
+		spans[span.Name()] = span
+	}
+
+	root, ok := spans["handleRequest"]
+	if !assert.True(t, ok, "the invocation should have a root span") {
+		return
+	}
+
+	assert.Contains(t, root.Attributes(), tracing.AttributeSecretArn.String(secretArn))
+	assert.Contains(t, root.Attributes(), tracing.AttributeStep.String("createSecret"))
+	assert.Contains(t, root.Attributes(), tracing.AttributeStrategy.String("static"))
+
+	for _, name := range []string{"IsRotationAttemptValid", "IsSecretValidToRotate", "createSecret"} {
+		if span, ok := spans[name]; assert.Truef(t, ok, "span %s should be recorded", name) {
+			assert.Equal(t, root.SpanContext().SpanID(), span.Parent().SpanID())
+			assert.Equal(t, root.SpanContext().TraceID(), span.SpanContext().TraceID())
+		}
+	}
+}
+
+func TestHandleInvocation(t *testing.T) {
+	ctx := context.Background()
+	secretArn := "arn:aws:secretsmanager:us-east-1:123456789012:secret:routed-rotation-AbCdEf"
+	token := "1d2c3b4a-5f6e-4d7c-8b9a-0f1e2d3c4b5a"
+	t.Setenv("TF_VAR_rotation_generator", "local")
+
+	backend := useInMemoryBackend(t, secretArn, token, "initial-password")
+	useRecordingNotifier(t)
+	useInMemoryMetrics(t)
+
+	t.Run("EventBridgeRotationEvent", func(t *testing.T) {
+		payload := fmt.Sprintf(`{"version":"0","detail-type":"Rotation","source":"custom.rotation",
+			"detail":{"SecretId":%q,"ClientRequestToken":%q,"Step":"createSecret"}}`, secretArn, token)
+
+		result, err := handleInvocation(ctx, json.RawMessage(payload))
+		assert.NoError(t, err)
+		assert.Equal(t, "Secret rotation completed", result)
+
+		pending, err := backend.GetSecretValue(ctx, secretArn, token, "AWSPENDING")
+		assert.NoError(t, err)
+		assert.NotEqual(t, "initial-password", aws.ToString(pending.SecretString))
+	})
+
+	t.Run("AdminAction", func(t *testing.T) {
+		result, err := handleInvocation(ctx, json.RawMessage(`{"action":"list-secrets"}`))
+		assert.NoError(t, err)
+
+		if secrets, ok := result.([]sm.DiscoveredSecrets); assert.True(t, ok) && assert.Len(t, secrets, 1) {
+			assert.Equal(t, secretArn, secrets[0].SecretARN)
+			assert.True(t, secrets[0].IsRotationEnabled)
+		}
+
+		result, err = handleInvocation(ctx, json.RawMessage(`{"action":"list-secrets",
+			"arguments":{"name_prefix":"other-"}}`))
+		assert.NoError(t, err)
+		assert.Empty(t, result)
+
+		_, err = handleInvocation(ctx, json.RawMessage(`{"action":"list-secrets",
+			"arguments":{"tags":"=value"}}`))
+		assert.ErrorIs(t, err, erroer.ErrEventMalformed)
+	})
+
+	t.Run("PostureAudit", func(t *testing.T) {
+		result, err := handleInvocation(ctx, json.RawMessage(`{"action":"posture-audit"}`))
+		assert.NoError(t, err)
+
+		// The rotation started by the first subtest hasn't finished, and it just started.
+		if report, ok := result.(posture.Report); assert.True(t, ok) && assert.Len(t, report.Secrets, 1) {
+			assert.Equal(t, secretArn, report.Secrets[0].ARN)
+			assert.Equal(t, 1, report.Summary.Findings[posture.FindingRotationInProgress])
+			assert.Equal(t, 0, report.Summary.Findings[posture.FindingLastRotationFailed])
+		}
+
+		result, err = handleInvocation(ctx, json.RawMessage(`{"action":"posture-audit",
+			"arguments":{"format":"csv"}}`))
+		assert.NoError(t, err)
+		assert.Contains(t, result, secretArn)
+
+		_, err = handleInvocation(ctx, json.RawMessage(`{"action":"posture-audit",
+			"arguments":{"format":"xml"}}`))
+		var validationError *erroer.RotatorValidationError
+		assert.ErrorAs(t, err, &validationError)
+	})
+
+	t.Run("InvalidPayload", func(t *testing.T) {
+		result, err := handleInvocation(ctx, json.RawMessage(`{"SecretId":"arn","Step":"createSecret"}`))
+		assert.Nil(t, result)
+
+		var eventError *erroer.EventError
+		if assert.ErrorAs(t, err, &eventError) {
+			assert.Equal(t, "ClientRequestToken", eventError.Field)
+		}
+
+		// A malformed event fails the same way, whether it's decoded or handled directly.
+		_, directErr := handleRequest(ctx, sm.Event{Arn: aws.String("arn"), Step: aws.String("createSecret")})
+		assert.Equal(t, directErr.Error(), err.Error())
+		assert.Equal(t, erroer.Class(directErr), erroer.Class(err))
+	})
+}
+
+func TestHandleInvocationRollback(t *testing.T) {
+	ctx := context.Background()
+	secretArn := "arn:aws:secretsmanager:us-east-1:123456789012:secret:rolled-back-AbCdEf"
+	token := "5b4a3c2d-1e0f-4a9b-8c7d-6e5f4a3b2c1d"
+	t.Setenv("TF_VAR_rotation_generator", "local")
+
+	auditFile := filepath.Join(t.TempDir(), "audit.jsonl")
+	t.Setenv("TF_VAR_rotation_audit_file", auditFile)
+	t.Setenv("TF_VAR_rotation_audit_salt", "salt")
+
+	backend := useInMemoryBackend(t, secretArn, token, "initial-password")
+	useRecordingNotifier(t)
+	useInMemoryMetrics(t)
+
+	for _, step := range sm.AllowedSteps {
+		_, err := handleRequest(ctx, sm.Event{Arn: aws.String(secretArn), Token: aws.String(token),
+			Step: aws.String(step)})
+		assert.NoErrorf(t, err, "step %s should not error", step)
+	}
+
+	_, err := handleInvocation(ctx, json.RawMessage(fmt.Sprintf(`{"action":"rollback","secret_id":%q,
+		"arguments":{"restore_target":"maybe"}}`, secretArn)))
+	assert.ErrorIs(t, err, erroer.ErrEventMalformed)
+
+	result, err := handleInvocation(ctx, json.RawMessage(fmt.Sprintf(`{"action":"rollback","secret_id":%q,
+		"arguments":{"restore_target":"true","reason":"bad value promoted"}}`, secretArn)))
+	assert.NoError(t, err)
+
+	if rollback, ok := result.(*sm.RollbackResult); assert.True(t, ok) {
+		assert.True(t, rollback.RolledBack)
+		assert.Equal(t, token, rollback.FromVersion)
+	}
+
+	current, err := backend.GetSecretValue(ctx, secretArn, "", "AWSCURRENT")
+	assert.NoError(t, err)
+	assert.Equal(t, "initial-password", aws.ToString(current.SecretString))
+
+	records, err := audit.NewFileSink(auditFile).Query(ctx, secretArn)
+	assert.NoError(t, err)
+	if assert.Len(t, records, 5) {
+		assert.Equal(t, sm.StepRollback, records[4].Step)
+		assert.Equal(t, "bad value promoted", records[4].Reason)
+		assert.Equal(t, audit.Fingerprint("salt", "initial-password"), records[4].Fingerprint)
+	}
+}
+
+// useInMemoryBackend makes handleRequest rotate against an in-memory Secrets Manager, seeded
+// with a rotation enabled secret whose rotation has already been started with the given token.
+func useInMemoryBackend(t *testing.T, secretArn, token, value string) *client.InMemorySecretsManager {
+	backend := client.NewInMemorySecretsManager(zap.NewNop())
+	_, err := backend.CreateSecret(client.InMemorySecretInput{
+		ARN:             secretArn,
+		Name:            "test-secret",
+		Value:           value,
+		RotationEnabled: true,
+	})
+	assert.NoError(t, err)
+
+	_, err = backend.StartRotation(secretArn, token)
+	assert.NoError(t, err)
+
+	original := newRotator
+	t.Cleanup(func() {
+		newRotator = original
+	})
+
+	newRotator = func(ctx context.Context, cfg config.Config, event sm.Event,
+		logger *zap.Logger) (*sm.RotatorClient, error) {
+		return sm.NewRotatorWithClient(cfg, event, logger, backend)
+	}
+
+	return backend
+}
+
 func ReadJSONFromFile(t *testing.T, inputFile string) []byte {
 	inputJSON, err := os.ReadFile(inputFile)
 	if err != nil {
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/aws/aws-lambda-go/lambdacontext"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/audit"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/config"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/erroer"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/metrics"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/notifier"
+	"github.com/excoriate/aws-secrets-rotation-lambda/internal/rotation"
+	"go.uber.org/zap"
+	"os"
+	"time"
+)
+
+// newNotifier, newAuditSink and newMetricsRecorder build the sinks of the step outcomes. They're
+// variables, so tests can replace them.
+var (
+	newNotifier        = rotation.NewNotifier
+	newAuditSink       = rotation.NewAuditSink
+	newMetricsRecorder = func(namespace string) metrics.Recorder {
+		return metrics.NewEMFRecorder(os.Stdout, namespace)
+	}
+)
+
+// outcomeReporter audits, notifies and records the metrics of the outcome of a rotation step.
+// The rotator, the secret and its strategy are set as soon as they're known, to add their
+// details to the outcome.
+type outcomeReporter struct {
+	logger   *zap.Logger
+	event    rotation.Event
+	notifier notifier.Notifier
+	sink     audit.Sink
+	salt     string
+	started  time.Time
+
+	rotator  *rotation.RotatorClient
+	secret   *secretsmanager.DescribeSecretOutput
+	strategy string
+}
+
+// finish audits and notifies the outcome of the step. Since the audit trail must be complete,
+// failing to write it fails the step (every step is idempotent, so it's safe to retry it).
+// Notification failures are only logged.
+func (r *outcomeReporter) finish(ctx context.Context, err error) error {
+	if auditErr := r.audit(ctx, err); auditErr != nil {
+		r.logger.Error("Unable to write the audit record of the step", zap.Error(auditErr))
+		if err == nil {
+			err = erroer.NewRotationError("unable to write the audit record of the step", auditErr)
+		}
+	}
+
+	r.record(ctx, err)
+	r.notify(ctx, err)
+	return err
+}
+
+// record emits the outcome of the step, by error class if it failed, and the time since the
+// secret was last rotated (or created, if it was never rotated).
+func (r *outcomeReporter) record(ctx context.Context, err error) {
+	dimensions := map[string]string{
+		metrics.DimensionStep:     aws.ToString(r.event.Step),
+		metrics.DimensionStrategy: r.strategy,
+	}
+
+	if err != nil {
+		failed := map[string]string{metrics.DimensionErrorClass: erroer.Class(err)}
+		for key, value := range dimensions {
+			failed[key] = value
+		}
+
+		metrics.Record(ctx, metrics.StepFailed, 1, metrics.UnitCount, failed)
+	} else {
+		metrics.Record(ctx, metrics.StepSucceeded, 1, metrics.UnitCount, dimensions)
+	}
+
+	if r.secret == nil {
+		return
+	}
+
+	lastRotated := r.secret.LastRotatedDate
+	if lastRotated == nil {
+		lastRotated = r.secret.CreatedDate
+	}
+
+	if lastRotated != nil {
+		metrics.Record(ctx, metrics.TimeSinceLastRotation, time.Since(*lastRotated).Seconds(),
+			metrics.UnitSeconds, dimensions)
+	}
+}
+
+func (r *outcomeReporter) audit(ctx context.Context, err error) error {
+	if sinks, ok := r.sink.(audit.MultiSink); ok && len(sinks) == 0 {
+		return nil
+	}
+
+	outcome := notifier.NewEvent(aws.ToString(r.event.Arn), aws.ToString(r.event.Step),
+		aws.ToString(r.event.Token), time.Since(r.started), err)
+
+	record := audit.Record{
+		SecretArn:        outcome.SecretArn,
+		Timestamp:        outcome.Timestamp,
+		Step:             outcome.Step,
+		Outcome:          string(outcome.Outcome),
+		ErrorClass:       outcome.ErrorClass,
+		PendingVersionID: outcome.Token,
+		CurrentVersionID: r.currentVersionID(),
+	}
+
+	if lc, ok := lambdacontext.FromContext(ctx); ok {
+		record.RequestID = lc.AwsRequestID
+		record.FunctionArn = lc.InvokedFunctionArn
+	}
+
+	if err == nil && r.rotator != nil {
+		pending, valueErr := r.rotator.Client.GetSecretValue(ctx, record.SecretArn,
+			record.PendingVersionID, rotation.GetStagingLabels().Pending)
+		if valueErr != nil {
+			r.logger.Warn("Unable to read the AWSPENDING value to fingerprint it", zap.Error(valueErr))
+		} else {
+			record.Fingerprint = audit.Fingerprint(r.salt, aws.ToString(pending.SecretString))
+		}
+	}
+
+	return r.sink.Write(ctx, record)
+}
+
+// notify sends the outcome of the step and, if it ended the rotation (because it failed, or
+// because it was finishSecret), the outcome of the whole rotation. The rotation started when
+// createSecret put the AWSPENDING version, which is the last change of the secret until
+// finishSecret.
+func (r *outcomeReporter) notify(ctx context.Context, err error) {
+	secretArn := aws.ToString(r.event.Arn)
+	step := aws.ToString(r.event.Step)
+	token := aws.ToString(r.event.Token)
+	stepDuration := time.Since(r.started)
+
+	events := []notifier.Event{notifier.NewEvent(secretArn, step, token, stepDuration, err)}
+	if err != nil {
+		events = append(events, notifier.NewEvent(secretArn, notifier.StepRotation, token, stepDuration, err))
+	} else if step == rotation.GetSteps().Finish {
+		rotationDuration := stepDuration
+		if r.secret != nil && r.secret.LastChangedDate != nil {
+			rotationDuration = time.Since(*r.secret.LastChangedDate)
+		}
+
+		events = append(events, notifier.NewEvent(secretArn, notifier.StepRotation, token,
+			rotationDuration, nil))
+	}
+
+	for _, e := range events {
+		if notifyErr := r.notifier.Notify(ctx, e); notifyErr != nil {
+			r.logger.Warn("Unable to notify the rotation outcome", zap.String("step", e.Step),
+				zap.Error(notifyErr))
+		}
+	}
+}
+
+// currentVersionID returns the AWSCURRENT version of the secret when the step started.
+func (r *outcomeReporter) currentVersionID() string {
+	if r.secret == nil {
+		return ""
+	}
+
+	for versionID, stages := range r.secret.VersionIdsToStages {
+		for _, stage := range stages {
+			if stage == rotation.GetStagingLabels().Current {
+				return versionID
+			}
+		}
+	}
+
+	return ""
+}
+
+func newOutcomeReporter(ctx context.Context, cfg config.Config, logger *zap.Logger,
+	event rotation.Event) (*outcomeReporter, error) {
+	n, err := newNotifier(ctx, cfg.Notifications, logger)
+	if err != nil {
+		logger.Warn("Rotation notifier cannot be initialised, outcomes won't be notified", zap.Error(err))
+		n = notifier.MultiNotifier{}
+	}
+
+	sink, err := newAuditSink(ctx, cfg.Audit, logger)
+	if err != nil {
+		logger.Error("Rotation audit sink cannot be initialised", zap.Error(err))
+		return nil, fmt.Errorf("rotation audit sink cannot be initialised: %w", err)
+	}
+
+	return &outcomeReporter{
+		logger:   logger,
+		event:    event,
+		notifier: n,
+		sink:     sink,
+		salt:     cfg.Audit.Salt,
+		started:  time.Now(),
+	}, nil
+}